@@ -0,0 +1,36 @@
+package mswkn
+
+import (
+	"context"
+	"strings"
+)
+
+const (
+	//AliasSourceXetra marks aliases created from the mnemonics of the Xetra instrument list
+	AliasSourceXetra = "xetra"
+	//AliasSourceFile marks aliases imported from a mapping file
+	AliasSourceFile = "file"
+)
+
+//Alias maps a ticker or a common name of a security to its WKN
+type Alias struct {
+	//Alias is upper case, e.g. TSLA or DEUTSCHE BANK
+	Alias string
+	WKN   string
+	//Source is one of the AliasSource constants
+	Source string
+	//Confidence between 0 and 1 that a mention of the alias means the security
+	Confidence float64
+}
+
+type AliasRepository interface {
+	//AddBulk adds the aliases or replaces their confidence, an alias is identified by alias, WKN and source
+	AddBulk(ctx context.Context, aliases []*Alias) error
+	//GetMany returns the aliases of the given names with the name as key, unknown names are left out
+	GetMany(ctx context.Context, names []string) (map[string][]*Alias, error)
+}
+
+//NormalizeAlias upper cases a name and collapses its whitespace
+func NormalizeAlias(name string) string {
+	return strings.Join(strings.Fields(strings.ToUpper(name)), " ")
+}
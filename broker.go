@@ -7,44 +7,187 @@ const (
 	BrokerSubjectRedditRepplyRequest = "request.redditreply"
 )
 
+//BrokerRequestSubjects are the subjects of the comment pipeline
+var BrokerRequestSubjects = []string{
+	BrokerSubjectWKNRequest,
+	BrokerSubjectSecuritiesRequest,
+	BrokerSubjectInfoLinksRequest,
+	BrokerSubjectRedditRepplyRequest,
+}
+
+const (
+	BrokerQueueScanner    = "scanner"
+	BrokerQueueSecurities = "securities"
+	BrokerQueueInfoLinks  = "infolinks"
+	BrokerQueueResponder  = "responder"
+	BrokerQueueDeadLetter = "deadletters"
+)
+
+//BrokerSchemaVersion is the version of the request wire types. It is raised on incompatible changes,
+//stages reject messages with a newer version than they know.
+const BrokerSchemaVersion = 1
+
+//ErrorCode describes why a WKN could not be processed, it replaces error values on the wire
+type ErrorCode string
+
+const (
+	ErrorCodeSecurityNotFound ErrorCode = "security_not_found"
+	ErrorCodeSecurityRepo     ErrorCode = "security_repo"
+	ErrorCodeInfoLinkNotFound ErrorCode = "infolink_not_found"
+)
+
+const (
+	//ReplyKindComment answers with a comment below the thing named in the request
+	ReplyKindComment = "comment"
+	//ReplyKindMessage answers with a private message to ReplyTarget.Author
+	ReplyKindMessage = "message"
+)
+
+//Command is requested with the bot keyword, e.g. $WKN details A1B2C3
+type Command string
+
+const (
+	//CommandLookup answers with the securities of all WKNs found in a comment, it is the default without command
+	CommandLookup Command = ""
+	//CommandHelp explains the usage of the bot
+	CommandHelp Command = "help"
+	//CommandDetails answers with an extended card of a single security
+	CommandDetails Command = "details"
+	//CommandCompare answers with a side-by-side table of several securities
+	CommandCompare Command = "compare"
+)
+
+const (
+	//LanguageGerman is the default language of replies
+	LanguageGerman  = "de"
+	LanguageEnglish = "en"
+)
+
+//ReplyTarget tells the responder how to answer a request
+type ReplyTarget struct {
+	//Kind is ReplyKindComment or ReplyKindMessage, empty means comment
+	Kind string `json:"kind" proto:"1"`
+	//Author of the comment or private message
+	Author string `json:"author" proto:"2"`
+	//Subject of the private message
+	Subject string `json:"subject" proto:"3"`
+	//ReplyID is the name of an existing reply of the bot, it is edited instead of answering again
+	ReplyID string `json:"reply_id" proto:"4"`
+	//Language of the reply, one of the Language constants. Empty means LanguageGerman.
+	Language string `json:"language" proto:"5"`
+	//Template is the name of the reply template set, empty means the default set
+	Template string `json:"template" proto:"6"`
+	//Direct is set for mentions and private messages, they address the bot and need no keyword
+	Direct bool `json:"direct" proto:"7"`
+}
+
+//IsEdit reports if an existing reply has to be edited
+func (t ReplyTarget) IsEdit() bool {
+	return t.ReplyID != ""
+}
+
+//IsMessage reports if the answer has to be sent as private message
+func (t ReplyTarget) IsMessage() bool {
+	return t.Kind == ReplyKindMessage
+}
+
+//Versioned is implemented by all wire types of the broker
+type Versioned interface {
+	GetSchemaVersion() int
+}
+
 type RedditRequest struct {
+	SchemaVersion int `json:"schema_version" proto:"1"`
+	//Trace correlates the requests of one comment
+	Trace Trace `json:"trace" proto:"2"`
 	//Name is an ID of the reddit comment
-	Name string
+	Name string `json:"name" proto:"3"`
 	//Text is the comment body
-	Text string
+	Text string `json:"text" proto:"4"`
+	//ReplyTarget describes where the answer is sent to
+	ReplyTarget ReplyTarget `json:"reply_target" proto:"5"`
+	//Subreddit the comment was posted in, it is empty for private messages
+	Subreddit string `json:"subreddit" proto:"6"`
+}
+
+func (r *RedditRequest) GetSchemaVersion() int {
+	return r.SchemaVersion
 }
 
 type SecuritiesRequest struct {
+	SchemaVersion int `json:"schema_version" proto:"1"`
+	//Trace correlates the requests of one comment
+	Trace Trace `json:"trace" proto:"2"`
 	//Name is an ID of the reddit comment
-	Name string
+	Name string `json:"name" proto:"3"`
 	//WKNs requested from user
-	WKNs []string
+	WKNs []string `json:"wkns" proto:"4"`
+	//ReplyTarget describes where the answer is sent to
+	ReplyTarget ReplyTarget `json:"reply_target" proto:"5"`
+	//ISINs requested from user, they are resolved to WKNs
+	ISINs []string `json:"isins" proto:"6"`
+	//Command requested from user, the WKNs are its arguments
+	Command Command `json:"command" proto:"7"`
+}
+
+func (r *SecuritiesRequest) GetSchemaVersion() int {
+	return r.SchemaVersion
 }
 
 type InfoLinksRequest struct {
+	SchemaVersion int `json:"schema_version" proto:"1"`
+	//Trace correlates the requests of one comment
+	Trace Trace `json:"trace" proto:"2"`
 	//Name is an ID of the reddit comment
-	Name string
+	Name string `json:"name" proto:"3"`
 	//WKNs requested from user
-	WKNs []string
+	WKNs []string `json:"wkns" proto:"4"`
 	//Contains a map with WKNs as keys and the found Security list
-	Securities map[string]*Security
-	//Contains a map with WKNs as keys and the errors
-	ResponseErrors map[string]error
+	Securities map[string]*Security `json:"securities" proto:"5"`
+	//Errors contains a map with WKNs as keys and the reason why they could not be processed
+	Errors map[string]ErrorCode `json:"errors" proto:"6"`
+	//ReplyTarget describes where the answer is sent to
+	ReplyTarget ReplyTarget `json:"reply_target" proto:"7"`
+	//Suggestions contains a map with unknown WKNs as keys and similar existing WKNs, their securities are in Securities
+	Suggestions map[string][]string `json:"suggestions" proto:"8"`
+	//Command requested from user, the WKNs are its arguments
+	Command Command `json:"command" proto:"9"`
+}
+
+func (r *InfoLinksRequest) GetSchemaVersion() int {
+	return r.SchemaVersion
 }
 
 type RedditReplyRequest struct {
+	SchemaVersion int `json:"schema_version" proto:"1"`
+	//Trace correlates the requests of one comment
+	Trace Trace `json:"trace" proto:"2"`
 	//Name is an ID of the reddit comment
-	Name string
+	Name string `json:"name" proto:"3"`
 	//WKNs requested from user
-	WKNs []string
+	WKNs []string `json:"wkns" proto:"4"`
 	//Securities is a map with WKNs as keys and the found Security list
-	Securities map[string]*Security
+	Securities map[string]*Security `json:"securities" proto:"5"`
 	//InfoLinks is a map with WKNs as keys and the found InfoLink list
-	InfoLinks map[string]*InfoLink
+	InfoLinks map[string]*InfoLink `json:"infolinks" proto:"6"`
+	//Errors contains a map with WKNs as keys and the reason why they could not be processed
+	Errors map[string]ErrorCode `json:"errors" proto:"7"`
+	//ReplyTarget describes where the answer is sent to
+	ReplyTarget ReplyTarget `json:"reply_target" proto:"8"`
+	//Suggestions contains a map with unknown WKNs as keys and similar existing WKNs, their securities are in Securities
+	Suggestions map[string][]string `json:"suggestions" proto:"9"`
+	//Command requested from user, the WKNs are its arguments
+	Command Command `json:"command" proto:"10"`
+}
+
+func (r *RedditReplyRequest) GetSchemaVersion() int {
+	return r.SchemaVersion
 }
 
 type Broker interface {
 	Publish(subject string, v interface{}) error
 	Subscribe(subject string, handler interface{}) error
+	//QueueSubscribe delivers every message to only one of the subscribers sharing the same queue name
+	QueueSubscribe(subject, queue string, handler interface{}) error
 	Close()
 }
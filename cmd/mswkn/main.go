@@ -17,6 +17,11 @@ var version = "snapshot"
 func main() {
 	conf := config.LoadConfigFromEnv(version)
 
+	//services given as arguments take precedence over SERVICES, e.g. 'mswkn listener responder'
+	if len(os.Args) > 1 {
+		conf.Services = config.ParseServices(strings.Join(os.Args[1:], ","))
+	}
+
 	setLogLevel(conf)
 
 	ctx, cancel := handleSignals()
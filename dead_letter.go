@@ -0,0 +1,38 @@
+package mswkn
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+//BrokerSubjectDeadLetterPrefix is prepended to the subject of messages which exhausted their retries
+const BrokerSubjectDeadLetterPrefix = "deadletter."
+
+var (
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+)
+
+type DeadLetter struct {
+	//ID identifies the dead letter for re-injecting
+	ID string `proto:"1"`
+	//Subject the message was originally published to
+	Subject string `proto:"2"`
+	//Payload is the original message as encoded by Codec
+	Payload []byte `proto:"3"`
+	//Codec is the name of the codec used for the payload
+	Codec string `proto:"4"`
+	//Error is the last error returned by the handler
+	Error string `proto:"5"`
+	//Attempts is the number of times the handler was called
+	Attempts int `proto:"6"`
+	//FailedAt is the time of the last attempt
+	FailedAt time.Time `proto:"7"`
+}
+
+type DeadLetterRepository interface {
+	Add(ctx context.Context, dl *DeadLetter) error
+	Get(ctx context.Context, id string) (*DeadLetter, error)
+	List(ctx context.Context) ([]*DeadLetter, error)
+	Delete(ctx context.Context, id string) error
+}
@@ -10,8 +10,8 @@ var (
 )
 
 type InfoLink struct {
-	WKN string
-	URL string
+	WKN string `proto:"1"`
+	URL string `proto:"2"`
 }
 
 type InfoLinkRepository interface {
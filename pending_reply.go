@@ -0,0 +1,71 @@
+package mswkn
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrPendingReplyNotFound = errors.New("pending reply not found")
+)
+
+const (
+	//PendingReplyActionComment answers a comment, Target is the name of the comment
+	PendingReplyActionComment = "comment"
+	//PendingReplyActionMessage sends a private message, Target is the user
+	PendingReplyActionMessage = "message"
+	//PendingReplyActionEdit edits a reply of the bot, Target is the name of the reply
+	PendingReplyActionEdit = "edit"
+	//PendingReplyActionDelete deletes a reply of the bot, Target is the name of the reply
+	PendingReplyActionDelete = "delete"
+)
+
+//PendingReply is an outbound reddit action in the reply queue of the responder
+type PendingReply struct {
+	//ID identifies the pending reply
+	ID string
+	//Name is an ID of the answered reddit comment, post or message
+	Name string
+	//Action is one of the PendingReplyAction constants
+	Action string
+	//Target is the thing or user the action is sent to
+	Target string
+	//Subject of a private message
+	Subject string
+	//Body is the rendered reply
+	Body string
+	//WKNs found in the comment, they are stored in the ledger of processed comments after sending
+	WKNs []string
+	//Attempts is the number of failed sends
+	Attempts int
+	//NotBefore is the earliest time to send, it is postponed on rate limits and errors
+	NotBefore time.Time
+	//CreatedAt is the time the reply was queued
+	CreatedAt time.Time
+}
+
+//PendingReplyStats describes the state of the reply queue
+type PendingReplyStats struct {
+	//Depth is the number of pending replies
+	Depth int
+	//Oldest is the creation time of the oldest pending reply, it is zero for an empty queue
+	Oldest time.Time
+}
+
+//PendingReplyRepository persists the reply queue, so pending replies survive restarts
+type PendingReplyRepository interface {
+	Add(ctx context.Context, pr *PendingReply) error
+	//Replace adds an edit or delete and removes the pending edits and deletes of the same comment, only the latest
+	//change of a reply is sent
+	Replace(ctx context.Context, pr *PendingReply) error
+	//Claim returns the pending reply which is due longest and postpones it by lease, so a reply is only sent once
+	//even with several responders. A reply is sent again after the lease when a responder stops while sending.
+	//It returns ErrPendingReplyNotFound if no reply is due.
+	Claim(ctx context.Context, now time.Time, lease time.Duration) (*PendingReply, error)
+	//Update stores the attempts and the time of the next send
+	Update(ctx context.Context, pr *PendingReply) error
+	//Delete removes a sent or dropped reply
+	Delete(ctx context.Context, id string) error
+	Stats(ctx context.Context) (*PendingReplyStats, error)
+}
@@ -2,12 +2,14 @@ package pkg
 
 import (
 	"context"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"gitlab.com/mswkn/bot"
 	"gitlab.com/mswkn/bot/pkg/broker"
 	"gitlab.com/mswkn/bot/pkg/config"
 	"gitlab.com/mswkn/bot/pkg/data"
 	"gitlab.com/mswkn/bot/pkg/db"
+	"gitlab.com/mswkn/bot/pkg/deadletters"
 	"gitlab.com/mswkn/bot/pkg/http/rest"
 	"gitlab.com/mswkn/bot/pkg/infolinks"
 	"gitlab.com/mswkn/bot/pkg/listener"
@@ -16,6 +18,7 @@ import (
 	"gitlab.com/mswkn/bot/pkg/responder"
 	"gitlab.com/mswkn/bot/pkg/scanner"
 	"gitlab.com/mswkn/bot/pkg/securities"
+	"gitlab.com/mswkn/bot/pkg/tracing"
 	"time"
 )
 
@@ -32,84 +35,133 @@ func NewApp(conf config.Config) *App {
 
 func (a *App) Start(ctx context.Context, cancel context.CancelFunc) error {
 	lg := log.With().Str("comp", "app").Logger()
-	lg.Info().Str("version", a.conf.Version).Msg("initializing")
+	lg.Info().Str("version", a.conf.Version).Strs("services", a.conf.Services).Msg("initializing")
 
-	msg := broker.NewNatsClient(a.conf, cancel)
+	shutdownTracing, err := tracing.Init(ctx, a.conf)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tCtx, tCancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer tCancel()
+		if err := shutdownTracing(tCtx); err != nil {
+			lg.Error().Err(err).Msg("could not flush traces")
+		}
+	}()
+
+	//jetstream redelivers failed messages itself, the other brokers retry in process
+	var msg mswkn.Broker
+	if a.conf.Queue.Memory.Enabled {
+		msg = broker.NewRetryClient(broker.NewMemoryClient(a.conf), a.conf)
+		lg.Info().Int("size", a.conf.Queue.Memory.Size).Msg("using memory broker")
+	} else if a.conf.Queue.Nats.JetStream.Enabled {
+		msg = broker.NewJetStreamClient(a.conf, cancel)
+		lg.Info().Str("stream", a.conf.Queue.Nats.JetStream.Stream).Msg("using nats jetstream broker")
+	} else {
+		msg = broker.NewRetryClient(broker.NewNatsClient(a.conf, cancel), a.conf)
+		lg.Info().Msg("using nats broker")
+	}
 
 	bulkUpdateSize := 100_000
 
 	//initialize repositories
 	var secRepo mswkn.SecurityRepository
 	var infoLinkRepo mswkn.InfoLinkRepository
+	var processedRepo mswkn.ProcessedCommentRepository
+	var aliasRepo mswkn.AliasRepository
+	var pendingReplyRepo mswkn.PendingReplyRepository
+	var deadLetterRepo mswkn.DeadLetterRepository
 	if a.conf.Database.Pg.Enabled {
 		pgDB := db.NewPgDb(a.conf)
 		defer pgDB.Close()
 		secRepo = db.NewPgSecurityRepository(pgDB)
 		infoLinkRepo = db.NewPgInfoLinkRepository(pgDB)
+		processedRepo = db.NewPgProcessedCommentRepository(pgDB)
+		aliasRepo = db.NewPgAliasRepository(pgDB)
+		pendingReplyRepo = db.NewPgPendingReplyRepository(pgDB)
+		deadLetterRepo = db.NewPgDeadLetterRepository(pgDB)
 		bulkUpdateSize = 5_000
 		lg.Info().Msg("using postgres data backend")
 	} else {
 		secRepo = db.NewMemorySecurityRepository()
 		infoLinkRepo = db.NewMemoryInfoLinkRepository()
+		processedRepo = db.NewMemoryProcessedCommentRepository()
+		aliasRepo = db.NewMemoryAliasRepository()
+		pendingReplyRepo = db.NewMemoryPendingReplyRepository()
+		deadLetterRepo = db.NewMemoryDeadLetterRepository()
 		lg.Info().Msg("using memory data backend")
 	}
 
-	onvistaClient := onvista.NewClient()
-	updater := data.NewUpdater(a.conf, secRepo, bulkUpdateSize)
-	redditClient := reddit.NewClient(a.conf)
-	commentListener := listener.NewListener(a.conf, redditClient, msg)
-	secService := securities.NewService(msg, secRepo)
-	infoLinkService := infolinks.NewService(msg, onvistaClient, infoLinkRepo)
-	responderService := responder.NewResponder(msg, redditClient)
+	if a.conf.Queue.Memory.Enabled && !a.conf.AllServicesEnabled() {
+		lg.Warn().Strs("services", a.conf.Services).Msg("memory broker only connects services within this process")
+	}
+	if !a.conf.Database.Pg.Enabled && a.conf.ServiceEnabled(config.ServiceSecurities) && !a.conf.ServiceEnabled(config.ServiceUpdater) {
+		lg.Warn().Msg("security service without updater has no data when using the memory data backend")
+	}
 
-	httpServer := rest.NewServer(a.conf, msg, secRepo, nil)
+	var redditClient reddit.RedditAPI
+	if a.conf.ServiceEnabled(config.ServiceListener) || a.conf.ServiceEnabled(config.ServiceResponder) {
+		redditClient = reddit.NewClient(a.conf)
+	}
 
-	//	wg := sync.WaitGroup{}
+	if a.conf.ServiceEnabled(config.ServiceUpdater) {
+		updater := data.NewUpdater(a.conf, secRepo, aliasRepo, bulkUpdateSize)
+		a.run(cancel, lg, config.ServiceUpdater, func() {
+			updater.StartUpdater(ctx)
+		})
+	}
 
-	go func() {
-		defer cancel()
-		lg.Debug().Msg("starting data updater")
-		updater.StartUpdater(ctx)
-	}()
+	if a.conf.ServiceEnabled(config.ServiceListener) {
+		commentListener := listener.NewListener(a.conf, redditClient, msg, processedRepo)
+		a.run(cancel, lg, config.ServiceListener, func() {
+			commentListener.Start(ctx)
+		})
+	}
 
-	go func() {
-		defer cancel()
-		lg.Debug().Msg("starting comment listener")
-		commentListener.Start(ctx)
-	}()
+	if a.conf.ServiceEnabled(config.ServiceScanner) {
+		a.run(cancel, lg, config.ServiceScanner, func() {
+			scanner.NewScanner(a.conf, msg, aliasRepo).Start(ctx)
+		})
+	}
 
-	go func() {
-		defer cancel()
-		lg.Debug().Msg("starting scanner")
-		scanner.NewScanner(msg).Start(ctx)
-	}()
+	if a.conf.ServiceEnabled(config.ServiceSecurities) {
+		secService := securities.NewService(msg, secRepo)
+		a.run(cancel, lg, config.ServiceSecurities, func() {
+			secService.Start(ctx)
+		})
+	}
 
-	go func() {
-		defer cancel()
-		lg.Debug().Msg("starting security service")
-		secService.Start(ctx)
-	}()
+	if a.conf.ServiceEnabled(config.ServiceInfoLinks) {
+		infoLinkService := infolinks.NewService(msg, onvista.NewClient(), infoLinkRepo)
+		a.run(cancel, lg, config.ServiceInfoLinks, func() {
+			infoLinkService.Start(ctx)
+		})
+	}
 
-	go func() {
-		defer cancel()
-		lg.Debug().Msg("starting infolink service")
-		infoLinkService.Start(ctx)
-	}()
+	if a.conf.ServiceEnabled(config.ServiceResponder) {
+		responderService := responder.NewResponder(a.conf, msg, redditClient, processedRepo, pendingReplyRepo)
+		a.run(cancel, lg, config.ServiceResponder, func() {
+			responderService.Start(ctx)
+		})
+	}
 
-	go func() {
-		defer cancel()
-		lg.Debug().Msg("starting responder service")
-		responderService.Start(ctx)
-	}()
+	if a.conf.ServiceEnabled(config.ServiceDeadLetters) {
+		deadLetterService := deadletters.NewService(msg, deadLetterRepo)
+		a.run(cancel, lg, config.ServiceDeadLetters, func() {
+			deadLetterService.Start(ctx)
+		})
+	}
 
-	go func() {
-		defer cancel()
-		defer httpServer.Stop(context.Background())
-		lg.Debug().Msg("starting http server")
-		if err := httpServer.Start(); err != nil {
-			lg.Error().Err(err).Msg("shutting down http server")
-		}
-	}()
+	var httpServer *rest.Server
+	if a.conf.ServiceEnabled(config.ServiceHTTP) {
+		httpServer = rest.NewServer(a.conf, msg, secRepo, nil, deadLetterRepo, pendingReplyRepo)
+		a.run(cancel, lg, config.ServiceHTTP, func() {
+			defer httpServer.Stop(context.Background())
+			if err := httpServer.Start(); err != nil {
+				lg.Error().Err(err).Msg("shutting down http server")
+			}
+		})
+	}
 
 	//wait for stop signal
 	<-ctx.Done()
@@ -117,11 +169,22 @@ func (a *App) Start(ctx context.Context, cancel context.CancelFunc) error {
 
 	msg.Close()
 
-	httpCtx, httpCancel := context.WithTimeout(ctx, time.Second*5)
-	defer httpCancel()
-	if err := httpServer.Stop(httpCtx); err != nil {
-		lg.Error().Err(err).Msg("")
+	if httpServer != nil {
+		httpCtx, httpCancel := context.WithTimeout(ctx, time.Second*5)
+		defer httpCancel()
+		if err := httpServer.Stop(httpCtx); err != nil {
+			lg.Error().Err(err).Msg("")
+		}
 	}
 
 	return nil
 }
+
+//run starts a service in its own goroutine, the bot shuts down when any service stops
+func (a *App) run(cancel context.CancelFunc, lg zerolog.Logger, service string, start func()) {
+	go func() {
+		defer cancel()
+		lg.Debug().Str("service", service).Msg("starting service")
+		start()
+	}()
+}
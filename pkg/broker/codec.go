@@ -0,0 +1,90 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	CodecJSON     = "json"
+	CodecProtobuf = "protobuf"
+)
+
+//Codec encodes messages for the wire. Codecs pass RawMessage through unchanged.
+type Codec interface {
+	Name() string
+	Encode(v interface{}) ([]byte, error)
+	Decode(data []byte, vPtr interface{}) error
+}
+
+//RawMessage is an already encoded message, e.g. the payload of a dead letter
+type RawMessage []byte
+
+func NewCodec(name string) (Codec, error) {
+	switch name {
+	case CodecJSON, "":
+		return &jsonCodec{}, nil
+	case CodecProtobuf:
+		return &protobufCodec{}, nil
+	}
+	return nil, fmt.Errorf("unknown codec: %s", name)
+}
+
+type jsonCodec struct{}
+
+func (j *jsonCodec) Name() string {
+	return CodecJSON
+}
+
+func (j *jsonCodec) Encode(v interface{}) ([]byte, error) {
+	if raw, ok := rawEncode(v); ok {
+		return raw, nil
+	}
+	return json.Marshal(v)
+}
+
+func (j *jsonCodec) Decode(data []byte, vPtr interface{}) error {
+	if rawDecode(data, vPtr) {
+		return nil
+	}
+	return json.Unmarshal(data, vPtr)
+}
+
+func rawEncode(v interface{}) ([]byte, bool) {
+	switch raw := v.(type) {
+	case RawMessage:
+		return raw, true
+	case *RawMessage:
+		return *raw, true
+	}
+	return nil, false
+}
+
+func rawDecode(data []byte, vPtr interface{}) bool {
+	raw, ok := vPtr.(*RawMessage)
+	if !ok {
+		return false
+	}
+	*raw = append((*raw)[0:0], data...)
+	return true
+}
+
+//natsEncoder adapts a Codec for nats.EncodedConn
+type natsEncoder struct {
+	codec Codec
+}
+
+func (n *natsEncoder) Encode(subject string, v interface{}) ([]byte, error) {
+	return n.codec.Encode(v)
+}
+
+func (n *natsEncoder) Decode(subject string, data []byte, vPtr interface{}) error {
+	return n.codec.Decode(data, vPtr)
+}
+
+func registerNatsEncoder(codec Codec) string {
+	name := "mswkn-" + codec.Name()
+	nats.RegisterEncoder(name, &natsEncoder{codec: codec})
+	return name
+}
@@ -0,0 +1,492 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/encoding/protowire"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//protobufCodec encodes structs in the protobuf wire format of the messages in broker.proto. Field numbers are taken
+//from the `proto` struct tag, fields without the tag are not sent. Numbers must never be reused, unknown numbers are
+//skipped when decoding.
+//
+//	string, []byte          -> string, bytes
+//	bool, int, int64        -> bool, int64
+//	time.Duration           -> int64 nanoseconds
+//	float32, float64        -> float, double
+//	time.Time               -> google.protobuf.Timestamp, decoded in the local time zone
+//	struct, *struct         -> message
+//	[]T                     -> repeated T, packed scalars are accepted when decoding
+//	map[string]V            -> map<string, V>
+//	map[string][]T          -> map<string, message {repeated T = 1}>
+type protobufCodec struct{}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+var errProtobufInvalid = errors.New("invalid protobuf message")
+
+func (p *protobufCodec) Name() string {
+	return CodecProtobuf
+}
+
+func (p *protobufCodec) Encode(v interface{}) ([]byte, error) {
+	if raw, ok := rawEncode(v); ok {
+		return raw, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("protobuf codec can only encode structs, got %s", rv.Type())
+	}
+	return appendStruct(nil, rv)
+}
+
+func (p *protobufCodec) Decode(data []byte, vPtr interface{}) error {
+	if rawDecode(data, vPtr) {
+		return nil
+	}
+
+	rv := reflect.ValueOf(vPtr)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("protobuf codec needs a non nil pointer to decode into")
+	}
+	rv = rv.Elem()
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("protobuf codec can only decode structs, got %s", rv.Type())
+	}
+	return consumeStruct(data, rv)
+}
+
+type protoField struct {
+	index int
+	num   protowire.Number
+}
+
+var protoFieldCache sync.Map
+
+func protoFields(t reflect.Type) []protoField {
+	if cached, ok := protoFieldCache.Load(t); ok {
+		return cached.([]protoField)
+	}
+
+	fields := make([]protoField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("proto")
+		if tag == "" {
+			continue
+		}
+		num, err := strconv.Atoi(tag)
+		if err != nil || !protowire.Number(num).IsValid() {
+			panic(fmt.Sprintf("invalid proto tag '%s' on %s.%s", tag, t, t.Field(i).Name))
+		}
+		fields = append(fields, protoField{index: i, num: protowire.Number(num)})
+	}
+
+	protoFieldCache.Store(t, fields)
+	return fields
+}
+
+func appendStruct(b []byte, rv reflect.Value) ([]byte, error) {
+	var err error
+	for _, f := range protoFields(rv.Type()) {
+		b, err = appendField(b, f.num, rv.Field(f.index), false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+//appendField appends a single field, zero values are skipped unless they are elements of a list or map
+func appendField(b []byte, num protowire.Number, v reflect.Value, keepZero bool) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.Len() == 0 && !keepZero {
+			return b, nil
+		}
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendString(b, v.String()), nil
+	case reflect.Bool:
+		if !v.Bool() && !keepZero {
+			return b, nil
+		}
+		b = protowire.AppendTag(b, num, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeBool(v.Bool())), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() == 0 && !keepZero {
+			return b, nil
+		}
+		b = protowire.AppendTag(b, num, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(v.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() == 0 && !keepZero {
+			return b, nil
+		}
+		b = protowire.AppendTag(b, num, protowire.VarintType)
+		return protowire.AppendVarint(b, v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		if v.Float() == 0 && !keepZero {
+			return b, nil
+		}
+		if v.Kind() == reflect.Float32 {
+			b = protowire.AppendTag(b, num, protowire.Fixed32Type)
+			return protowire.AppendFixed32(b, math.Float32bits(float32(v.Float()))), nil
+		}
+		b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, math.Float64bits(v.Float())), nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return b, nil
+		}
+		return appendField(b, num, v.Elem(), true)
+	case reflect.Struct:
+		var msg []byte
+		if v.Type() == timeType {
+			t := v.Interface().(time.Time)
+			if t.IsZero() && !keepZero {
+				return b, nil
+			}
+			msg = protowire.AppendTag(msg, 1, protowire.VarintType)
+			msg = protowire.AppendVarint(msg, uint64(t.Unix()))
+			msg = protowire.AppendTag(msg, 2, protowire.VarintType)
+			msg = protowire.AppendVarint(msg, uint64(t.Nanosecond()))
+		} else {
+			var err error
+			msg, err = appendStruct(msg, v)
+			if err != nil {
+				return nil, err
+			}
+		}
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendBytes(b, msg), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.Len() == 0 && !keepZero {
+				return b, nil
+			}
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			return protowire.AppendBytes(b, v.Bytes()), nil
+		}
+		var err error
+		for i := 0; i < v.Len(); i++ {
+			b, err = appendField(b, num, v.Index(i), true)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("protobuf codec only supports string map keys, got %s", v.Type())
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			entry := protowire.AppendTag(nil, 1, protowire.BytesType)
+			entry = protowire.AppendString(entry, iter.Key().String())
+			entry, err := appendMapValue(entry, iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendBytes(b, entry)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("protobuf codec does not support %s", v.Type())
+}
+
+//appendMapValue appends the value field of a map entry, lists are wrapped in a message because maps can not have
+//repeated values
+func appendMapValue(b []byte, v reflect.Value) ([]byte, error) {
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() == reflect.Uint8 {
+		return appendField(b, 2, v, true)
+	}
+	list, err := appendField(nil, 1, v, true)
+	if err != nil {
+		return nil, err
+	}
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	return protowire.AppendBytes(b, list), nil
+}
+
+func consumeStruct(b []byte, rv reflect.Value) error {
+	fields := protoFields(rv.Type())
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		found := false
+		for _, f := range fields {
+			if f.num != num {
+				continue
+			}
+			found = true
+			n, err := consumeField(b, typ, rv.Field(f.index))
+			if err != nil {
+				return fmt.Errorf("field %s.%s: %w", rv.Type(), rv.Type().Field(f.index).Name, err)
+			}
+			b = b[n:]
+			break
+		}
+
+		if !found {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return nil
+}
+
+//consumeField decodes a single value into v, repeated values are appended
+func consumeField(b []byte, typ protowire.Type, v reflect.Value) (int, error) {
+	switch v.Kind() {
+	case reflect.String:
+		if typ != protowire.BytesType {
+			return 0, errProtobufInvalid
+		}
+		s, n := protowire.ConsumeString(b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		v.SetString(s)
+		return n, nil
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if typ != protowire.VarintType {
+			return 0, errProtobufInvalid
+		}
+		x, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		switch v.Kind() {
+		case reflect.Bool:
+			v.SetBool(protowire.DecodeBool(x))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			v.SetUint(x)
+		default:
+			v.SetInt(int64(x))
+		}
+		return n, nil
+	case reflect.Float32:
+		if typ != protowire.Fixed32Type {
+			return 0, errProtobufInvalid
+		}
+		x, n := protowire.ConsumeFixed32(b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		v.SetFloat(float64(math.Float32frombits(x)))
+		return n, nil
+	case reflect.Float64:
+		if typ != protowire.Fixed64Type {
+			return 0, errProtobufInvalid
+		}
+		x, n := protowire.ConsumeFixed64(b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		v.SetFloat(math.Float64frombits(x))
+		return n, nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return consumeField(b, typ, v.Elem())
+	case reflect.Struct:
+		if typ != protowire.BytesType {
+			return 0, errProtobufInvalid
+		}
+		msg, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		if v.Type() == timeType {
+			t, err := consumeTime(msg)
+			if err != nil {
+				return 0, err
+			}
+			v.Set(reflect.ValueOf(t))
+			return n, nil
+		}
+		return n, consumeStruct(msg, v)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if typ != protowire.BytesType {
+				return 0, errProtobufInvalid
+			}
+			bs, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return 0, protowire.ParseError(n)
+			}
+			v.SetBytes(append([]byte(nil), bs...))
+			return n, nil
+		}
+		if typ == protowire.BytesType && isPackable(v.Type().Elem()) {
+			return consumePacked(b, v)
+		}
+		elem := reflect.New(v.Type().Elem()).Elem()
+		n, err := consumeField(b, typ, elem)
+		if err != nil {
+			return 0, err
+		}
+		v.Set(reflect.Append(v, elem))
+		return n, nil
+	case reflect.Map:
+		if typ != protowire.BytesType {
+			return 0, errProtobufInvalid
+		}
+		entry, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		key := reflect.New(v.Type().Key()).Elem()
+		val := reflect.New(v.Type().Elem()).Elem()
+		for len(entry) > 0 {
+			num, etyp, en := protowire.ConsumeTag(entry)
+			if en < 0 {
+				return 0, protowire.ParseError(en)
+			}
+			entry = entry[en:]
+			switch num {
+			case 1:
+				en, err := consumeField(entry, etyp, key)
+				if err != nil {
+					return 0, err
+				}
+				entry = entry[en:]
+			case 2:
+				en, err := consumeMapValue(entry, etyp, val)
+				if err != nil {
+					return 0, err
+				}
+				entry = entry[en:]
+			default:
+				en = protowire.ConsumeFieldValue(num, etyp, entry)
+				if en < 0 {
+					return 0, protowire.ParseError(en)
+				}
+				entry = entry[en:]
+			}
+		}
+		v.SetMapIndex(key, val)
+		return n, nil
+	}
+	return 0, fmt.Errorf("protobuf codec does not support %s", v.Type())
+}
+
+//consumeMapValue decodes the value field of a map entry, lists are wrapped in a message
+func consumeMapValue(b []byte, typ protowire.Type, v reflect.Value) (int, error) {
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() == reflect.Uint8 {
+		return consumeField(b, typ, v)
+	}
+	if typ != protowire.BytesType {
+		return 0, errProtobufInvalid
+	}
+	list, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	for len(list) > 0 {
+		num, ltyp, ln := protowire.ConsumeTag(list)
+		if ln < 0 {
+			return 0, protowire.ParseError(ln)
+		}
+		list = list[ln:]
+		if num == 1 {
+			ln, err := consumeField(list, ltyp, v)
+			if err != nil {
+				return 0, err
+			}
+			list = list[ln:]
+			continue
+		}
+		ln = protowire.ConsumeFieldValue(num, ltyp, list)
+		if ln < 0 {
+			return 0, protowire.ParseError(ln)
+		}
+		list = list[ln:]
+	}
+	return n, nil
+}
+
+//isPackable reports if a repeated value of type t may be sent as packed list
+func isPackable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+//consumePacked decodes a packed list of scalars and appends them to v
+func consumePacked(b []byte, v reflect.Value) (int, error) {
+	packed, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	typ := protowire.VarintType
+	switch v.Type().Elem().Kind() {
+	case reflect.Float32:
+		typ = protowire.Fixed32Type
+	case reflect.Float64:
+		typ = protowire.Fixed64Type
+	}
+	for len(packed) > 0 {
+		elem := reflect.New(v.Type().Elem()).Elem()
+		en, err := consumeField(packed, typ, elem)
+		if err != nil {
+			return 0, err
+		}
+		packed = packed[en:]
+		v.Set(reflect.Append(v, elem))
+	}
+	return n, nil
+}
+
+func consumeTime(b []byte) (time.Time, error) {
+	var sec int64
+	var nsec int64
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return time.Time{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.VarintType {
+			return time.Time{}, errProtobufInvalid
+		}
+		x, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return time.Time{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch num {
+		case 1:
+			sec = int64(x)
+		case 2:
+			nsec = int64(int32(x))
+		}
+	}
+	return time.Unix(sec, nsec), nil
+}
@@ -0,0 +1,231 @@
+package broker
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/mswkn/bot"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	"testing"
+	"time"
+)
+
+func descField(name string, num int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+	f := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		JsonName: proto.String(name),
+		Number:   proto.Int32(num),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:     typ.Enum(),
+	}
+	if typeName != "" {
+		f.TypeName = proto.String(typeName)
+	}
+	return f
+}
+
+func descRepeated(f *descriptorpb.FieldDescriptorProto) *descriptorpb.FieldDescriptorProto {
+	f.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	return f
+}
+
+//descMapEntry returns the nested entry message of a map field and the field itself
+func descMapEntry(entry string, name string, num int32, value *descriptorpb.FieldDescriptorProto) (*descriptorpb.DescriptorProto, *descriptorpb.FieldDescriptorProto) {
+	value.Name = proto.String("value")
+	value.JsonName = proto.String("value")
+	value.Number = proto.Int32(2)
+	msg := &descriptorpb.DescriptorProto{
+		Name: proto.String(entry),
+		Field: []*descriptorpb.FieldDescriptorProto{
+			descField("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+			value,
+		},
+		Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+	}
+	return msg, descRepeated(descField(name, num, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, entry))
+}
+
+//testProtoFile describes the RedditReplyRequest of broker.proto with all messages it uses
+func testProtoFile(t *testing.T) protoreflect.FileDescriptor {
+	const (
+		typeString  = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		typeInt64   = descriptorpb.FieldDescriptorProto_TYPE_INT64
+		typeDouble  = descriptorpb.FieldDescriptorProto_TYPE_DOUBLE
+		typeBool    = descriptorpb.FieldDescriptorProto_TYPE_BOOL
+		typeMessage = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+		timestamp   = ".google.protobuf.Timestamp"
+	)
+
+	carrierEntry, carrier := descMapEntry("CarrierEntry", "carrier", 4, descField("", 0, typeString, ""))
+	securitiesEntry, securities := descMapEntry("SecuritiesEntry", "securities", 5, descField("", 0, typeMessage, ".mswkn.Security"))
+	infoLinksEntry, infoLinks := descMapEntry("InfolinksEntry", "infolinks", 6, descField("", 0, typeMessage, ".mswkn.InfoLink"))
+	errorsEntry, errs := descMapEntry("ErrorsEntry", "errors", 7, descField("", 0, typeString, ""))
+	suggestionsEntry, suggestions := descMapEntry("SuggestionsEntry", "suggestions", 9, descField("", 0, typeMessage, ".mswkn.WKNList"))
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("broker.proto"),
+		Package:    proto.String("mswkn"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Trace"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					descField("request_id", 1, typeString, ""),
+					descField("received_at", 2, typeMessage, timestamp),
+					descRepeated(descField("stages", 3, typeMessage, ".mswkn.StageTiming")),
+					carrier,
+				},
+				NestedType: []*descriptorpb.DescriptorProto{carrierEntry},
+			},
+			{
+				Name: proto.String("StageTiming"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					descField("stage", 1, typeString, ""),
+					descField("start", 2, typeMessage, timestamp),
+					descField("duration", 3, typeInt64, ""),
+				},
+			},
+			{
+				Name: proto.String("ReplyTarget"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					descField("kind", 1, typeString, ""),
+					descField("author", 2, typeString, ""),
+					descField("subject", 3, typeString, ""),
+					descField("reply_id", 4, typeString, ""),
+					descField("language", 5, typeString, ""),
+					descField("template", 6, typeString, ""),
+					descField("direct", 7, typeBool, ""),
+				},
+			},
+			{
+				Name: proto.String("Security"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					descField("name", 1, typeString, ""),
+					descField("isin", 2, typeString, ""),
+					descField("wkn", 3, typeString, ""),
+					descField("underlying", 4, typeString, ""),
+					descField("type", 5, typeInt64, ""),
+					descField("warrant_type", 6, typeInt64, ""),
+					descField("warrant_sub_type", 7, typeInt64, ""),
+					descField("strike", 8, typeDouble, ""),
+					descField("expire", 9, typeMessage, timestamp),
+					descField("ticker", 10, typeString, ""),
+				},
+			},
+			{
+				Name: proto.String("InfoLink"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					descField("wkn", 1, typeString, ""),
+					descField("url", 2, typeString, ""),
+				},
+			},
+			{
+				Name: proto.String("WKNList"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					descRepeated(descField("wkns", 1, typeString, "")),
+				},
+			},
+			{
+				Name: proto.String("RedditReplyRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					descField("schema_version", 1, typeInt64, ""),
+					descField("trace", 2, typeMessage, ".mswkn.Trace"),
+					descField("name", 3, typeString, ""),
+					descRepeated(descField("wkns", 4, typeString, "")),
+					securities,
+					infoLinks,
+					errs,
+					descField("reply_target", 8, typeMessage, ".mswkn.ReplyTarget"),
+					suggestions,
+					descField("command", 10, typeString, ""),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{securitiesEntry, infoLinksEntry, errorsEntry, suggestionsEntry},
+			},
+		},
+	}
+	//nested map entries are referenced by their full name
+	for _, msg := range file.MessageType {
+		for _, f := range msg.Field {
+			if f.TypeName != nil && (*f.TypeName)[0] != '.' {
+				f.TypeName = proto.String(".mswkn." + msg.GetName() + "." + f.GetTypeName())
+			}
+		}
+	}
+
+	fd, err := protodesc.NewFile(file, protoregistry.GlobalFiles)
+	require.NoError(t, err)
+	return fd
+}
+
+func TestProtobufCodecWireCompatible(t *testing.T) {
+	desc := testProtoFile(t).Messages().ByName("RedditReplyRequest")
+	codec := &protobufCodec{}
+	want := testReplyRequest(time.Local)
+
+	data, err := codec.Encode(want)
+	require.NoError(t, err)
+
+	//the codec output is readable by protobuf implementations
+	msg := dynamicpb.NewMessage(desc)
+	require.NoError(t, proto.Unmarshal(data, msg))
+
+	get := func(m protoreflect.Message, name protoreflect.Name) protoreflect.Value {
+		return m.Get(m.Descriptor().Fields().ByName(name))
+	}
+	assert.Equal(t, int64(mswkn.BrokerSchemaVersion), get(msg, "schema_version").Int())
+	trace := get(msg, "trace").Message()
+	assert.Equal(t, want.Trace.ReceivedAt.Unix(), get(get(trace, "received_at").Message(), "seconds").Int())
+	assert.Equal(t, int64(5), get(get(trace, "received_at").Message(), "nanos").Int())
+	assert.Equal(t, int64(time.Millisecond), get(get(trace, "stages").List().Get(0).Message(), "duration").Int())
+
+	sec := get(msg, "securities").Map().Get(protoreflect.ValueOfString("AABBCC").MapKey()).Message()
+	assert.Equal(t, int64(mswkn.SecurityTypeWarrant), get(sec, "type").Int())
+	assert.Equal(t, -100.5, get(sec, "strike").Float())
+	assert.Equal(t, want.Securities["AABBCC"].Expire.Unix(), get(get(sec, "expire").Message(), "seconds").Int())
+
+	list := get(get(msg, "suggestions").Map().Get(protoreflect.ValueOfString("CCCCCC").MapKey()).Message(), "wkns").List()
+	assert.Equal(t, 2, list.Len())
+	assert.Equal(t, "OCCCCC", list.Get(1).String())
+	assert.Equal(t, mswkn.ReplyKindMessage, get(get(msg, "reply_target").Message(), "kind").String())
+
+	//messages of protobuf implementations are readable by the codec
+	data, err = proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	require.NoError(t, err)
+	got := &mswkn.RedditReplyRequest{}
+	require.NoError(t, codec.Decode(data, got))
+	assert.Equal(t, want, got)
+}
+
+func TestProtobufCodecNegativeInt(t *testing.T) {
+	codec := &protobufCodec{}
+	data, err := codec.Encode(&mswkn.DeadLetter{Attempts: -1})
+	assert.NoError(t, err)
+	//int64 fields are sign extended varints, not zigzag encoded
+	assert.Equal(t, []byte{6 << 3, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}, data)
+
+	got := &mswkn.DeadLetter{}
+	assert.NoError(t, codec.Decode(data, got))
+	assert.Equal(t, -1, got.Attempts)
+}
+
+func TestProtobufCodecPacked(t *testing.T) {
+	type packed struct {
+		Values []int `proto:"1"`
+	}
+	codec := &protobufCodec{}
+
+	var data []byte
+	data = protowire.AppendTag(data, 1, protowire.BytesType)
+	data = protowire.AppendBytes(data, []byte{1, 2, 0x7f})
+
+	got := &packed{}
+	assert.NoError(t, codec.Decode(data, got))
+	assert.Equal(t, []int{1, 2, 127}, got.Values)
+}
@@ -0,0 +1,112 @@
+package broker
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/mswkn/bot"
+	"google.golang.org/protobuf/encoding/protowire"
+	"testing"
+	"time"
+)
+
+func testReplyRequest(loc *time.Location) *mswkn.RedditReplyRequest {
+	expire := time.Date(2024, 6, 21, 0, 0, 0, 0, loc)
+	return &mswkn.RedditReplyRequest{
+		SchemaVersion: mswkn.BrokerSchemaVersion,
+		Trace: mswkn.Trace{
+			RequestID:  "abc",
+			ReceivedAt: time.Date(2021, 4, 1, 12, 0, 0, 5, loc),
+			Stages: []mswkn.StageTiming{
+				{Stage: "listener", Start: time.Date(2021, 4, 1, 12, 0, 0, 10, loc), Duration: time.Millisecond},
+			},
+			Carrier: map[string]string{"traceparent": "00-foo"},
+		},
+		Name: "t1_foo",
+		WKNs: []string{"AABBCC", "CCCCCC"},
+		Securities: map[string]*mswkn.Security{
+			"AABBCC": {
+				Name:           "a",
+				ISIN:           "DE000AABBCC1",
+				WKN:            "AABBCC",
+				Underlying:     "CCCCCC",
+				Type:           mswkn.SecurityTypeWarrant,
+				WarrantType:    mswkn.SecurityWarrantTypePut,
+				WarrantSubType: mswkn.SecurityWarrantSubTypeKnockout,
+				Strike:         -100.5,
+				Expire:         &expire,
+			},
+		},
+		InfoLinks: map[string]*mswkn.InfoLink{
+			"AABBCC": {WKN: "AABBCC", URL: "AABBCC-URL"},
+		},
+		Errors: map[string]mswkn.ErrorCode{
+			"CCCCCC": mswkn.ErrorCodeSecurityNotFound,
+		},
+		Suggestions: map[string][]string{
+			"CCCCCC": {"CCCCC0", "OCCCCC"},
+		},
+		ReplyTarget: mswkn.ReplyTarget{
+			Kind:    mswkn.ReplyKindMessage,
+			Author:  "foo",
+			Subject: "bar",
+		},
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		//loc is the time zone of decoded times, protobuf timestamps carry no zone
+		loc *time.Location
+	}{
+		{name: CodecJSON, loc: time.UTC},
+		{name: CodecProtobuf, loc: time.Local},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codec, err := NewCodec(tt.name)
+			assert.NoError(t, err)
+
+			want := testReplyRequest(tt.loc)
+			data, err := codec.Encode(want)
+			assert.NoError(t, err)
+
+			got := &mswkn.RedditReplyRequest{}
+			assert.NoError(t, codec.Decode(data, got))
+			assert.Equal(t, want, got)
+
+			var raw RawMessage
+			assert.NoError(t, codec.Decode(data, &raw))
+			reEncoded, err := codec.Encode(raw)
+			assert.NoError(t, err)
+			assert.Equal(t, data, reEncoded)
+		})
+	}
+}
+
+func TestProtobufCodecSkipsUnknownFields(t *testing.T) {
+	codec := &protobufCodec{}
+	data, err := codec.Encode(&mswkn.RedditRequest{SchemaVersion: 1, Name: "t1_foo", Text: "$wkn AABBCC"})
+	assert.NoError(t, err)
+
+	data = protowire.AppendTag(data, 99, protowire.BytesType)
+	data = protowire.AppendString(data, "added by a newer stage")
+
+	got := &mswkn.RedditRequest{}
+	assert.NoError(t, codec.Decode(data, got))
+	assert.Equal(t, &mswkn.RedditRequest{SchemaVersion: 1, Name: "t1_foo", Text: "$wkn AABBCC"}, got)
+}
+
+func TestTypedHandlerRejectsNewerSchemaVersion(t *testing.T) {
+	codec := &jsonCodec{}
+	h, err := newTypedHandler(func(rr *mswkn.RedditRequest) {
+		t.Fatal("handler must not be called")
+	}, codec)
+	assert.NoError(t, err)
+
+	data, err := codec.Encode(&mswkn.RedditRequest{SchemaVersion: mswkn.BrokerSchemaVersion + 1})
+	assert.NoError(t, err)
+
+	err = h.call(mswkn.BrokerSubjectWKNRequest, data)
+	assert.True(t, errors.Is(err, ErrDecode))
+}
@@ -0,0 +1,83 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"gitlab.com/mswkn/bot"
+	"reflect"
+)
+
+//ErrDecode is returned by handlers when the message payload does not match the handlers argument type
+var ErrDecode = errors.New("could not decode message")
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+//typedHandler wraps a handler func in the same shapes nats.EncodedConn accepts:
+//func(o *T), func(subject string, o *T) or func(subject, reply string, o *T)
+type typedHandler struct {
+	codec   Codec
+	fn      reflect.Value
+	argType reflect.Type
+	numArgs int
+}
+
+func newTypedHandler(handler interface{}, codec Codec) (*typedHandler, error) {
+	if handler == nil {
+		return nil, errors.New("handler required for subscription")
+	}
+
+	fnType := reflect.TypeOf(handler)
+	if fnType.Kind() != reflect.Func {
+		return nil, errors.New("handler needs to be a func")
+	}
+
+	numArgs := fnType.NumIn()
+	if numArgs == 0 || numArgs > 3 {
+		return nil, errors.New("handler requires one to three arguments")
+	}
+
+	return &typedHandler{
+		codec:   codec,
+		fn:      reflect.ValueOf(handler),
+		argType: fnType.In(numArgs - 1),
+		numArgs: numArgs,
+	}, nil
+}
+
+//call decodes data into a new value of the handlers argument type and calls the handler
+func (h *typedHandler) call(subject string, data []byte) error {
+	var oPtr reflect.Value
+	if h.argType.Kind() != reflect.Ptr {
+		oPtr = reflect.New(h.argType)
+	} else {
+		oPtr = reflect.New(h.argType.Elem())
+	}
+
+	if err := h.codec.Decode(data, oPtr.Interface()); err != nil {
+		return fmt.Errorf("%w: %v", ErrDecode, err)
+	}
+
+	if v, ok := oPtr.Interface().(mswkn.Versioned); ok && v.GetSchemaVersion() > mswkn.BrokerSchemaVersion {
+		return fmt.Errorf("%w: schema version %d is newer than %d", ErrDecode, v.GetSchemaVersion(), mswkn.BrokerSchemaVersion)
+	}
+
+	if h.argType.Kind() != reflect.Ptr {
+		oPtr = reflect.Indirect(oPtr)
+	}
+
+	var args []reflect.Value
+	switch h.numArgs {
+	case 1:
+		args = []reflect.Value{oPtr}
+	case 2:
+		args = []reflect.Value{reflect.ValueOf(subject), oPtr}
+	case 3:
+		args = []reflect.Value{reflect.ValueOf(subject), reflect.ValueOf(""), oPtr}
+	}
+
+	out := h.fn.Call(args)
+	if len(out) > 0 && out[len(out)-1].Type().Implements(errorType) && !out[len(out)-1].IsNil() {
+		return out[len(out)-1].Interface().(error)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+	"gitlab.com/mswkn/bot"
+	"gitlab.com/mswkn/bot/pkg/config"
+	"strings"
+	"time"
+)
+
+//jetStreamMaxBackoff has to stay below the default ack wait of 30s, otherwise the server redelivers before the nak
+const jetStreamMaxBackoff = time.Second * 20
+
+//JetStreamClient is a broker with durable consumers. Messages are acked after the handler succeeded
+//and redelivered with an increasing delay when the handler returned an error. Messages which failed on their last
+//delivery or could not be decoded are published to BrokerSubjectDeadLetterPrefix + subject.
+type JetStreamClient struct {
+	codec      Codec
+	nc         *nats.Conn
+	js         nats.JetStreamContext
+	stream     string
+	maxDeliver int
+	backoff    time.Duration
+}
+
+func NewJetStreamClient(conf config.Config, cancel context.CancelFunc) mswkn.Broker {
+	lg := log.With().Str("comp", "broker").Logger()
+
+	codec, err := NewCodec(conf.Queue.Codec)
+	if err != nil {
+		lg.Fatal().Err(err).Msg("could not create codec")
+	}
+
+	nc := connect(conf, cancel)
+
+	js, err := nc.JetStream()
+	if err != nil {
+		lg.Fatal().Err(err).Msg("could not create jetstream context")
+	}
+
+	subjects := make([]string, 0, len(mswkn.BrokerRequestSubjects)*2)
+	for _, subject := range mswkn.BrokerRequestSubjects {
+		subjects = append(subjects, subject, mswkn.BrokerSubjectDeadLetterPrefix+subject)
+	}
+
+	stream := conf.Queue.Nats.JetStream.Stream
+	streamConf := &nats.StreamConfig{
+		Name:      stream,
+		Subjects:  subjects,
+		Retention: nats.WorkQueuePolicy,
+		Storage:   nats.FileStorage,
+	}
+	if info, err := js.StreamInfo(stream); err != nil {
+		lg.Info().Str("stream", stream).Msg("creating jetstream stream")
+		if _, err := js.AddStream(streamConf); err != nil {
+			lg.Fatal().Err(err).Str("stream", stream).Msg("could not create jetstream stream")
+		}
+	} else if !equalSubjects(info.Config.Subjects, subjects) {
+		lg.Info().Str("stream", stream).Msg("updating jetstream stream subjects")
+		if _, err := js.UpdateStream(streamConf); err != nil {
+			lg.Fatal().Err(err).Str("stream", stream).Msg("could not update jetstream stream")
+		}
+	}
+
+	j := &JetStreamClient{
+		codec:      codec,
+		nc:         nc,
+		js:         js,
+		stream:     stream,
+		maxDeliver: conf.Queue.Nats.JetStream.MaxDeliver,
+		backoff:    conf.Queue.Nats.JetStream.Backoff,
+	}
+	return j
+}
+
+func (j *JetStreamClient) Publish(subject string, v interface{}) error {
+	data, err := j.codec.Encode(v)
+	if err != nil {
+		return err
+	}
+	_, err = j.js.Publish(subject, data)
+	return err
+}
+
+func (j *JetStreamClient) Subscribe(subject string, handler interface{}) error {
+	return j.subscribe(subject, "", handler)
+}
+
+//QueueSubscribe binds to the same durable consumer as Subscribe, the queue group is used on its deliver subject
+func (j *JetStreamClient) QueueSubscribe(subject, queue string, handler interface{}) error {
+	return j.subscribe(subject, queue, handler)
+}
+
+func (j *JetStreamClient) subscribe(subject, queue string, handler interface{}) error {
+	h, err := newTypedHandler(handler, j.codec)
+	if err != nil {
+		return err
+	}
+
+	lg := log.With().Str("comp", "broker").Str("subject", subject).Logger()
+
+	cb := func(m *nats.Msg) {
+		delivered := uint64(1)
+		if meta, err := m.MetaData(); err == nil {
+			delivered = meta.Delivered
+		}
+
+		if err := h.call(m.Subject, m.Data); err != nil {
+			if errors.Is(err, ErrDecode) || j.lastDelivery(delivered) {
+				lg.Error().Err(err).Uint64("delivered", delivered).Msg("handler failed, sending message to dead letter subject")
+				j.deadLetter(m, err, delivered)
+				return
+			}
+
+			delay := backoffDelay(j.backoff, delivered)
+			lg.Warn().Err(err).Uint64("delivered", delivered).Dur("delay", delay).Msg("handler failed, message will be redelivered")
+			time.AfterFunc(delay, func() {
+				if err := m.Nak(); err != nil {
+					lg.Error().Err(err).Msg("could not nak message")
+				}
+			})
+			return
+		}
+
+		if err := m.Ack(); err != nil {
+			lg.Error().Err(err).Msg("could not ack message")
+		}
+	}
+
+	opts := []nats.SubOpt{
+		nats.BindStream(j.stream),
+		nats.Durable(durableName(subject)),
+		nats.ManualAck(),
+		nats.AckExplicit(),
+	}
+	if j.maxDeliver > 0 {
+		opts = append(opts, nats.MaxDeliver(j.maxDeliver))
+	}
+
+	if queue == "" {
+		_, err = j.js.Subscribe(subject, cb, opts...)
+	} else {
+		_, err = j.js.QueueSubscribe(subject, queue, cb, opts...)
+	}
+	return err
+}
+
+//lastDelivery reports if a message is not redelivered after a failure
+func (j *JetStreamClient) lastDelivery(delivered uint64) bool {
+	return j.maxDeliver > 0 && delivered >= uint64(j.maxDeliver)
+}
+
+//deadLetter publishes a failed message to its dead letter subject and terminates its delivery.
+//Failed dead letters are not wrapped again, they are only terminated. A message stays in the stream without
+//further deliveries if its dead letter could not be sent.
+func (j *JetStreamClient) deadLetter(m *nats.Msg, err error, delivered uint64) {
+	lg := log.With().Str("comp", "broker").Str("subject", m.Subject).Logger()
+
+	if !strings.HasPrefix(m.Subject, mswkn.BrokerSubjectDeadLetterPrefix) {
+		dl := newDeadLetter(m.Subject, m.Data, j.codec, err, int(delivered))
+		if err := j.Publish(mswkn.BrokerSubjectDeadLetterPrefix+m.Subject, dl); err != nil {
+			lg.Error().Err(err).Msg("could not send dead letter")
+			return
+		}
+	}
+	if err := m.Term(); err != nil {
+		lg.Error().Err(err).Msg("could not terminate message")
+	}
+}
+
+//Close drains the connection, unsubscribing would delete the durable consumers
+func (j *JetStreamClient) Close() {
+	if err := j.nc.Drain(); err != nil {
+		log.Error().Err(err).Str("comp", "broker").Msg("could not drain connection")
+		j.nc.Close()
+	}
+}
+
+func equalSubjects(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+//durableName builds a consumer name from a subject, names must not contain dots
+func durableName(subject string) string {
+	return "mswkn-" + strings.ReplaceAll(subject, ".", "-")
+}
+
+//backoffDelay doubles the base delay for every delivery, starting with the base for the first one
+func backoffDelay(base time.Duration, delivered uint64) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	delay := base
+	for i := uint64(1); i < delivered; i++ {
+		delay *= 2
+		if delay >= jetStreamMaxBackoff {
+			return jetStreamMaxBackoff
+		}
+	}
+	return delay
+}
@@ -0,0 +1,114 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	natstest "github.com/nats-io/nats-server/v2/test"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/mswkn/bot"
+	"gitlab.com/mswkn/bot/pkg/config"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_backoffDelay(t *testing.T) {
+	tests := []struct {
+		name      string
+		base      time.Duration
+		delivered uint64
+		want      time.Duration
+	}{
+		{name: "no backoff", base: 0, delivered: 3, want: 0},
+		{name: "first delivery", base: time.Second, delivered: 1, want: time.Second},
+		{name: "third delivery", base: time.Second, delivered: 3, want: time.Second * 4},
+		{name: "capped", base: time.Second, delivered: 10, want: jetStreamMaxBackoff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, backoffDelay(tt.base, tt.delivered))
+		})
+	}
+}
+
+func Test_durableName(t *testing.T) {
+	assert.Equal(t, "mswkn-request-redditreply", durableName("request.redditreply"))
+}
+
+func newTestJetStreamClient(t *testing.T, maxDeliver int) mswkn.Broker {
+	opts := natstest.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+	opts.Username = "mswkn"
+	opts.Password = "mswkn"
+	srv := natstest.RunServer(&opts)
+	t.Cleanup(srv.Shutdown)
+
+	conf := config.Config{}
+	conf.Queue.Nats.Host = "127.0.0.1"
+	conf.Queue.Nats.Port = srv.Addr().(*net.TCPAddr).Port
+	conf.Queue.Nats.Username = "mswkn"
+	conf.Queue.Nats.Password = "mswkn"
+	conf.Queue.Nats.JetStream.Stream = "MSWKN"
+	conf.Queue.Nats.JetStream.MaxDeliver = maxDeliver
+	conf.Queue.Nats.JetStream.Backoff = time.Millisecond * 10
+	msg := NewJetStreamClient(conf, func() {})
+	t.Cleanup(msg.Close)
+	return msg
+}
+
+func TestJetStreamClient_deadLetter(t *testing.T) {
+	msg := newTestJetStreamClient(t, 3)
+
+	deadLetters := make(chan *mswkn.DeadLetter, 2)
+	err := msg.Subscribe(mswkn.BrokerSubjectDeadLetterPrefix+mswkn.BrokerSubjectRedditRepplyRequest, func(dl *mswkn.DeadLetter) {
+		deadLetters <- dl
+	})
+	assert.NoError(t, err)
+
+	var lock sync.Mutex
+	calls := make(map[string]int)
+	done := make(chan string, 2)
+	err = msg.QueueSubscribe(mswkn.BrokerSubjectRedditRepplyRequest, mswkn.BrokerQueueResponder, func(rrr *mswkn.RedditReplyRequest) error {
+		lock.Lock()
+		calls[rrr.Name]++
+		n := calls[rrr.Name]
+		lock.Unlock()
+		if rrr.Name == "flaky" && n < 3 || rrr.Name == "broken" {
+			return errors.New(rrr.Name)
+		}
+		done <- rrr.Name
+		return nil
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, msg.Publish(mswkn.BrokerSubjectRedditRepplyRequest, &mswkn.RedditReplyRequest{Name: "flaky"}))
+	assert.NoError(t, msg.Publish(mswkn.BrokerSubjectRedditRepplyRequest, &mswkn.RedditReplyRequest{Name: "broken"}))
+
+	//failed messages are redelivered by the server
+	select {
+	case name := <-done:
+		assert.Equal(t, "flaky", name)
+	case <-time.After(time.Second * 5):
+		t.Fatal("timeout waiting for redelivered message")
+	}
+
+	//the last delivery sends a dead letter
+	select {
+	case dl := <-deadLetters:
+		assert.Equal(t, mswkn.BrokerSubjectRedditRepplyRequest, dl.Subject)
+		assert.Equal(t, "broken", dl.Error)
+		assert.Equal(t, 3, dl.Attempts)
+		var rrr mswkn.RedditReplyRequest
+		assert.NoError(t, json.Unmarshal(dl.Payload, &rrr))
+		assert.Equal(t, "broken", rrr.Name)
+	case <-time.After(time.Second * 5):
+		t.Fatal("timeout waiting for dead letter")
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, 3, calls["broken"])
+}
@@ -0,0 +1,182 @@
+package broker
+
+import (
+	"errors"
+	"github.com/rs/zerolog/log"
+	"gitlab.com/mswkn/bot"
+	"gitlab.com/mswkn/bot/pkg/config"
+	"sync"
+)
+
+//ErrBrokerClosed is returned when publishing or subscribing on a closed broker
+var ErrBrokerClosed = errors.New("broker is closed")
+
+type memoryMessage struct {
+	subject string
+	data    []byte
+}
+
+type memoryQueueGroup struct {
+	handlers []*typedHandler
+	next     int
+}
+
+type memorySubject struct {
+	queue    chan *memoryMessage
+	handlers []*typedHandler
+	groups   map[string]*memoryQueueGroup
+	lock     sync.Mutex
+}
+
+//receivers returns all plain subscribers and one subscriber of every queue group, picked round-robin
+func (s *memorySubject) receivers() []*typedHandler {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	handlers := make([]*typedHandler, 0, len(s.handlers)+len(s.groups))
+	handlers = append(handlers, s.handlers...)
+	for _, g := range s.groups {
+		handlers = append(handlers, g.handlers[g.next%len(g.handlers)])
+		g.next++
+	}
+	return handlers
+}
+
+//MemoryClient is an in-process broker. Every subject has a bounded queue, publishing blocks when the queue is full.
+type MemoryClient struct {
+	codec    Codec
+	size     int
+	subjects map[string]*memorySubject
+	lock     sync.Mutex
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewMemoryClient(conf config.Config) mswkn.Broker {
+	size := conf.Queue.Memory.Size
+	if size < 1 {
+		size = 1
+	}
+
+	codec, err := NewCodec(conf.Queue.Codec)
+	if err != nil {
+		log.Fatal().Err(err).Str("comp", "broker").Msg("could not create codec")
+	}
+
+	m := &MemoryClient{
+		codec:    codec,
+		size:     size,
+		subjects: make(map[string]*memorySubject),
+		lock:     sync.Mutex{},
+		done:     make(chan struct{}),
+	}
+	return m
+}
+
+func (m *MemoryClient) Publish(subject string, v interface{}) error {
+	select {
+	case <-m.done:
+		return ErrBrokerClosed
+	default:
+	}
+
+	m.lock.Lock()
+	s, ok := m.subjects[subject]
+	m.lock.Unlock()
+	if !ok {
+		//like nats, messages without subscribers are dropped
+		return nil
+	}
+
+	data, err := m.codec.Encode(v)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case s.queue <- &memoryMessage{subject: subject, data: data}:
+		return nil
+	case <-m.done:
+		return ErrBrokerClosed
+	}
+}
+
+func (m *MemoryClient) Subscribe(subject string, handler interface{}) error {
+	return m.subscribe(subject, "", handler)
+}
+
+func (m *MemoryClient) QueueSubscribe(subject, queue string, handler interface{}) error {
+	return m.subscribe(subject, queue, handler)
+}
+
+func (m *MemoryClient) subscribe(subject, queue string, handler interface{}) error {
+	h, err := newTypedHandler(handler, m.codec)
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	select {
+	case <-m.done:
+		return ErrBrokerClosed
+	default:
+	}
+
+	s, ok := m.subjects[subject]
+	if !ok {
+		s = &memorySubject{
+			queue:  make(chan *memoryMessage, m.size),
+			groups: make(map[string]*memoryQueueGroup),
+		}
+		m.subjects[subject] = s
+		m.wg.Add(1)
+		go m.dispatch(s)
+	}
+
+	s.lock.Lock()
+	if queue == "" {
+		s.handlers = append(s.handlers, h)
+	} else {
+		g, ok := s.groups[queue]
+		if !ok {
+			g = &memoryQueueGroup{}
+			s.groups[queue] = g
+		}
+		g.handlers = append(g.handlers, h)
+	}
+	s.lock.Unlock()
+
+	return nil
+}
+
+func (m *MemoryClient) dispatch(s *memorySubject) {
+	defer m.wg.Done()
+	lg := log.With().Str("comp", "broker").Logger()
+
+	for {
+		select {
+		case msg := <-s.queue:
+			for _, h := range s.receivers() {
+				if err := h.call(msg.subject, msg.data); err != nil {
+					lg.Error().Err(err).Str("subject", msg.subject).Msg("handler returned an error")
+				}
+			}
+		case <-m.done:
+			return
+		}
+	}
+}
+
+func (m *MemoryClient) Close() {
+	m.lock.Lock()
+	select {
+	case <-m.done:
+	default:
+		close(m.done)
+	}
+	m.lock.Unlock()
+
+	m.wg.Wait()
+}
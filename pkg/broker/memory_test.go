@@ -0,0 +1,96 @@
+package broker
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/mswkn/bot"
+	"gitlab.com/mswkn/bot/pkg/config"
+	"testing"
+	"time"
+)
+
+func TestMemoryClient(t *testing.T) {
+	conf := config.Config{}
+	conf.Queue.Memory.Size = 2
+	msg := NewMemoryClient(conf)
+	defer msg.Close()
+
+	received := make(chan *mswkn.SecuritiesRequest, 3)
+	err := msg.Subscribe(mswkn.BrokerSubjectSecuritiesRequest, func(sr *mswkn.SecuritiesRequest) {
+		received <- sr
+	})
+	assert.NoError(t, err)
+
+	subjects := make(chan string, 3)
+	err = msg.Subscribe(mswkn.BrokerSubjectSecuritiesRequest, func(subject string, sr mswkn.SecuritiesRequest) {
+		subjects <- subject
+	})
+	assert.NoError(t, err)
+
+	for _, name := range []string{"a", "b", "c"} {
+		sr := &mswkn.SecuritiesRequest{Name: name, WKNs: []string{"AABBCC"}}
+		assert.NoError(t, msg.Publish(mswkn.BrokerSubjectSecuritiesRequest, sr))
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		select {
+		case sr := <-received:
+			assert.Equal(t, name, sr.Name)
+			assert.Equal(t, []string{"AABBCC"}, sr.WKNs)
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for message")
+		}
+		select {
+		case subject := <-subjects:
+			assert.Equal(t, mswkn.BrokerSubjectSecuritiesRequest, subject)
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for message")
+		}
+	}
+
+	assert.NoError(t, msg.Publish("no.subscribers", &mswkn.SecuritiesRequest{}))
+}
+
+func TestMemoryClientClosed(t *testing.T) {
+	msg := NewMemoryClient(config.Config{})
+	msg.Close()
+
+	assert.Equal(t, ErrBrokerClosed, msg.Publish(mswkn.BrokerSubjectWKNRequest, &mswkn.RedditRequest{}))
+	assert.Equal(t, ErrBrokerClosed, msg.Subscribe(mswkn.BrokerSubjectWKNRequest, func(*mswkn.RedditRequest) {}))
+}
+
+func TestMemoryClientQueueSubscribe(t *testing.T) {
+	conf := config.Config{}
+	conf.Queue.Memory.Size = 10
+	msg := NewMemoryClient(conf)
+	defer msg.Close()
+
+	received := make(chan string, 10)
+	for _, worker := range []string{"w1", "w2"} {
+		worker := worker
+		err := msg.QueueSubscribe(mswkn.BrokerSubjectWKNRequest, mswkn.BrokerQueueScanner, func(rr *mswkn.RedditRequest) {
+			received <- worker
+		})
+		assert.NoError(t, err)
+	}
+
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, msg.Publish(mswkn.BrokerSubjectWKNRequest, &mswkn.RedditRequest{Name: "foo"}))
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		select {
+		case worker := <-received:
+			counts[worker]++
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for message")
+		}
+	}
+	assert.Equal(t, map[string]int{"w1": 2, "w2": 2}, counts)
+
+	select {
+	case <-received:
+		t.Fatal("message was delivered to more than one queue subscriber")
+	case <-time.After(time.Millisecond * 50):
+	}
+}
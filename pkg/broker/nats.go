@@ -18,6 +18,29 @@ type NatsClient struct {
 func NewNatsClient(conf config.Config, cancel context.CancelFunc) mswkn.Broker {
 	lg := log.With().Str("comp", "broker").Logger()
 
+	codec, err := NewCodec(conf.Queue.Codec)
+	if err != nil {
+		lg.Fatal().Err(err).Msg("could not create codec")
+	}
+
+	nc := connect(conf, cancel)
+
+	ec, err := nats.NewEncodedConn(nc, registerNatsEncoder(codec))
+	if err != nil {
+		lg.Fatal().Err(err).Str("codec", codec.Name()).Msg("could not create encoded connection")
+	}
+
+	n := &NatsClient{
+		nc:     nc,
+		client: ec,
+	}
+
+	return n
+}
+
+func connect(conf config.Config, cancel context.CancelFunc) *nats.Conn {
+	lg := log.With().Str("comp", "broker").Logger()
+
 	opts := make([]nats.Option, 0)
 	opts = append(opts, nats.UserInfo(conf.Queue.Nats.Username, conf.Queue.Nats.Password))
 	opts = append(opts, nats.RetryOnFailedConnect(true))
@@ -42,17 +65,7 @@ func NewNatsClient(conf config.Config, cancel context.CancelFunc) mswkn.Broker {
 		lg.Fatal().Err(err).Msg("could not initialize nats connection")
 	}
 
-	ec, err := nats.NewEncodedConn(nc, nats.JSON_ENCODER)
-	if err != nil {
-		lg.Fatal().Err(err).Msg("could not create json connection")
-	}
-
-	n := &NatsClient{
-		nc:     nc,
-		client: ec,
-	}
-
-	return n
+	return nc
 }
 
 func (n *NatsClient) Publish(subject string, v interface{}) error {
@@ -64,6 +77,11 @@ func (n *NatsClient) Subscribe(subject string, handler interface{}) error {
 	return err
 }
 
+func (n *NatsClient) QueueSubscribe(subject, queue string, handler interface{}) error {
+	_, err := n.client.QueueSubscribe(subject, queue, handler)
+	return err
+}
+
 func (n *NatsClient) Close() {
 	n.client.Close()
 	n.nc.Close()
@@ -0,0 +1,112 @@
+package broker
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/rs/zerolog/log"
+	"gitlab.com/mswkn/bot"
+	"gitlab.com/mswkn/bot/pkg/config"
+	"time"
+)
+
+//RetryClient wraps a broker and calls failing handlers again with an increasing delay.
+//Messages which exhausted all attempts are published to BrokerSubjectDeadLetterPrefix + subject.
+//The JetStream client is not wrapped, it redelivers failed messages itself.
+type RetryClient struct {
+	mswkn.Broker
+	codec    Codec
+	attempts int
+	backoff  time.Duration
+}
+
+func NewRetryClient(msg mswkn.Broker, conf config.Config) mswkn.Broker {
+	attempts := conf.Queue.Retry.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	codec, err := NewCodec(conf.Queue.Codec)
+	if err != nil {
+		log.Fatal().Err(err).Str("comp", "broker").Msg("could not create codec")
+	}
+
+	r := &RetryClient{
+		Broker:   msg,
+		codec:    codec,
+		attempts: attempts,
+		backoff:  conf.Queue.Retry.Backoff,
+	}
+	return r
+}
+
+func (r *RetryClient) Subscribe(subject string, handler interface{}) error {
+	wrapped, err := r.wrap(handler)
+	if err != nil {
+		return err
+	}
+	return r.Broker.Subscribe(subject, wrapped)
+}
+
+func (r *RetryClient) QueueSubscribe(subject, queue string, handler interface{}) error {
+	wrapped, err := r.wrap(handler)
+	if err != nil {
+		return err
+	}
+	return r.Broker.QueueSubscribe(subject, queue, wrapped)
+}
+
+//wrap lets the underlying broker decode into a RawMessage, so the original payload is still available for the dead letter
+func (r *RetryClient) wrap(handler interface{}) (func(subject string, payload *RawMessage) error, error) {
+	h, err := newTypedHandler(handler, r.codec)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(subject string, payload *RawMessage) error {
+		lg := log.With().Str("comp", "broker").Str("subject", subject).Logger()
+
+		attempt := 0
+		for {
+			attempt++
+			err := h.call(subject, *payload)
+			if err == nil {
+				return nil
+			}
+
+			if attempt >= r.attempts || errors.Is(err, ErrDecode) {
+				lg.Error().Err(err).Int("attempts", attempt).Msg("handler failed, sending message to dead letter subject")
+				return r.deadLetter(subject, *payload, err, attempt)
+			}
+
+			delay := r.backoff * time.Duration(1<<(attempt-1))
+			lg.Warn().Err(err).Int("attempt", attempt).Dur("delay", delay).Msg("handler failed, retrying")
+			time.Sleep(delay)
+		}
+	}, nil
+}
+
+func (r *RetryClient) deadLetter(subject string, payload RawMessage, err error, attempts int) error {
+	return r.Broker.Publish(mswkn.BrokerSubjectDeadLetterPrefix+subject, newDeadLetter(subject, payload, r.codec, err, attempts))
+}
+
+//newDeadLetter wraps the original payload of a message which could not be handled
+func newDeadLetter(subject string, payload []byte, codec Codec, err error, attempts int) *mswkn.DeadLetter {
+	return &mswkn.DeadLetter{
+		ID:       newDeadLetterID(),
+		Subject:  subject,
+		Payload:  payload,
+		Codec:    codec.Name(),
+		Error:    err.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now(),
+	}
+}
+
+func newDeadLetterID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
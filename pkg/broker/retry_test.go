@@ -0,0 +1,66 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/mswkn/bot"
+	"gitlab.com/mswkn/bot/pkg/config"
+	"testing"
+	"time"
+)
+
+func TestRetryClient(t *testing.T) {
+	conf := config.Config{}
+	conf.Queue.Memory.Size = 10
+	conf.Queue.Retry.Attempts = 3
+	conf.Queue.Retry.Backoff = time.Millisecond
+	msg := NewRetryClient(NewMemoryClient(conf), conf)
+	defer msg.Close()
+
+	deadLetters := make(chan *mswkn.DeadLetter, 2)
+	err := msg.Subscribe(mswkn.BrokerSubjectDeadLetterPrefix+mswkn.BrokerSubjectRedditRepplyRequest, func(dl *mswkn.DeadLetter) {
+		deadLetters <- dl
+	})
+	assert.NoError(t, err)
+
+	calls := make(map[string]int)
+	done := make(chan string, 2)
+	err = msg.QueueSubscribe(mswkn.BrokerSubjectRedditRepplyRequest, mswkn.BrokerQueueResponder, func(rrr *mswkn.RedditReplyRequest) error {
+		calls[rrr.Name]++
+		if rrr.Name == "flaky" && calls[rrr.Name] < 3 {
+			return errors.New("flaky")
+		}
+		if rrr.Name == "broken" {
+			return errors.New("broken")
+		}
+		done <- rrr.Name
+		return nil
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, msg.Publish(mswkn.BrokerSubjectRedditRepplyRequest, &mswkn.RedditReplyRequest{Name: "flaky"}))
+	assert.NoError(t, msg.Publish(mswkn.BrokerSubjectRedditRepplyRequest, &mswkn.RedditReplyRequest{Name: "broken"}))
+
+	select {
+	case name := <-done:
+		assert.Equal(t, "flaky", name)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for retried message")
+	}
+
+	select {
+	case dl := <-deadLetters:
+		assert.Equal(t, mswkn.BrokerSubjectRedditRepplyRequest, dl.Subject)
+		assert.Equal(t, "broken", dl.Error)
+		assert.Equal(t, 3, dl.Attempts)
+		assert.NotEmpty(t, dl.ID)
+
+		assert.Equal(t, CodecJSON, dl.Codec)
+		var rrr mswkn.RedditReplyRequest
+		assert.NoError(t, json.Unmarshal(dl.Payload, &rrr))
+		assert.Equal(t, "broken", rrr.Name)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for dead letter")
+	}
+}
@@ -4,16 +4,44 @@ import (
 	"fmt"
 	"github.com/rs/zerolog/log"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
+const (
+	ServiceUpdater     = "updater"
+	ServiceListener    = "listener"
+	ServiceScanner     = "scanner"
+	ServiceSecurities  = "securities"
+	ServiceInfoLinks   = "infolinks"
+	ServiceResponder   = "responder"
+	ServiceHTTP        = "http"
+	ServiceDeadLetters = "deadletters"
+)
+
+//AllServices lists every component of the bot, it is the default for SERVICES
+var AllServices = []string{
+	ServiceUpdater,
+	ServiceListener,
+	ServiceScanner,
+	ServiceSecurities,
+	ServiceInfoLinks,
+	ServiceResponder,
+	ServiceHTTP,
+	ServiceDeadLetters,
+}
+
 type Config struct {
 	Version  string
 	LogLevel string
 	LogMode  string
 	Mode     string
 
+	//Services contains the components started by this process
+	Services []string
+
 	Queue struct {
 		Memory struct {
 			Enabled bool
@@ -24,7 +52,20 @@ type Config struct {
 			Port     int
 			Username string
 			Password string
+
+			JetStream struct {
+				Enabled    bool
+				Stream     string
+				MaxDeliver int
+				Backoff    time.Duration
+			}
+		}
+		Retry struct {
+			Attempts int
+			Backoff  time.Duration
 		}
+		//Codec is the wire format of messages, json or protobuf with the messages of broker.proto
+		Codec string
 	}
 
 	Reddit struct {
@@ -34,6 +75,24 @@ type Config struct {
 		Username     string
 		Password     string
 		SubReddits   []string
+		//PostSubReddits are the subreddits where submissions are scanned as well
+		PostSubReddits []string
+		//Mentions enables answering username mentions from any subreddit
+		Mentions bool
+		//Messages enables answering private messages
+		Messages bool
+		//EditCheckInterval is the interval answered comments are checked for edits, zero disables the check
+		EditCheckInterval time.Duration
+		//EditCheckWindow is the time after the last reply in which edits are picked up
+		EditCheckWindow time.Duration
+		//DeleteCommand enables deleting replies by answering them with !delete
+		DeleteCommand bool
+		//ScoreCheckInterval is the interval the scores of recent replies are checked, zero disables the check
+		ScoreCheckInterval time.Duration
+		//ScoreCheckWindow is the time after the last reply in which its score is checked
+		ScoreCheckWindow time.Duration
+		//ScoreThreshold is the score at or below which a reply is deleted
+		ScoreThreshold int
 	}
 	Database struct {
 		Memory struct {
@@ -50,6 +109,27 @@ type Config struct {
 	}
 	Data struct {
 		XetraCSV string
+		//AliasFile is a mapping file of tickers and names to WKNs, see data.ParseAliasFile
+		AliasFile string
+	}
+	Tracing struct {
+		Exporter     string
+		OTLPEndpoint string
+		OTLPInsecure bool
+	}
+	Scan struct {
+		//Default is used for subreddits without own configuration, mentions and private messages
+		Default ScanConfig
+		//SubReddits contains the configuration per subreddit, the keys are lower case
+		SubReddits map[string]ScanConfig
+	}
+	Responder struct {
+		//TemplateDir contains the template sets overriding the built-in reply templates, empty means built-in only
+		TemplateDir string
+		//TemplateReloadInterval is the interval to check the templates for changes, zero disables the reload
+		TemplateReloadInterval time.Duration
+		//QueueMaxAttempts is the number of sends of a queued reply before it is dropped, rate limits are not counted
+		QueueMaxAttempts int
 	}
 	HTTPServer struct {
 		Port              int
@@ -69,6 +149,9 @@ func LoadConfigFromEnv(version string) Config {
 
 	c.Mode = fromEnvStr("MODE", "prod")
 
+	c.Services = ParseServices(fromEnvStr("SERVICES", strings.Join(AllServices, ",")))
+
+	c.Queue.Memory.Enabled = fromEnvBool("QUEUE_MEMORY_ENABLED", false)
 	c.Queue.Memory.Size = fromEnvInt("QUEUE_LENGTH", 20)
 
 	c.Reddit.Agent = fromEnvStr("REDDIT_AGENT", "")
@@ -76,13 +159,45 @@ func LoadConfigFromEnv(version string) Config {
 	c.Reddit.ClientSecret = fromEnvStr("REDDIT_CLIENT_SECRET", "")
 	c.Reddit.Username = fromEnvStr("REDDIT_USERNAME", "")
 	c.Reddit.Password = fromEnvStr("REDDIT_PASSWORD", "")
-	subs := fromEnvStr("REDDIT_SUBREDDITS", "")
-	c.Reddit.SubReddits = strings.Split(subs, ",")
+	c.Reddit.SubReddits = fromEnvList("REDDIT_SUBREDDITS", "")
+	c.Reddit.PostSubReddits = fromEnvList("REDDIT_SUBREDDITS_POSTS", "")
+	c.Reddit.Mentions = fromEnvBool("REDDIT_MENTIONS", false)
+	c.Reddit.Messages = fromEnvBool("REDDIT_MESSAGES", false)
+	c.Reddit.EditCheckInterval = fromEnvDuration("REDDIT_EDIT_CHECK_INTERVAL", time.Minute*2)
+	c.Reddit.EditCheckWindow = fromEnvDuration("REDDIT_EDIT_CHECK_WINDOW", time.Hour*24)
+	c.Reddit.DeleteCommand = fromEnvBool("REDDIT_DELETE_COMMAND", true)
+	c.Reddit.ScoreCheckInterval = fromEnvDuration("REDDIT_SCORE_CHECK_INTERVAL", time.Minute*10)
+	c.Reddit.ScoreCheckWindow = fromEnvDuration("REDDIT_SCORE_CHECK_WINDOW", time.Hour*24)
+	c.Reddit.ScoreThreshold = fromEnvInt("REDDIT_SCORE_THRESHOLD", -3)
+
+	c.Scan.Default = scanConfigFromEnv("SCAN_", ScanConfig{
+		Keywords:   []string{"$WKN"},
+		Strategies: []string{"keyword", "dollar"},
+		MaxWKNs:    0,
+
+		Tickers:             true,
+		TickerMinConfidence: 0.7,
+
+		Language: "de",
+	})
+	c.Scan.SubReddits = make(map[string]ScanConfig)
+	for _, sr := range fromEnvList("SCAN_SUBREDDITS", "") {
+		c.Scan.SubReddits[strings.ToLower(sr)] = scanConfigFromEnv("SCAN_"+strings.ToUpper(sr)+"_", c.Scan.Default)
+	}
 
 	c.Queue.Nats.Host = fromEnvStr("QUEUE_NATS_HOST", "localhost")
 	c.Queue.Nats.Port = fromEnvInt("QUEUE_NATS_PORT", 4222)
 	c.Queue.Nats.Username = fromEnvStr("QUEUE_NATS_USERNAME", "mswkn")
 	c.Queue.Nats.Password = fromEnvStr("QUEUE_NATS_PASSWORD", "mswkn")
+	c.Queue.Nats.JetStream.Enabled = fromEnvBool("QUEUE_NATS_JETSTREAM_ENABLED", false)
+	c.Queue.Nats.JetStream.Stream = fromEnvStr("QUEUE_NATS_JETSTREAM_STREAM", "MSWKN")
+	c.Queue.Nats.JetStream.MaxDeliver = fromEnvInt("QUEUE_NATS_JETSTREAM_MAX_DELIVER", 10)
+	c.Queue.Nats.JetStream.Backoff = fromEnvDuration("QUEUE_NATS_JETSTREAM_BACKOFF", time.Second)
+
+	c.Queue.Codec = fromEnvStr("QUEUE_CODEC", "json")
+
+	c.Queue.Retry.Attempts = fromEnvInt("QUEUE_RETRY_ATTEMPTS", 3)
+	c.Queue.Retry.Backoff = fromEnvDuration("QUEUE_RETRY_BACKOFF", time.Millisecond*500)
 
 	c.Database.Memory.Enabled = fromEnvBool("DATABASE_MEMORY_ENABLED", true)
 	c.Database.Pg.Enabled = fromEnvBool("DATABASE_PG_ENABLED", false)
@@ -93,6 +208,15 @@ func LoadConfigFromEnv(version string) Config {
 	c.Database.Pg.Password = fromEnvStr("DATABASE_PG_PASSWORD", "mswkn")
 
 	c.Data.XetraCSV = fromEnvStr("DATA_XETRA_CSV", "")
+	c.Data.AliasFile = fromEnvStr("DATA_ALIAS_FILE", "")
+
+	c.Tracing.Exporter = fromEnvStr("TRACING_EXPORTER", "none")
+	c.Tracing.OTLPEndpoint = fromEnvStr("TRACING_OTLP_ENDPOINT", "localhost:4318")
+	c.Tracing.OTLPInsecure = fromEnvBool("TRACING_OTLP_INSECURE", true)
+
+	c.Responder.TemplateDir = fromEnvStr("RESPONDER_TEMPLATE_DIR", "")
+	c.Responder.TemplateReloadInterval = fromEnvDuration("RESPONDER_TEMPLATE_RELOAD_INTERVAL", time.Second*30)
+	c.Responder.QueueMaxAttempts = fromEnvInt("RESPONDER_QUEUE_MAX_ATTEMPTS", 5)
 
 	c.HTTPServer.Port = fromEnvInt("HTTP_SERVER_PORT", 3000)
 	c.HTTPServer.BasicAuthDisabled = fromEnvBool("HTTP_SERVER_AUTH_DISABLED", false)
@@ -106,6 +230,115 @@ func LoadConfigFromEnv(version string) Config {
 	return c
 }
 
+//ScanConfig configures how the scanner finds WKNs in a comment
+type ScanConfig struct {
+	//Keywords are followed by a WKN, e.g. $WKN A1B2C3
+	Keywords []string
+	//Strategies are the names of the registered scanner strategies, e.g. keyword, dollar or full
+	Strategies []string
+	//MaxWKNs limits the WKNs per comment, zero means the hard limit of the scanner
+	MaxWKNs int
+	//Tickers enables resolving tickers and names like $TSLA with the alias dictionary
+	Tickers bool
+	//TickerMinConfidence is the minimum confidence of an alias to be resolved, between 0 and 1
+	TickerMinConfidence float64
+	//Language of the replies, de or en. auto detects it from the comment and falls back to de.
+	Language string
+	//Template is the name of the reply template set, empty means the default set
+	Template string
+}
+
+//ScanConfigFor returns the scanner configuration of a subreddit
+func (c Config) ScanConfigFor(subreddit string) ScanConfig {
+	if sc, ok := c.Scan.SubReddits[strings.ToLower(subreddit)]; ok {
+		return sc
+	}
+	return c.Scan.Default
+}
+
+//TemplateSets returns the sorted names of the configured reply template sets
+func (c Config) TemplateSets() []string {
+	seen := map[string]bool{"": true}
+	sets := make([]string, 0)
+	for _, sc := range c.Scan.SubReddits {
+		if !seen[sc.Template] {
+			seen[sc.Template] = true
+			sets = append(sets, sc.Template)
+		}
+	}
+	if !seen[c.Scan.Default.Template] {
+		sets = append(sets, c.Scan.Default.Template)
+	}
+	sort.Strings(sets)
+	return sets
+}
+
+//scanConfigFromEnv reads a scanner configuration from variables with the given prefix, e.g. SCAN_KEYWORDS
+func scanConfigFromEnv(prefix string, fallback ScanConfig) ScanConfig {
+	sc := ScanConfig{
+		Keywords:   fromEnvList(prefix+"KEYWORDS", strings.Join(fallback.Keywords, ",")),
+		Strategies: fromEnvList(prefix+"STRATEGIES", strings.Join(fallback.Strategies, ",")),
+		MaxWKNs:    fromEnvInt(prefix+"MAX_WKNS", fallback.MaxWKNs),
+
+		Tickers:             fromEnvBool(prefix+"TICKERS", fallback.Tickers),
+		TickerMinConfidence: fromEnvFloat(prefix+"TICKER_MIN_CONFIDENCE", fallback.TickerMinConfidence),
+
+		Language: strings.ToLower(fromEnvStr(prefix+"LANGUAGE", fallback.Language)),
+		Template: fromEnvStr(prefix+"TEMPLATE", fallback.Template),
+	}
+	for i, kw := range sc.Keywords {
+		sc.Keywords[i] = strings.ToUpper(kw)
+	}
+	return sc
+}
+
+//ServiceEnabled reports if the component with the given name should be started
+func (c Config) ServiceEnabled(name string) bool {
+	for _, s := range c.Services {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+//AllServicesEnabled reports if every component runs in this process, duplicates in SERVICES are ignored
+func (c Config) AllServicesEnabled() bool {
+	for _, s := range AllServices {
+		if !c.ServiceEnabled(s) {
+			return false
+		}
+	}
+	return true
+}
+
+//ParseServices parses a comma separated list of service names, it panics on unknown names
+func ParseServices(val string) []string {
+	services := make([]string, 0)
+	for _, s := range strings.Split(val, ",") {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "" {
+			continue
+		}
+		if s == "all" {
+			return AllServices
+		}
+
+		known := false
+		for _, a := range AllServices {
+			if s == a {
+				known = true
+				break
+			}
+		}
+		if !known {
+			panic(fmt.Sprintf("unknown service '%s' in SERVICES, valid values are all,%s", s, strings.Join(AllServices, ",")))
+		}
+		services = append(services, s)
+	}
+	return services
+}
+
 func fromEnvStr(name, fallback string) string {
 	val, isSet := os.LookupEnv(name)
 	//	log.Printf("name [%s] val [%s] isset[%s]", name, val, isSet)
@@ -115,6 +348,18 @@ func fromEnvStr(name, fallback string) string {
 	return val
 }
 
+//fromEnvList splits a comma separated value, empty entries are dropped
+func fromEnvList(name, fallback string) []string {
+	list := make([]string, 0)
+	for _, val := range strings.Split(fromEnvStr(name, fallback), ",") {
+		val = strings.TrimSpace(val)
+		if val != "" {
+			list = append(list, val)
+		}
+	}
+	return list
+}
+
 func fromEnvInt(name string, fallback int) int {
 	val, isSet := os.LookupEnv(name)
 	//	log.Printf("name [%s] val [%s] isset[%s]", name, val, isSet)
@@ -128,6 +373,18 @@ func fromEnvInt(name string, fallback int) int {
 	return intVal
 }
 
+func fromEnvFloat(name string, fallback float64) float64 {
+	val, isSet := os.LookupEnv(name)
+	if !isSet {
+		return fallback
+	}
+	floatVal, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		panic(fmt.Sprintf("the value '%s' could not be parsed to a float value for %s", val, name))
+	}
+	return floatVal
+}
+
 func fromEnvBool(name string, fallback bool) bool {
 	val, isSet := os.LookupEnv(name)
 	if !isSet {
@@ -145,19 +402,18 @@ func fromEnvBool(name string, fallback bool) bool {
 	return false
 }
 
-//
-//func fromEnvDuration(name string, fallback time.Duration) time.Duration {
-//	val, isSet := os.LookupEnv(name)
-//
-//	if !isSet {
-//		return fallback
-//	}
-//
-//	d, err := time.ParseDuration(val)
-//	if err != nil {
-//		log.Warn().Str("value", val).Msg("could not parse env value to time.Duration")
-//		return fallback
-//	}
-//
-//	return d
-//}
+func fromEnvDuration(name string, fallback time.Duration) time.Duration {
+	val, isSet := os.LookupEnv(name)
+
+	if !isSet {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		log.Warn().Str("value", val).Msg("could not parse env value to time.Duration")
+		return fallback
+	}
+
+	return d
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestConfig_AllServicesEnabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		services string
+		want     bool
+	}{
+		{"all", "all", true},
+		{"every service", "listener,scanner,securities,infolinks,responder,updater,deadletters,http", true},
+		{"missing service", "listener,scanner,securities,infolinks,responder,updater,deadletters", false},
+		{"duplicates", "listener,listener,scanner,securities,infolinks,responder,updater,deadletters,http", true},
+		{"duplicate instead of missing service", "listener,listener,scanner,securities,infolinks,responder,updater,http", false},
+		{"none", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{Services: ParseServices(tt.services)}
+			assert.Equal(t, tt.want, c.AllServicesEnabled())
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package data
+
+import (
+	"encoding/csv"
+	"fmt"
+	"gitlab.com/mswkn/bot"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//xetraAliasConfidence is lower than the default of mapping files because mnemonics are often common words
+const xetraAliasConfidence = 0.8
+
+//fileAliasConfidence is used for mapping file lines without confidence
+const fileAliasConfidence = 1.0
+
+//xetraAlias returns the alias of the mnemonic of stocks and ETFs, other securities have no meaningful mnemonic
+func xetraAlias(sec *mswkn.Security) *mswkn.Alias {
+	if sec.Ticker == "" || sec.WKN == "" {
+		return nil
+	}
+	if sec.Type != mswkn.SecurityTypeCommonStock && sec.Type != mswkn.SecurityTypeExchangeTradedFund {
+		return nil
+	}
+	return &mswkn.Alias{
+		Alias:      mswkn.NormalizeAlias(sec.Ticker),
+		WKN:        sec.WKN,
+		Source:     mswkn.AliasSourceXetra,
+		Confidence: xetraAliasConfidence,
+	}
+}
+
+//ParseAliasFile reads a mapping file with lines like "TSLA;A1CX3T" or "Deutsche Bank;514000;0.9".
+//The optional third column is the confidence, lines starting with # are comments.
+func ParseAliasFile(r io.Reader) ([]*mswkn.Alias, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = ';'
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	aliases := make([]*mswkn.Alias, 0)
+	for {
+		line, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		row, _ := reader.FieldPos(0)
+		if len(line) < 2 || len(line) > 3 {
+			return nil, fmt.Errorf("line %d: expected 2 or 3 fields, got %d", row, len(line))
+		}
+
+		alias := &mswkn.Alias{
+			Alias:      mswkn.NormalizeAlias(line[0]),
+			WKN:        strings.ToUpper(strings.TrimSpace(line[1])),
+			Source:     mswkn.AliasSourceFile,
+			Confidence: fileAliasConfidence,
+		}
+		if alias.Alias == "" || len(alias.WKN) != 6 {
+			return nil, fmt.Errorf("line %d: invalid alias %q or wkn %q", row, line[0], line[1])
+		}
+		if len(line) == 3 {
+			c, err := strconv.ParseFloat(strings.TrimSpace(line[2]), 64)
+			if err != nil || c < 0 || c > 1 {
+				return nil, fmt.Errorf("line %d: confidence must be between 0 and 1: %q", row, line[2])
+			}
+			alias.Confidence = c
+		}
+		aliases = append(aliases, alias)
+	}
+	return aliases, nil
+}
@@ -0,0 +1,61 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/mswkn/bot"
+	"strings"
+	"testing"
+)
+
+func TestParseAliasFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		want    []*mswkn.Alias
+		wantErr string
+	}{
+		{
+			name: "valid",
+			file: "# ticker;wkn;confidence\nTSLA;A1CX3T\nDeutsche  Bank; 514000;0.9\n",
+			want: []*mswkn.Alias{
+				{Alias: "TSLA", WKN: "A1CX3T", Source: mswkn.AliasSourceFile, Confidence: 1},
+				{Alias: "DEUTSCHE BANK", WKN: "514000", Source: mswkn.AliasSourceFile, Confidence: 0.9},
+			},
+		},
+		{
+			name:    "missing wkn",
+			file:    "TSLA;A1CX3T\nSAP\n",
+			wantErr: "line 2: expected 2 or 3 fields, got 1",
+		},
+		{
+			name:    "invalid wkn",
+			file:    "TSLA;A1CX3",
+			wantErr: `line 1: invalid alias "TSLA" or wkn "A1CX3"`,
+		},
+		{
+			name:    "invalid confidence",
+			file:    "TSLA;A1CX3T;2",
+			wantErr: `line 1: confidence must be between 0 and 1: "2"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAliasFile(strings.NewReader(tt.file))
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestXetraAlias(t *testing.T) {
+	assert.Equal(t,
+		&mswkn.Alias{Alias: "SAP", WKN: "716460", Source: mswkn.AliasSourceXetra, Confidence: xetraAliasConfidence},
+		xetraAlias(&mswkn.Security{WKN: "716460", Ticker: "SAP", Type: mswkn.SecurityTypeCommonStock}),
+	)
+	assert.Nil(t, xetraAlias(&mswkn.Security{WKN: "TT6DHP", Ticker: "TT6D", Type: mswkn.SecurityTypeWarrant}))
+	assert.Nil(t, xetraAlias(&mswkn.Security{WKN: "716460", Type: mswkn.SecurityTypeCommonStock}))
+}
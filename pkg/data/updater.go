@@ -15,15 +15,17 @@ import (
 
 type Updater struct {
 	repo           mswkn.SecurityRepository
+	aliasRepo      mswkn.AliasRepository
 	conf           config.Config
 	bulkUpdateSize int
 	limiter        ratelimit.Limiter
 }
 
-func NewUpdater(conf config.Config, repo mswkn.SecurityRepository, bulkUpdateSize int) *Updater {
+func NewUpdater(conf config.Config, repo mswkn.SecurityRepository, aliasRepo mswkn.AliasRepository, bulkUpdateSize int) *Updater {
 	u := &Updater{
 		conf:           conf,
 		repo:           repo,
+		aliasRepo:      aliasRepo,
 		bulkUpdateSize: bulkUpdateSize,
 		limiter:        ratelimit.New(1, ratelimit.Per(15*time.Minute)),
 	}
@@ -72,6 +74,10 @@ func (u *Updater) runUpdate(ctx context.Context, lg zerolog.Logger) {
 		LastUpdated: time.Now(),
 	}
 
+	if err := u.UpdateAliasFile(ctx); err != nil {
+		lg.Error().Err(err).Str("file", u.conf.Data.AliasFile).Msg("could not import alias file")
+	}
+
 	if err := u.UpdateXetraFiles(ctx); err != nil {
 		instrumenting.Status.SetDataUpdateStatus(status)
 		lg.Error().Err(err).Msg("could not update xetra data")
@@ -82,6 +88,39 @@ func (u *Updater) runUpdate(ctx context.Context, lg zerolog.Logger) {
 	instrumenting.Status.SetDataUpdateStatus(status)
 }
 
+//UpdateAliasFile imports the configured alias mapping file, it does nothing without a file
+func (u *Updater) UpdateAliasFile(ctx context.Context) error {
+	if u.conf.Data.AliasFile == "" {
+		return nil
+	}
+
+	f, err := os.Open(u.conf.Data.AliasFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	aliases, err := ParseAliasFile(f)
+	if err != nil {
+		return err
+	}
+	if err := u.aliasRepo.AddBulk(ctx, aliases); err != nil {
+		return err
+	}
+
+	log.Info().Str("comp", "updater").Int("count", len(aliases)).Msg("imported alias file")
+	return nil
+}
+
+//addAliases stores the aliases collected from the xetra data
+func (u *Updater) addAliases(ctx context.Context, lg zerolog.Logger, aliases []*mswkn.Alias) {
+	if err := u.aliasRepo.AddBulk(ctx, aliases); err != nil {
+		lg.Error().Err(err).Msg("could not add xetra aliases")
+		return
+	}
+	lg.Debug().Int("count", len(aliases)).Msg("added xetra aliases")
+}
+
 func (u *Updater) UpdateXetraFiles(ctx context.Context) error {
 	lg := log.With().Str("comp", "updater").Logger()
 	lg.Info().Msg("start updating xetra data")
@@ -127,6 +166,7 @@ func (u *Updater) UpdateXetraFiles(ctx context.Context) error {
 func (u *Updater) add(ctx context.Context, loaderErr chan error, secChan chan *mswkn.Security) error {
 	lg := log.With().Str("comp", "updater").Logger()
 
+	aliases := make([]*mswkn.Alias, 0)
 	for {
 		select {
 		case err := <-loaderErr:
@@ -134,9 +174,14 @@ func (u *Updater) add(ctx context.Context, loaderErr chan error, secChan chan *m
 		case s, ok := <-secChan:
 			if !ok {
 				log.Print("xetra update chan closed")
+				u.addAliases(ctx, lg, aliases)
 				return nil
 			}
 
+			if a := xetraAlias(s); a != nil {
+				aliases = append(aliases, a)
+			}
+
 			if err := u.repo.Add(ctx, s); err != nil {
 				lg.Error().
 					Err(err).
@@ -160,6 +205,7 @@ func (u *Updater) addBulk(ctx context.Context, loaderErr chan error, secChan cha
 	i := 0
 	bulk := u.bulkUpdateSize
 	list := make([]*mswkn.Security, 0, bulk)
+	aliases := make([]*mswkn.Alias, 0)
 	for {
 		select {
 		case err := <-loaderErr:
@@ -174,9 +220,14 @@ func (u *Updater) addBulk(ctx context.Context, loaderErr chan error, secChan cha
 					Int("bulk_count", len(list)).
 					Int("i", i).
 					Msg("added xetra securities")
+				u.addAliases(ctx, lg, aliases)
 				return nil
 			}
 
+			if a := xetraAlias(s); a != nil {
+				aliases = append(aliases, a)
+			}
+
 			if len(list) < bulk {
 				list = append(list, s)
 				i++
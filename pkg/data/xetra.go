@@ -22,6 +22,7 @@ import (
 const xetraInstrumentField = 2
 const xetraISINField = 3
 const xetraWKNField = 6
+const xetraMnemonicField = 7
 const xetraInstrumentTypeField = 18
 const xetraWarrantSubTypeField = 106
 const xetraUnderLyingField = 109
@@ -176,6 +177,7 @@ func ParseXetraCSV(csvFile io.Reader, secChan chan *mswkn.Security) error {
 			Underlying:     line[xetraUnderLyingField],
 			WarrantType:    warrantType,
 			WarrantSubType: warrantSubType,
+			Ticker:         strings.ToUpper(line[xetraMnemonicField]),
 		}
 
 		if s := line[xetraStrikePriceField]; s != "" {
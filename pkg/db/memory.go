@@ -3,21 +3,25 @@ package db
 import (
 	"context"
 	"gitlab.com/mswkn/bot"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 type MemorySecurityRepository struct {
-	//isinLookup map[string]*mswkn.Security
-	wknLookup map[string]*mswkn.Security
-	lock      sync.Mutex
+	isinLookup map[string]*mswkn.Security
+	wknLookup  map[string]*mswkn.Security
+	nameIndex  *invertedIndex
+	lock       sync.Mutex
 }
 
 func NewMemorySecurityRepository() mswkn.SecurityRepository {
 	m := &MemorySecurityRepository{
-		//	isinLookup: make(map[string]*mswkn.Security),
-		wknLookup: make(map[string]*mswkn.Security),
-		lock:      sync.Mutex{},
+		isinLookup: make(map[string]*mswkn.Security),
+		wknLookup:  make(map[string]*mswkn.Security),
+		nameIndex:  newInvertedIndex(),
+		lock:       sync.Mutex{},
 	}
 	return m
 }
@@ -26,8 +30,7 @@ func (m *MemorySecurityRepository) Add(ctx context.Context, sec *mswkn.Security)
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	//m.isinLookup[strings.ToUpper(sec.ISIN)] = sec
-	m.wknLookup[strings.ToUpper(sec.WKN)] = sec
+	m.add(sec)
 	return nil
 }
 
@@ -35,12 +38,22 @@ func (m *MemorySecurityRepository) AddBulk(ctx context.Context, secs []*mswkn.Se
 	m.lock.Lock()
 	defer m.lock.Unlock()
 	for _, sec := range secs {
-		//m.isinLookup[strings.ToUpper(sec.ISIN)] = sec
-		m.wknLookup[strings.ToUpper(sec.WKN)] = sec
+		m.add(sec)
 	}
 	return nil
 }
 
+//add stores a security in all lookups, the lock has to be held
+func (m *MemorySecurityRepository) add(sec *mswkn.Security) {
+	wkn := strings.ToUpper(sec.WKN)
+	if old, ok := m.wknLookup[wkn]; ok {
+		m.nameIndex.remove(wkn, old.Name)
+	}
+	m.isinLookup[strings.ToUpper(sec.ISIN)] = sec
+	m.wknLookup[wkn] = sec
+	m.nameIndex.add(wkn, sec.Name)
+}
+
 func (m *MemorySecurityRepository) Get(ctx context.Context, wkn string) (*mswkn.Security, error) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -51,6 +64,45 @@ func (m *MemorySecurityRepository) Get(ctx context.Context, wkn string) (*mswkn.
 	return sec, nil
 }
 
+func (m *MemorySecurityRepository) GetByISIN(ctx context.Context, isin string) (*mswkn.Security, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	sec, ok := m.isinLookup[strings.ToUpper(isin)]
+	if !ok {
+		return nil, mswkn.ErrSecurityNotFound
+	}
+	return sec, nil
+}
+
+func (m *MemorySecurityRepository) GetMany(ctx context.Context, wkns []string) (map[string]*mswkn.Security, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	secs := make(map[string]*mswkn.Security, len(wkns))
+	for _, wkn := range wkns {
+		wkn = strings.ToUpper(wkn)
+		if sec, ok := m.wknLookup[wkn]; ok {
+			secs[wkn] = sec
+		}
+	}
+	return secs, nil
+}
+
+func (m *MemorySecurityRepository) Search(ctx context.Context, query string, filters mswkn.SecuritySearchFilters) (*mswkn.SecuritySearchResult, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	filters = filters.Normalize()
+	matches := make([]scoredSecurity, 0)
+	for wkn, score := range m.nameIndex.search(query) {
+		sec, ok := m.wknLookup[wkn]
+		if !ok || !matchesFilters(sec, filters) {
+			continue
+		}
+		matches = append(matches, scoredSecurity{sec: sec, score: score})
+	}
+	return paginate(matches, filters), nil
+}
+
 type InfoLinkRepository struct {
 	list map[string]*mswkn.InfoLink
 	lock sync.Mutex
@@ -80,3 +132,304 @@ func (i *InfoLinkRepository) Get(ctx context.Context, wkn string) (*mswkn.InfoLi
 	}
 	return il, nil
 }
+
+type MemoryDeadLetterRepository struct {
+	list map[string]*mswkn.DeadLetter
+	lock sync.Mutex
+}
+
+func NewMemoryDeadLetterRepository() mswkn.DeadLetterRepository {
+	d := &MemoryDeadLetterRepository{
+		list: make(map[string]*mswkn.DeadLetter),
+		lock: sync.Mutex{},
+	}
+	return d
+}
+
+func (d *MemoryDeadLetterRepository) Add(ctx context.Context, dl *mswkn.DeadLetter) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.list[dl.ID] = dl
+	return nil
+}
+
+func (d *MemoryDeadLetterRepository) Get(ctx context.Context, id string) (*mswkn.DeadLetter, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	dl, ok := d.list[id]
+	if !ok {
+		return nil, mswkn.ErrDeadLetterNotFound
+	}
+	return dl, nil
+}
+
+func (d *MemoryDeadLetterRepository) List(ctx context.Context) ([]*mswkn.DeadLetter, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	dls := make([]*mswkn.DeadLetter, 0, len(d.list))
+	for _, dl := range d.list {
+		dls = append(dls, dl)
+	}
+	sort.Slice(dls, func(i, j int) bool {
+		return dls[i].FailedAt.Before(dls[j].FailedAt)
+	})
+	return dls, nil
+}
+
+func (d *MemoryDeadLetterRepository) Delete(ctx context.Context, id string) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, ok := d.list[id]; !ok {
+		return mswkn.ErrDeadLetterNotFound
+	}
+	delete(d.list, id)
+	return nil
+}
+
+type MemoryProcessedCommentRepository struct {
+	list map[string]*mswkn.ProcessedComment
+	//byReply maps the reply IDs to the names of the comments
+	byReply map[string]string
+	lock    sync.Mutex
+}
+
+func NewMemoryProcessedCommentRepository() mswkn.ProcessedCommentRepository {
+	p := &MemoryProcessedCommentRepository{
+		list:    make(map[string]*mswkn.ProcessedComment),
+		byReply: make(map[string]string),
+		lock:    sync.Mutex{},
+	}
+	return p
+}
+
+func (p *MemoryProcessedCommentRepository) Add(ctx context.Context, pc *mswkn.ProcessedComment) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, ok := p.list[pc.Name]; ok {
+		return mswkn.ErrProcessedCommentExists
+	}
+	c := *pc
+	p.list[pc.Name] = &c
+	p.indexReply(&c)
+	return nil
+}
+
+func (p *MemoryProcessedCommentRepository) Get(ctx context.Context, name string) (*mswkn.ProcessedComment, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	pc, ok := p.list[name]
+	if !ok {
+		return nil, mswkn.ErrProcessedCommentNotFound
+	}
+	c := *pc
+	return &c, nil
+}
+
+func (p *MemoryProcessedCommentRepository) GetByReply(ctx context.Context, replyID string) (*mswkn.ProcessedComment, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	pc, ok := p.list[p.byReply[replyID]]
+	if replyID == "" || !ok {
+		return nil, mswkn.ErrProcessedCommentNotFound
+	}
+	c := *pc
+	return &c, nil
+}
+
+func (p *MemoryProcessedCommentRepository) Update(ctx context.Context, pc *mswkn.ProcessedComment) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	stored, ok := p.list[pc.Name]
+	if !ok {
+		return mswkn.ErrProcessedCommentNotFound
+	}
+	p.unindexReply(stored)
+	stored.ReplyID = pc.ReplyID
+	stored.WKNs = pc.WKNs
+	stored.UpdatedAt = pc.UpdatedAt
+	p.indexReply(stored)
+	return nil
+}
+
+func (p *MemoryProcessedCommentRepository) List(ctx context.Context, since time.Time) ([]*mswkn.ProcessedComment, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	pcs := make([]*mswkn.ProcessedComment, 0)
+	for _, pc := range p.list {
+		if pc.UpdatedAt.Before(since) {
+			continue
+		}
+		c := *pc
+		pcs = append(pcs, &c)
+	}
+	sort.Slice(pcs, func(i, j int) bool {
+		return pcs[i].UpdatedAt.Before(pcs[j].UpdatedAt)
+	})
+	return pcs, nil
+}
+
+func (p *MemoryProcessedCommentRepository) Delete(ctx context.Context, name string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	pc, ok := p.list[name]
+	if !ok {
+		return mswkn.ErrProcessedCommentNotFound
+	}
+	p.unindexReply(pc)
+	delete(p.list, name)
+	return nil
+}
+
+func (p *MemoryProcessedCommentRepository) indexReply(pc *mswkn.ProcessedComment) {
+	if pc.ReplyID != "" {
+		p.byReply[pc.ReplyID] = pc.Name
+	}
+}
+
+func (p *MemoryProcessedCommentRepository) unindexReply(pc *mswkn.ProcessedComment) {
+	if p.byReply[pc.ReplyID] == pc.Name {
+		delete(p.byReply, pc.ReplyID)
+	}
+}
+
+type MemoryAliasRepository struct {
+	list map[string][]*mswkn.Alias
+	lock sync.RWMutex
+}
+
+func NewMemoryAliasRepository() mswkn.AliasRepository {
+	a := &MemoryAliasRepository{
+		list: make(map[string][]*mswkn.Alias),
+		lock: sync.RWMutex{},
+	}
+	return a
+}
+
+func (a *MemoryAliasRepository) AddBulk(ctx context.Context, aliases []*mswkn.Alias) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for _, alias := range aliases {
+		if stored := a.find(alias); stored != nil {
+			stored.Confidence = alias.Confidence
+			continue
+		}
+		c := *alias
+		a.list[alias.Alias] = append(a.list[alias.Alias], &c)
+	}
+	return nil
+}
+
+func (a *MemoryAliasRepository) find(alias *mswkn.Alias) *mswkn.Alias {
+	for _, stored := range a.list[alias.Alias] {
+		if stored.WKN == alias.WKN && stored.Source == alias.Source {
+			return stored
+		}
+	}
+	return nil
+}
+
+func (a *MemoryAliasRepository) GetMany(ctx context.Context, names []string) (map[string][]*mswkn.Alias, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	found := make(map[string][]*mswkn.Alias)
+	for _, name := range names {
+		for _, alias := range a.list[name] {
+			c := *alias
+			found[name] = append(found[name], &c)
+		}
+	}
+	return found, nil
+}
+
+type MemoryPendingReplyRepository struct {
+	list map[string]*mswkn.PendingReply
+	lock sync.Mutex
+}
+
+func NewMemoryPendingReplyRepository() mswkn.PendingReplyRepository {
+	p := &MemoryPendingReplyRepository{
+		list: make(map[string]*mswkn.PendingReply),
+		lock: sync.Mutex{},
+	}
+	return p
+}
+
+func (p *MemoryPendingReplyRepository) Add(ctx context.Context, pr *mswkn.PendingReply) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	c := *pr
+	p.list[pr.ID] = &c
+	return nil
+}
+
+func (p *MemoryPendingReplyRepository) Replace(ctx context.Context, pr *mswkn.PendingReply) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for id, stored := range p.list {
+		if stored.Name == pr.Name && (stored.Action == mswkn.PendingReplyActionEdit || stored.Action == mswkn.PendingReplyActionDelete) {
+			delete(p.list, id)
+		}
+	}
+	c := *pr
+	p.list[pr.ID] = &c
+	return nil
+}
+
+func (p *MemoryPendingReplyRepository) Claim(ctx context.Context, now time.Time, lease time.Duration) (*mswkn.PendingReply, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var next *mswkn.PendingReply
+	for _, pr := range p.list {
+		if pr.NotBefore.After(now) {
+			continue
+		}
+		if next == nil || pr.NotBefore.Before(next.NotBefore) ||
+			(pr.NotBefore.Equal(next.NotBefore) && pr.CreatedAt.Before(next.CreatedAt)) {
+			next = pr
+		}
+	}
+	if next == nil {
+		return nil, mswkn.ErrPendingReplyNotFound
+	}
+
+	c := *next
+	next.NotBefore = now.Add(lease)
+	return &c, nil
+}
+
+func (p *MemoryPendingReplyRepository) Update(ctx context.Context, pr *mswkn.PendingReply) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	stored, ok := p.list[pr.ID]
+	if !ok {
+		return mswkn.ErrPendingReplyNotFound
+	}
+	stored.Attempts = pr.Attempts
+	stored.NotBefore = pr.NotBefore
+	return nil
+}
+
+func (p *MemoryPendingReplyRepository) Delete(ctx context.Context, id string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, ok := p.list[id]; !ok {
+		return mswkn.ErrPendingReplyNotFound
+	}
+	delete(p.list, id)
+	return nil
+}
+
+func (p *MemoryPendingReplyRepository) Stats(ctx context.Context) (*mswkn.PendingReplyStats, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	stats := &mswkn.PendingReplyStats{Depth: len(p.list)}
+	for _, pr := range p.list {
+		if stats.Oldest.IsZero() || pr.CreatedAt.Before(stats.Oldest) {
+			stats.Oldest = pr.CreatedAt
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/mswkn/bot"
+	"testing"
+)
+
+func TestMemoryProcessedCommentRepository_GetByReply(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryProcessedCommentRepository()
+	assert.NoError(t, repo.Add(ctx, &mswkn.ProcessedComment{Name: "t1_a", ReplyID: "t1_ra"}))
+	assert.NoError(t, repo.Add(ctx, &mswkn.ProcessedComment{Name: "t1_b"}))
+
+	pc, err := repo.GetByReply(ctx, "t1_ra")
+	assert.NoError(t, err)
+	assert.Equal(t, "t1_a", pc.Name)
+	_, err = repo.GetByReply(ctx, "")
+	assert.ErrorIs(t, err, mswkn.ErrProcessedCommentNotFound)
+
+	//the reply of an edited comment is replaced
+	assert.NoError(t, repo.Update(ctx, &mswkn.ProcessedComment{Name: "t1_a", ReplyID: "t1_ra2"}))
+	_, err = repo.GetByReply(ctx, "t1_ra")
+	assert.ErrorIs(t, err, mswkn.ErrProcessedCommentNotFound)
+	pc, err = repo.GetByReply(ctx, "t1_ra2")
+	assert.NoError(t, err)
+	assert.Equal(t, "t1_a", pc.Name)
+
+	//a comment answered later
+	assert.NoError(t, repo.Update(ctx, &mswkn.ProcessedComment{Name: "t1_b", ReplyID: "t1_rb"}))
+	pc, err = repo.GetByReply(ctx, "t1_rb")
+	assert.NoError(t, err)
+	assert.Equal(t, "t1_b", pc.Name)
+
+	assert.NoError(t, repo.Delete(ctx, "t1_a"))
+	_, err = repo.GetByReply(ctx, "t1_ra2")
+	assert.ErrorIs(t, err, mswkn.ErrProcessedCommentNotFound)
+}
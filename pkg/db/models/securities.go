@@ -36,6 +36,7 @@ type Security struct {
 	CreatedAt      time.Time `boil:"created_at" json:"created_at" toml:"created_at" yaml:"created_at"`
 	Strike         float64   `boil:"strike" json:"strike" toml:"strike" yaml:"strike"`
 	Expire         null.Time `boil:"expire" json:"expire,omitempty" toml:"expire" yaml:"expire,omitempty"`
+	Ticker         string    `boil:"ticker" json:"ticker" toml:"ticker" yaml:"ticker"`
 
 	R *securityR `boil:"-" json:"-" toml:"-" yaml:"-"`
 	L securityL  `boil:"-" json:"-" toml:"-" yaml:"-"`
@@ -54,6 +55,7 @@ var SecurityColumns = struct {
 	CreatedAt      string
 	Strike         string
 	Expire         string
+	Ticker         string
 }{
 	ID:             "id",
 	Name:           "name",
@@ -67,6 +69,7 @@ var SecurityColumns = struct {
 	CreatedAt:      "created_at",
 	Strike:         "strike",
 	Expire:         "expire",
+	Ticker:         "ticker",
 }
 
 // Generated where
@@ -182,6 +185,7 @@ var SecurityWhere = struct {
 	CreatedAt      whereHelpertime_Time
 	Strike         whereHelperfloat64
 	Expire         whereHelpernull_Time
+	Ticker         whereHelperstring
 }{
 	ID:             whereHelperint64{field: "\"securities\".\"id\""},
 	Name:           whereHelperstring{field: "\"securities\".\"name\""},
@@ -195,6 +199,7 @@ var SecurityWhere = struct {
 	CreatedAt:      whereHelpertime_Time{field: "\"securities\".\"created_at\""},
 	Strike:         whereHelperfloat64{field: "\"securities\".\"strike\""},
 	Expire:         whereHelpernull_Time{field: "\"securities\".\"expire\""},
+	Ticker:         whereHelperstring{field: "\"securities\".\"ticker\""},
 }
 
 // SecurityRels is where relationship names are stored.
@@ -214,9 +219,9 @@ func (*securityR) NewStruct() *securityR {
 type securityL struct{}
 
 var (
-	securityAllColumns            = []string{"id", "name", "isin", "wkn", "underlying", "type", "warrant_type", "warrant_sub_type", "updated_at", "created_at", "strike", "expire"}
+	securityAllColumns            = []string{"id", "name", "isin", "wkn", "underlying", "type", "warrant_type", "warrant_sub_type", "updated_at", "created_at", "strike", "expire", "ticker"}
 	securityColumnsWithoutDefault = []string{"name", "isin", "wkn", "updated_at", "created_at", "expire"}
-	securityColumnsWithDefault    = []string{"id", "underlying", "type", "warrant_type", "warrant_sub_type", "strike"}
+	securityColumnsWithDefault    = []string{"id", "underlying", "type", "warrant_type", "warrant_sub_type", "strike", "ticker"}
 	securityPrimaryKeyColumns     = []string{"id"}
 )
 
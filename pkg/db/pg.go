@@ -6,11 +6,12 @@ import (
 	"fmt"
 	"github.com/GeertJohan/go.rice"
 	"github.com/cenkalti/backoff"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/rs/zerolog/log"
 	"github.com/rubenv/sql-migrate"
 	"github.com/volatiletech/null/v8"
 	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/queries"
 	"github.com/volatiletech/sqlboiler/v4/queries/qm"
 	"gitlab.com/mswkn/bot"
 	"gitlab.com/mswkn/bot/pkg/config"
@@ -135,7 +136,7 @@ func (p *PgSecurityRepository) AddBulk(ctx context.Context, secs []*mswkn.Securi
 
 	stm := strings.Builder{}
 	stm.WriteString(fmt.Sprintf(
-		"INSERT INTO %s (%s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s)",
+		"INSERT INTO %s (%s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s)",
 		models.TableNames.Securities,
 		models.SecurityColumns.ID,
 		models.SecurityColumns.Name,
@@ -147,6 +148,7 @@ func (p *PgSecurityRepository) AddBulk(ctx context.Context, secs []*mswkn.Securi
 		models.SecurityColumns.WarrantSubType,
 		models.SecurityColumns.Strike,
 		models.SecurityColumns.Expire,
+		models.SecurityColumns.Ticker,
 		models.SecurityColumns.UpdatedAt,
 		models.SecurityColumns.CreatedAt,
 	))
@@ -157,9 +159,9 @@ func (p *PgSecurityRepository) AddBulk(ctx context.Context, secs []*mswkn.Securi
 	placeholder := make([]string, 0, len(secs))
 	i := 1
 	for _, sec := range secs {
-		valStr := fmt.Sprintf("(DEFAULT, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)", i, i+1, i+2, i+3, i+4, i+5, i+6, i+7, i+8, i+9, i+10)
+		valStr := fmt.Sprintf("(DEFAULT, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)", i, i+1, i+2, i+3, i+4, i+5, i+6, i+7, i+8, i+9, i+10, i+11)
 		placeholder = append(placeholder, valStr)
-		i += 11
+		i += 12
 
 		values = append(values, sec.Name)
 		values = append(values, sec.ISIN)
@@ -170,6 +172,7 @@ func (p *PgSecurityRepository) AddBulk(ctx context.Context, secs []*mswkn.Securi
 		values = append(values, sec.WarrantSubType)
 		values = append(values, sec.Strike)
 		values = append(values, sec.Expire)
+		values = append(values, sec.Ticker)
 		values = append(values, now)
 		values = append(values, now)
 	}
@@ -191,6 +194,7 @@ func (p *PgSecurityRepository) AddBulk(ctx context.Context, secs []*mswkn.Securi
 					"%s" = EXCLUDED."%s",
 					"%s" = EXCLUDED."%s",
 					"%s" = EXCLUDED."%s",
+					"%s" = EXCLUDED."%s",
 					"%s" = EXCLUDED."%s"
 	RETURNING "id"
 	`,
@@ -213,6 +217,8 @@ func (p *PgSecurityRepository) AddBulk(ctx context.Context, secs []*mswkn.Securi
 		models.SecurityColumns.Strike,
 		models.SecurityColumns.Expire,
 		models.SecurityColumns.Expire,
+		models.SecurityColumns.Ticker,
+		models.SecurityColumns.Ticker,
 		models.SecurityColumns.UpdatedAt,
 		models.SecurityColumns.UpdatedAt,
 		models.SecurityColumns.CreatedAt,
@@ -235,6 +241,112 @@ func (p *PgSecurityRepository) Get(ctx context.Context, wkn string) (*mswkn.Secu
 	return fromDbSec(s), nil
 }
 
+func (p *PgSecurityRepository) GetByISIN(ctx context.Context, isin string) (*mswkn.Security, error) {
+	s, err := models.Securities(qm.Where(models.SecurityColumns.Isin+"=?", strings.ToUpper(isin))).One(ctx, p.db)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, mswkn.ErrSecurityNotFound
+		}
+		return nil, err
+	}
+	return fromDbSec(s), nil
+}
+
+func (p *PgSecurityRepository) GetMany(ctx context.Context, wkns []string) (map[string]*mswkn.Security, error) {
+	secs := make(map[string]*mswkn.Security, len(wkns))
+	if len(wkns) == 0 {
+		return secs, nil
+	}
+
+	upper := make([]interface{}, 0, len(wkns))
+	for _, wkn := range wkns {
+		upper = append(upper, strings.ToUpper(wkn))
+	}
+
+	ss, err := models.Securities(qm.WhereIn(models.SecurityColumns.WKN+" in ?", upper...)).All(ctx, p.db)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range ss {
+		secs[s.WKN] = fromDbSec(s)
+	}
+	return secs, nil
+}
+
+//Search uses the trigram index on the name for the ILIKE conditions
+func (p *PgSecurityRepository) Search(ctx context.Context, query string, filters mswkn.SecuritySearchFilters) (*mswkn.SecuritySearchResult, error) {
+	filters = filters.Normalize()
+	res := &mswkn.SecuritySearchResult{
+		Securities: make([]*mswkn.Security, 0),
+	}
+
+	//words shorter than three characters can not use the trigram index of the names
+	tokens := mswkn.SearchQueryTokens(query)
+	if len(tokens) == 0 {
+		return res, nil
+	}
+
+	args := make([]interface{}, 0, len(tokens)+4)
+	matches := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		args = append(args, "%"+escapeLike(token)+"%")
+		matches = append(matches, fmt.Sprintf("%s ILIKE $%d", models.SecurityColumns.Name, len(args)))
+	}
+	where := []string{"(" + strings.Join(matches, " OR ") + ")"}
+	rank := "(CASE WHEN " + strings.Join(matches, " THEN 1 ELSE 0 END + CASE WHEN ") + " THEN 1 ELSE 0 END)"
+
+	if filters.Type != mswkn.SecurityTypeUndefined {
+		args = append(args, filters.Type)
+		where = append(where, fmt.Sprintf("%s = $%d", models.SecurityColumns.Type, len(args)))
+	}
+	if filters.Issuer != "" {
+		args = append(args, escapeLike(filters.Issuer)+"%")
+		where = append(where, fmt.Sprintf("%s ILIKE $%d", models.SecurityColumns.Name, len(args)))
+	}
+	if filters.ExpireFrom != nil {
+		args = append(args, *filters.ExpireFrom)
+		where = append(where, fmt.Sprintf("%s >= $%d", models.SecurityColumns.Expire, len(args)))
+	}
+	if filters.ExpireTo != nil {
+		args = append(args, *filters.ExpireTo)
+		where = append(where, fmt.Sprintf("%s <= $%d", models.SecurityColumns.Expire, len(args)))
+	}
+	whereStr := strings.Join(where, " AND ")
+
+	countSQL := fmt.Sprintf("SELECT count(*) FROM %s WHERE %s", models.TableNames.Securities, whereStr)
+	if err := p.db.QueryRowContext(ctx, countSQL, args...).Scan(&res.Total); err != nil {
+		return nil, err
+	}
+	if res.Total == 0 {
+		return res, nil
+	}
+
+	searchSQL := fmt.Sprintf(
+		"SELECT * FROM %s WHERE %s ORDER BY %s DESC, %s, %s LIMIT %d OFFSET %d",
+		models.TableNames.Securities,
+		whereStr,
+		rank,
+		models.SecurityColumns.Name,
+		models.SecurityColumns.WKN,
+		filters.Limit,
+		filters.Offset,
+	)
+	var secs []*models.Security
+	if err := queries.Raw(searchSQL, args...).Bind(ctx, p.db, &secs); err != nil {
+		return nil, err
+	}
+	for _, sec := range secs {
+		res.Securities = append(res.Securities, fromDbSec(sec))
+	}
+	return res, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
 func toDbSec(sec *mswkn.Security) *models.Security {
 	s := &models.Security{
 		ID:             0,
@@ -246,6 +358,7 @@ func toDbSec(sec *mswkn.Security) *models.Security {
 		WarrantType:    sec.WarrantType,
 		WarrantSubType: sec.WarrantSubType,
 		Strike:         sec.Strike,
+		Ticker:         sec.Ticker,
 		//Expire:         nil,
 	}
 
@@ -267,6 +380,7 @@ func fromDbSec(sec *models.Security) *mswkn.Security {
 		WarrantSubType: sec.WarrantSubType,
 		Strike:         sec.Strike,
 		Expire:         &sec.Expire.Time,
+		Ticker:         sec.Ticker,
 	}
 
 	if !sec.Expire.Valid {
@@ -275,3 +389,372 @@ func fromDbSec(sec *models.Security) *mswkn.Security {
 
 	return s
 }
+
+type PgProcessedCommentRepository struct {
+	db *sql.DB
+}
+
+func NewPgProcessedCommentRepository(db *sql.DB) mswkn.ProcessedCommentRepository {
+	p := &PgProcessedCommentRepository{
+		db: db,
+	}
+	return p
+}
+
+func (p *PgProcessedCommentRepository) Add(ctx context.Context, pc *mswkn.ProcessedComment) error {
+	res, err := p.db.ExecContext(
+		ctx,
+		`INSERT INTO processed_comments (name, reply_id, author, wkns, processed_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (name) DO NOTHING`,
+		pc.Name,
+		pc.ReplyID,
+		pc.Author,
+		textArray(pc.WKNs),
+		pc.ProcessedAt,
+		pc.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return mswkn.ErrProcessedCommentExists
+	}
+	return nil
+}
+
+func (p *PgProcessedCommentRepository) Get(ctx context.Context, name string) (*mswkn.ProcessedComment, error) {
+	return p.getBy(ctx, "name", name)
+}
+
+func (p *PgProcessedCommentRepository) GetByReply(ctx context.Context, replyID string) (*mswkn.ProcessedComment, error) {
+	if replyID == "" {
+		return nil, mswkn.ErrProcessedCommentNotFound
+	}
+	return p.getBy(ctx, "reply_id", replyID)
+}
+
+func (p *PgProcessedCommentRepository) getBy(ctx context.Context, column, value string) (*mswkn.ProcessedComment, error) {
+	pc := &mswkn.ProcessedComment{}
+	err := p.db.QueryRowContext(
+		ctx,
+		`SELECT name, reply_id, author, wkns, processed_at, updated_at FROM processed_comments WHERE `+column+`=$1`,
+		value,
+	).Scan(&pc.Name, &pc.ReplyID, &pc.Author, pq.Array(&pc.WKNs), &pc.ProcessedAt, &pc.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, mswkn.ErrProcessedCommentNotFound
+		}
+		return nil, err
+	}
+	return pc, nil
+}
+
+func (p *PgProcessedCommentRepository) List(ctx context.Context, since time.Time) ([]*mswkn.ProcessedComment, error) {
+	rows, err := p.db.QueryContext(
+		ctx,
+		`SELECT name, reply_id, author, wkns, processed_at, updated_at FROM processed_comments WHERE updated_at>=$1 ORDER BY updated_at`,
+		since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pcs := make([]*mswkn.ProcessedComment, 0)
+	for rows.Next() {
+		pc := &mswkn.ProcessedComment{}
+		if err := rows.Scan(&pc.Name, &pc.ReplyID, &pc.Author, pq.Array(&pc.WKNs), &pc.ProcessedAt, &pc.UpdatedAt); err != nil {
+			return nil, err
+		}
+		pcs = append(pcs, pc)
+	}
+	return pcs, rows.Err()
+}
+
+func (p *PgProcessedCommentRepository) Update(ctx context.Context, pc *mswkn.ProcessedComment) error {
+	res, err := p.db.ExecContext(
+		ctx,
+		`UPDATE processed_comments SET reply_id=$2, wkns=$3, updated_at=$4 WHERE name=$1`,
+		pc.Name,
+		pc.ReplyID,
+		textArray(pc.WKNs),
+		pc.UpdatedAt,
+	)
+	return notFoundIfUnchanged(res, err, mswkn.ErrProcessedCommentNotFound)
+}
+
+func (p *PgProcessedCommentRepository) Delete(ctx context.Context, name string) error {
+	res, err := p.db.ExecContext(ctx, `DELETE FROM processed_comments WHERE name=$1`, name)
+	return notFoundIfUnchanged(res, err, mswkn.ErrProcessedCommentNotFound)
+}
+
+//textArray stores a nil slice as an empty array, the array columns are not null
+func textArray(s []string) pq.StringArray {
+	if s == nil {
+		return pq.StringArray{}
+	}
+	return s
+}
+
+//notFoundIfUnchanged returns notFound if a statement affected no rows
+func notFoundIfUnchanged(res sql.Result, err error, notFound error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
+
+type PgAliasRepository struct {
+	db *sql.DB
+}
+
+func NewPgAliasRepository(db *sql.DB) mswkn.AliasRepository {
+	p := &PgAliasRepository{
+		db: db,
+	}
+	return p
+}
+
+//aliasBulkSize keeps the parameters of an insert below the postgres limit of 65535
+const aliasBulkSize = 10_000
+
+func (p *PgAliasRepository) AddBulk(ctx context.Context, aliases []*mswkn.Alias) error {
+	for start := 0; start < len(aliases); start += aliasBulkSize {
+		end := start + aliasBulkSize
+		if end > len(aliases) {
+			end = len(aliases)
+		}
+		if err := p.addBulk(ctx, aliases[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *PgAliasRepository) addBulk(ctx context.Context, aliases []*mswkn.Alias) error {
+	//postgres rejects an insert which updates the same row twice, the last duplicate wins
+	unique := make(map[[3]string]int, len(aliases))
+	for i, a := range aliases {
+		unique[[3]string{a.Alias, a.WKN, a.Source}] = i
+	}
+
+	placeholders := make([]string, 0, len(unique))
+	values := make([]interface{}, 0, len(unique)*4)
+	for i, a := range aliases {
+		if unique[[3]string{a.Alias, a.WKN, a.Source}] != i {
+			continue
+		}
+		i := len(placeholders)
+		placeholders = append(placeholders, fmt.Sprintf("($%d, $%d, $%d, $%d)", i*4+1, i*4+2, i*4+3, i*4+4))
+		values = append(values, a.Alias, a.WKN, a.Source, a.Confidence)
+	}
+
+	_, err := p.db.ExecContext(
+		ctx,
+		`INSERT INTO aliases (alias, wkn, source, confidence) VALUES `+strings.Join(placeholders, ", ")+
+			` ON CONFLICT (alias, wkn, source) DO UPDATE SET confidence=EXCLUDED.confidence`,
+		values...,
+	)
+	return err
+}
+
+func (p *PgAliasRepository) GetMany(ctx context.Context, names []string) (map[string][]*mswkn.Alias, error) {
+	rows, err := p.db.QueryContext(
+		ctx,
+		`SELECT alias, wkn, source, confidence FROM aliases WHERE alias = ANY($1)`,
+		pq.Array(names),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := make(map[string][]*mswkn.Alias)
+	for rows.Next() {
+		a := &mswkn.Alias{}
+		if err := rows.Scan(&a.Alias, &a.WKN, &a.Source, &a.Confidence); err != nil {
+			return nil, err
+		}
+		found[a.Alias] = append(found[a.Alias], a)
+	}
+	return found, rows.Err()
+}
+
+type PgPendingReplyRepository struct {
+	db *sql.DB
+}
+
+func NewPgPendingReplyRepository(db *sql.DB) mswkn.PendingReplyRepository {
+	p := &PgPendingReplyRepository{
+		db: db,
+	}
+	return p
+}
+
+func (p *PgPendingReplyRepository) Add(ctx context.Context, pr *mswkn.PendingReply) error {
+	_, err := p.db.ExecContext(
+		ctx,
+		`INSERT INTO pending_replies (id, name, action, target, subject, body, wkns, attempts, not_before, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		pr.ID,
+		pr.Name,
+		pr.Action,
+		pr.Target,
+		pr.Subject,
+		pr.Body,
+		textArray(pr.WKNs),
+		pr.Attempts,
+		pr.NotBefore,
+		pr.CreatedAt,
+	)
+	return err
+}
+
+func (p *PgPendingReplyRepository) Replace(ctx context.Context, pr *mswkn.PendingReply) error {
+	_, err := p.db.ExecContext(
+		ctx,
+		`WITH replaced AS (
+			DELETE FROM pending_replies WHERE name=$2 AND action IN ($11, $12)
+		)
+		INSERT INTO pending_replies (id, name, action, target, subject, body, wkns, attempts, not_before, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		pr.ID,
+		pr.Name,
+		pr.Action,
+		pr.Target,
+		pr.Subject,
+		pr.Body,
+		textArray(pr.WKNs),
+		pr.Attempts,
+		pr.NotBefore,
+		pr.CreatedAt,
+		mswkn.PendingReplyActionEdit,
+		mswkn.PendingReplyActionDelete,
+	)
+	return err
+}
+
+func (p *PgPendingReplyRepository) Claim(ctx context.Context, now time.Time, lease time.Duration) (*mswkn.PendingReply, error) {
+	pr := &mswkn.PendingReply{}
+	//the lease is stored before returning the old send time, SKIP LOCKED lets concurrent responders claim other replies
+	err := p.db.QueryRowContext(
+		ctx,
+		`UPDATE pending_replies p SET not_before=$2 FROM (
+			SELECT id, not_before FROM pending_replies WHERE not_before<=$1 ORDER BY not_before, created_at LIMIT 1 FOR UPDATE SKIP LOCKED
+		) due WHERE p.id=due.id
+		RETURNING p.id, p.name, p.action, p.target, p.subject, p.body, p.wkns, p.attempts, due.not_before, p.created_at`,
+		now,
+		now.Add(lease),
+	).Scan(&pr.ID, &pr.Name, &pr.Action, &pr.Target, &pr.Subject, &pr.Body, pq.Array(&pr.WKNs), &pr.Attempts, &pr.NotBefore, &pr.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, mswkn.ErrPendingReplyNotFound
+		}
+		return nil, err
+	}
+	return pr, nil
+}
+
+func (p *PgPendingReplyRepository) Update(ctx context.Context, pr *mswkn.PendingReply) error {
+	res, err := p.db.ExecContext(
+		ctx,
+		`UPDATE pending_replies SET attempts=$2, not_before=$3 WHERE id=$1`,
+		pr.ID,
+		pr.Attempts,
+		pr.NotBefore,
+	)
+	return notFoundIfUnchanged(res, err, mswkn.ErrPendingReplyNotFound)
+}
+
+func (p *PgPendingReplyRepository) Delete(ctx context.Context, id string) error {
+	res, err := p.db.ExecContext(ctx, `DELETE FROM pending_replies WHERE id=$1`, id)
+	return notFoundIfUnchanged(res, err, mswkn.ErrPendingReplyNotFound)
+}
+
+func (p *PgPendingReplyRepository) Stats(ctx context.Context) (*mswkn.PendingReplyStats, error) {
+	stats := &mswkn.PendingReplyStats{}
+	var oldest sql.NullTime
+	err := p.db.QueryRowContext(ctx, `SELECT count(*), min(created_at) FROM pending_replies`).Scan(&stats.Depth, &oldest)
+	if err != nil {
+		return nil, err
+	}
+	stats.Oldest = oldest.Time
+	return stats, nil
+}
+
+type PgDeadLetterRepository struct {
+	db *sql.DB
+}
+
+func NewPgDeadLetterRepository(db *sql.DB) mswkn.DeadLetterRepository {
+	p := &PgDeadLetterRepository{
+		db: db,
+	}
+	return p
+}
+
+func (p *PgDeadLetterRepository) Add(ctx context.Context, dl *mswkn.DeadLetter) error {
+	_, err := p.db.ExecContext(
+		ctx,
+		`INSERT INTO dead_letters (id, subject, payload, codec, error, attempts, failed_at) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET error=EXCLUDED.error, attempts=EXCLUDED.attempts, failed_at=EXCLUDED.failed_at`,
+		dl.ID,
+		dl.Subject,
+		dl.Payload,
+		dl.Codec,
+		dl.Error,
+		dl.Attempts,
+		dl.FailedAt,
+	)
+	return err
+}
+
+func (p *PgDeadLetterRepository) Get(ctx context.Context, id string) (*mswkn.DeadLetter, error) {
+	dl := &mswkn.DeadLetter{}
+	err := p.db.QueryRowContext(
+		ctx,
+		`SELECT id, subject, payload, codec, error, attempts, failed_at FROM dead_letters WHERE id=$1`,
+		id,
+	).Scan(&dl.ID, &dl.Subject, &dl.Payload, &dl.Codec, &dl.Error, &dl.Attempts, &dl.FailedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, mswkn.ErrDeadLetterNotFound
+		}
+		return nil, err
+	}
+	return dl, nil
+}
+
+func (p *PgDeadLetterRepository) List(ctx context.Context) ([]*mswkn.DeadLetter, error) {
+	rows, err := p.db.QueryContext(
+		ctx,
+		`SELECT id, subject, payload, codec, error, attempts, failed_at FROM dead_letters ORDER BY failed_at`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dls := make([]*mswkn.DeadLetter, 0)
+	for rows.Next() {
+		dl := &mswkn.DeadLetter{}
+		if err := rows.Scan(&dl.ID, &dl.Subject, &dl.Payload, &dl.Codec, &dl.Error, &dl.Attempts, &dl.FailedAt); err != nil {
+			return nil, err
+		}
+		dls = append(dls, dl)
+	}
+	return dls, rows.Err()
+}
+
+func (p *PgDeadLetterRepository) Delete(ctx context.Context, id string) error {
+	res, err := p.db.ExecContext(ctx, `DELETE FROM dead_letters WHERE id=$1`, id)
+	return notFoundIfUnchanged(res, err, mswkn.ErrDeadLetterNotFound)
+}
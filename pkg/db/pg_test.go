@@ -0,0 +1,40 @@
+package db
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/mswkn/bot"
+	"testing"
+	"time"
+)
+
+func Test_textArray(t *testing.T) {
+	tests := []struct {
+		name string
+		wkns []string
+		want string
+	}{
+		{name: "nil", wkns: nil, want: "{}"},
+		{name: "empty", wkns: []string{}, want: "{}"},
+		{name: "wkns", wkns: []string{"A1B2C3", "123456"}, want: `{"A1B2C3","123456"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := textArray(tt.wkns).Value()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, v)
+		})
+	}
+}
+
+func Test_toDbSec(t *testing.T) {
+	expire := time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC)
+	tests := []*mswkn.Security{
+		{Name: "SAP SE", ISIN: "DE0007164600", WKN: "716460", Type: mswkn.SecurityTypeCommonStock, Ticker: "SAP"},
+		{Name: "HSBC CALL", ISIN: "DE000TT6DHP1", WKN: "TT6DHP", Underlying: "716460", Type: mswkn.SecurityTypeWarrant, Strike: 120.5, Expire: &expire},
+	}
+	for _, sec := range tests {
+		t.Run(sec.WKN, func(t *testing.T) {
+			assert.Equal(t, sec, fromDbSec(toDbSec(sec)))
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"gitlab.com/mswkn/bot"
+	"sort"
+	"strings"
+)
+
+//invertedIndex maps the words of security names to the WKNs of the securities. The words are indexed by their
+//trigrams, a query word only has to be compared with the words sharing all of its trigrams.
+type invertedIndex struct {
+	tokens   map[string]map[string]bool
+	trigrams map[string]map[string]bool
+}
+
+func newInvertedIndex() *invertedIndex {
+	return &invertedIndex{
+		tokens:   make(map[string]map[string]bool),
+		trigrams: make(map[string]map[string]bool),
+	}
+}
+
+func (i *invertedIndex) add(wkn, name string) {
+	for _, token := range mswkn.SearchTokens(name) {
+		wkns, ok := i.tokens[token]
+		if !ok {
+			wkns = make(map[string]bool)
+			i.tokens[token] = wkns
+			for _, tri := range trigrams(token) {
+				if i.trigrams[tri] == nil {
+					i.trigrams[tri] = make(map[string]bool)
+				}
+				i.trigrams[tri][token] = true
+			}
+		}
+		wkns[wkn] = true
+	}
+}
+
+func (i *invertedIndex) remove(wkn, name string) {
+	for _, token := range mswkn.SearchTokens(name) {
+		wkns, ok := i.tokens[token]
+		if !ok {
+			continue
+		}
+		delete(wkns, wkn)
+		if len(wkns) == 0 {
+			delete(i.tokens, token)
+			for _, tri := range trigrams(token) {
+				delete(i.trigrams[tri], token)
+				if len(i.trigrams[tri]) == 0 {
+					delete(i.trigrams, tri)
+				}
+			}
+		}
+	}
+}
+
+//search returns the WKNs with the number of query words contained in the name of the security
+func (i *invertedIndex) search(query string) map[string]int {
+	scores := make(map[string]int)
+	for _, q := range mswkn.SearchQueryTokens(query) {
+		matched := make(map[string]bool)
+		for _, token := range i.candidates(q) {
+			if !strings.Contains(token, q) {
+				continue
+			}
+			for wkn := range i.tokens[token] {
+				matched[wkn] = true
+			}
+		}
+		for wkn := range matched {
+			scores[wkn]++
+		}
+	}
+	return scores
+}
+
+//candidates returns the words containing all trigrams of q, the query word has at least three characters
+func (i *invertedIndex) candidates(q string) []string {
+	var smallest map[string]bool
+	tris := trigrams(q)
+	for _, tri := range tris {
+		tokens := i.trigrams[tri]
+		if len(tokens) == 0 {
+			return nil
+		}
+		if smallest == nil || len(tokens) < len(smallest) {
+			smallest = tokens
+		}
+	}
+
+	candidates := make([]string, 0, len(smallest))
+	for token := range smallest {
+		found := true
+		for _, tri := range tris {
+			if !i.trigrams[tri][token] {
+				found = false
+				break
+			}
+		}
+		if found {
+			candidates = append(candidates, token)
+		}
+	}
+	return candidates
+}
+
+//trigrams returns the unique sequences of three characters of a word, words shorter than three characters have none
+func trigrams(token string) []string {
+	runes := []rune(token)
+	seen := make(map[string]bool)
+	tris := make([]string, 0, len(runes))
+	for j := 0; j+3 <= len(runes); j++ {
+		tri := string(runes[j : j+3])
+		if seen[tri] {
+			continue
+		}
+		seen[tri] = true
+		tris = append(tris, tri)
+	}
+	return tris
+}
+
+//matchesFilters applies the search filters except pagination
+func matchesFilters(sec *mswkn.Security, f mswkn.SecuritySearchFilters) bool {
+	if f.Type != mswkn.SecurityTypeUndefined && sec.Type != f.Type {
+		return false
+	}
+	if f.Issuer != "" && !strings.HasPrefix(strings.ToUpper(sec.Name), strings.ToUpper(f.Issuer)) {
+		return false
+	}
+	if f.ExpireFrom != nil && (sec.Expire == nil || sec.Expire.Before(*f.ExpireFrom)) {
+		return false
+	}
+	if f.ExpireTo != nil && (sec.Expire == nil || sec.Expire.After(*f.ExpireTo)) {
+		return false
+	}
+	return true
+}
+
+type scoredSecurity struct {
+	sec   *mswkn.Security
+	score int
+}
+
+//paginate sorts the matches by score and name and applies offset and limit
+func paginate(matches []scoredSecurity, f mswkn.SecuritySearchFilters) *mswkn.SecuritySearchResult {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		if matches[i].sec.Name != matches[j].sec.Name {
+			return matches[i].sec.Name < matches[j].sec.Name
+		}
+		return matches[i].sec.WKN < matches[j].sec.WKN
+	})
+
+	res := &mswkn.SecuritySearchResult{
+		Securities: make([]*mswkn.Security, 0),
+		Total:      len(matches),
+	}
+	for i := f.Offset; i < len(matches) && i < f.Offset+f.Limit; i++ {
+		res.Securities = append(res.Securities, matches[i].sec)
+	}
+	return res
+}
@@ -0,0 +1,38 @@
+package db
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_invertedIndex(t *testing.T) {
+	i := newInvertedIndex()
+	i.add("AAAAAA", "HSBC CALL 24 NVIDIA")
+	i.add("918422", "NVIDIA CORP")
+	i.add("A1CX3T", "TESLA INC")
+
+	tests := []struct {
+		name  string
+		query string
+		want  map[string]int
+	}{
+		{name: "whole word", query: "nvidia", want: map[string]int{"AAAAAA": 1, "918422": 1}},
+		{name: "part of a word", query: "vidi", want: map[string]int{"AAAAAA": 1, "918422": 1}},
+		{name: "several words", query: "call nvidia", want: map[string]int{"AAAAAA": 2, "918422": 1}},
+		{name: "trigrams in other order", query: "idiv", want: map[string]int{}},
+		{name: "short words are ignored", query: "24 in", want: map[string]int{}},
+		{name: "unknown", query: "xyz", want: map[string]int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, i.search(tt.query))
+		})
+	}
+
+	i.remove("918422", "NVIDIA CORP")
+	assert.Equal(t, map[string]int{"AAAAAA": 1}, i.search("nvidia"))
+	i.remove("AAAAAA", "HSBC CALL 24 NVIDIA")
+	assert.Empty(t, i.search("nvidia"))
+	_, ok := i.trigrams["NVI"]
+	assert.False(t, ok)
+}
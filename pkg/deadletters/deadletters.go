@@ -0,0 +1,102 @@
+package deadletters
+
+import (
+	"context"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"gitlab.com/mswkn/bot"
+	"gitlab.com/mswkn/bot/pkg/broker"
+	"time"
+)
+
+type DeadLetters struct {
+	msg  mswkn.Broker
+	repo mswkn.DeadLetterRepository
+}
+
+func NewService(msg mswkn.Broker, repo mswkn.DeadLetterRepository) *DeadLetters {
+	d := &DeadLetters{
+		msg:  msg,
+		repo: repo,
+	}
+	return d
+}
+
+//Start collects the dead letters of all pipeline subjects
+func (d *DeadLetters) Start(ctx context.Context) {
+	lg := log.With().Str("comp", "deadletters").Logger()
+
+	handler := func(dl *mswkn.DeadLetter) error {
+		lg := lg.With().Str("id", dl.ID).Str("subject", dl.Subject).Logger()
+		lg.Warn().Str("error", dl.Error).Int("attempts", dl.Attempts).Msg("received dead letter")
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		if err := d.repo.Add(ctx, dl); err != nil {
+			lg.Error().Err(err).Msg("could not store dead letter")
+			return err
+		}
+		return nil
+	}
+
+	for _, subject := range mswkn.BrokerRequestSubjects {
+		dlSubject := mswkn.BrokerSubjectDeadLetterPrefix + subject
+		if err := d.msg.QueueSubscribe(dlSubject, mswkn.BrokerQueueDeadLetter, handler); err != nil {
+			lg.Fatal().Err(err).Str("subject", dlSubject).Str("queue", mswkn.BrokerQueueDeadLetter).Msg("could not subscribe to subject")
+		}
+	}
+
+	<-ctx.Done()
+}
+
+//requests creates the request type of each pipeline subject
+var requests = map[string]func() interface{}{
+	mswkn.BrokerSubjectWKNRequest:          func() interface{} { return &mswkn.RedditRequest{} },
+	mswkn.BrokerSubjectSecuritiesRequest:   func() interface{} { return &mswkn.SecuritiesRequest{} },
+	mswkn.BrokerSubjectInfoLinksRequest:    func() interface{} { return &mswkn.InfoLinksRequest{} },
+	mswkn.BrokerSubjectRedditRepplyRequest: func() interface{} { return &mswkn.RedditReplyRequest{} },
+}
+
+//Reinject publishes the original payload of a dead letter to its subject again and removes the dead letter. Payloads
+//of another codec than the configured one are decoded and published as requests, so they are encoded again.
+func Reinject(ctx context.Context, msg mswkn.Broker, codec string, repo mswkn.DeadLetterRepository, id string) error {
+	dl, err := repo.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	payload, err := reencode(dl, codec)
+	if err != nil {
+		return err
+	}
+	if err := msg.Publish(dl.Subject, payload); err != nil {
+		return err
+	}
+
+	return repo.Delete(ctx, id)
+}
+
+func reencode(dl *mswkn.DeadLetter, codec string) (interface{}, error) {
+	from, err := broker.NewCodec(dl.Codec)
+	if err != nil {
+		return nil, err
+	}
+	to, err := broker.NewCodec(codec)
+	if err != nil {
+		return nil, err
+	}
+	if from.Name() == to.Name() {
+		return broker.RawMessage(dl.Payload), nil
+	}
+
+	newRequest, ok := requests[dl.Subject]
+	if !ok {
+		return nil, fmt.Errorf("can not re-encode dead letter of subject '%s' from %s to %s", dl.Subject, from.Name(), to.Name())
+	}
+	req := newRequest()
+	if err := from.Decode(dl.Payload, req); err != nil {
+		return nil, fmt.Errorf("could not decode dead letter with %s: %w", from.Name(), err)
+	}
+	return req, nil
+}
@@ -0,0 +1,57 @@
+package deadletters
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/mswkn/bot"
+	"gitlab.com/mswkn/bot/pkg/broker"
+	"gitlab.com/mswkn/bot/pkg/config"
+	"gitlab.com/mswkn/bot/pkg/db"
+	"testing"
+	"time"
+)
+
+func TestReinject(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec string
+	}{
+		{"same codec", broker.CodecProtobuf},
+		{"codec changed", broker.CodecJSON},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			conf := config.Config{}
+			conf.Queue.Codec = broker.CodecProtobuf
+			msg := broker.NewMemoryClient(conf)
+			defer msg.Close()
+
+			received := make(chan *mswkn.RedditRequest, 1)
+			require.NoError(t, msg.Subscribe(mswkn.BrokerSubjectWKNRequest, func(rr *mswkn.RedditRequest) error {
+				received <- rr
+				return nil
+			}))
+
+			//the dead letter was stored before the codec of the bot was changed
+			codec, err := broker.NewCodec(tt.codec)
+			require.NoError(t, err)
+			payload, err := codec.Encode(&mswkn.RedditRequest{Name: "t1_abc", Text: "$716460"})
+			require.NoError(t, err)
+			repo := db.NewMemoryDeadLetterRepository()
+			require.NoError(t, repo.Add(ctx, &mswkn.DeadLetter{ID: "1", Subject: mswkn.BrokerSubjectWKNRequest, Payload: payload, Codec: tt.codec}))
+
+			assert.NoError(t, Reinject(ctx, msg, conf.Queue.Codec, repo, "1"))
+			select {
+			case rr := <-received:
+				assert.Equal(t, "t1_abc", rr.Name)
+				assert.Equal(t, "$716460", rr.Text)
+			case <-time.After(time.Second * 5):
+				t.Fatal("reinjected request was not received")
+			}
+			_, err = repo.Get(ctx, "1")
+			assert.ErrorIs(t, err, mswkn.ErrDeadLetterNotFound)
+		})
+	}
+}
@@ -2,13 +2,15 @@ package rest
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"gitlab.com/mswkn/bot"
 	"gitlab.com/mswkn/bot/pkg/config"
 	"gitlab.com/mswkn/bot/pkg/instrumenting"
 	"net/http"
 	"time"
 )
 
-func health(conf config.Config) func(c *gin.Context) {
+func health(conf config.Config, pendingReplyRepo mswkn.PendingReplyRepository) func(c *gin.Context) {
 	return func(c *gin.Context) {
 
 		dataStatus := instrumenting.Status.GetDataUpdateStatus()
@@ -17,9 +19,15 @@ func health(conf config.Config) func(c *gin.Context) {
 			Status     bool      `json:"status"`
 			LastUpdate time.Time `json:"last_update"`
 		}
+		type ReplyQueueStatus struct {
+			Depth  int        `json:"depth"`
+			Oldest *time.Time `json:"oldest,omitempty"`
+		}
 		type Status struct {
 			Version    string
 			DataStatus DataStatus `json:"data_status"`
+			//ReplyQueue is missing when the reply queue is not available
+			ReplyQueue *ReplyQueueStatus `json:"reply_queue,omitempty"`
 		}
 
 		stat := &Status{
@@ -30,6 +38,17 @@ func health(conf config.Config) func(c *gin.Context) {
 			},
 		}
 
+		if pendingReplyRepo != nil {
+			if stats, err := pendingReplyRepo.Stats(c.Request.Context()); err != nil {
+				log.Error().Err(err).Str("comp", "rest").Msg("could not get reply queue stats")
+			} else {
+				stat.ReplyQueue = &ReplyQueueStatus{Depth: stats.Depth}
+				if !stats.Oldest.IsZero() {
+					stat.ReplyQueue.Oldest = &stats.Oldest
+				}
+			}
+		}
+
 		httpCode := 200
 		if !dataStatus.Status() {
 			httpCode = http.StatusServiceUnavailable
@@ -0,0 +1,109 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"gitlab.com/mswkn/bot"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//securityTypes are the names of the type filter of the search
+var securityTypes = map[string]int{
+	"option":  mswkn.SecurityTypeOption,
+	"future":  mswkn.SecurityTypeFuture,
+	"bond":    mswkn.SecurityTypeBond,
+	"stock":   mswkn.SecurityTypeCommonStock,
+	"etf":     mswkn.SecurityTypeExchangeTradedFund,
+	"etc":     mswkn.SecurityTypeExchangeTradedCommodity,
+	"warrant": mswkn.SecurityTypeWarrant,
+	"etn":     mswkn.SecurityTypeExchangeTradedNode,
+}
+
+const searchDateLayout = "2006-01-02"
+
+//searchSecurities handles GET /securities/search?q=&type=&issuer=&expire_from=&expire_to=&offset=&limit=
+func searchSecurities(repo mswkn.SecurityRepository, route string) func(c *gin.Context) {
+	lg := log.With().Str("comp", "rest").Str("route", route).Logger()
+	return func(c *gin.Context) {
+		query := strings.TrimSpace(c.Query("q"))
+		if query == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "query parameter q must not be empty"})
+			return
+		}
+		if len(mswkn.SearchQueryTokens(query)) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("query parameter q needs a word with at least %d characters", mswkn.SecuritySearchMinTokenLength)})
+			return
+		}
+
+		filters, err := parseSearchFilters(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+
+		res, err := repo.Search(c.Request.Context(), query, filters)
+		if err != nil {
+			lg.Error().Err(err).Str("route", c.Request.URL.String()).Msg("error")
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "internal error"})
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func parseSearchFilters(c *gin.Context) (mswkn.SecuritySearchFilters, error) {
+	f := mswkn.SecuritySearchFilters{
+		Issuer: strings.TrimSpace(c.Query("issuer")),
+	}
+
+	if t := c.Query("type"); t != "" {
+		typ, ok := securityTypes[strings.ToLower(t)]
+		if !ok {
+			return f, fmt.Errorf("unknown type: %s", t)
+		}
+		f.Type = typ
+	}
+
+	var err error
+	if f.ExpireFrom, err = parseSearchDate(c, "expire_from"); err != nil {
+		return f, err
+	}
+	if f.ExpireTo, err = parseSearchDate(c, "expire_to"); err != nil {
+		return f, err
+	}
+	if f.Offset, err = parseSearchInt(c, "offset"); err != nil {
+		return f, err
+	}
+	if f.Limit, err = parseSearchInt(c, "limit"); err != nil {
+		return f, err
+	}
+	return f.Normalize(), nil
+}
+
+func parseSearchDate(c *gin.Context, name string) (*time.Time, error) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(searchDateLayout, v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a date like %s", name, searchDateLayout)
+	}
+	return &t, nil
+}
+
+func parseSearchInt(c *gin.Context, name string) (int, error) {
+	v := c.Query(name)
+	if v == "" {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("%s must be a positive number", name)
+	}
+	return i, nil
+}
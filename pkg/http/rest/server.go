@@ -7,23 +7,30 @@ import (
 	"github.com/rs/zerolog/log"
 	"gitlab.com/mswkn/bot"
 	"gitlab.com/mswkn/bot/pkg/config"
+	"gitlab.com/mswkn/bot/pkg/deadletters"
+	"gitlab.com/mswkn/bot/pkg/tracing"
 	"net/http"
 	"time"
 )
 
 type Server struct {
-	s            *http.Server
-	msg          mswkn.Broker
-	securityRepo mswkn.SecurityRepository
-	infoLinkRepo mswkn.InfoLinkRepository
+	s              *http.Server
+	msg            mswkn.Broker
+	securityRepo   mswkn.SecurityRepository
+	infoLinkRepo   mswkn.InfoLinkRepository
+	deadLetterRepo mswkn.DeadLetterRepository
+	//pendingReplyRepo is the reply queue of the responder, its depth is reported by the health check
+	pendingReplyRepo mswkn.PendingReplyRepository
 }
 
-func NewServer(conf config.Config, msg mswkn.Broker, securityRepo mswkn.SecurityRepository, infoLinkRepo mswkn.InfoLinkRepository) *Server {
+func NewServer(conf config.Config, msg mswkn.Broker, securityRepo mswkn.SecurityRepository, infoLinkRepo mswkn.InfoLinkRepository, deadLetterRepo mswkn.DeadLetterRepository, pendingReplyRepo mswkn.PendingReplyRepository) *Server {
 
 	s := &Server{
-		msg:          msg,
-		securityRepo: securityRepo,
-		infoLinkRepo: infoLinkRepo,
+		msg:              msg,
+		securityRepo:     securityRepo,
+		infoLinkRepo:     infoLinkRepo,
+		deadLetterRepo:   deadLetterRepo,
+		pendingReplyRepo: pendingReplyRepo,
 	}
 
 	if conf.Mode == "develop" {
@@ -59,7 +66,7 @@ func (s *Server) Stop(ctx context.Context) error {
 func (s *Server) routes(router *gin.Engine, conf config.Config) {
 	lg := log.With().Str("comp", "rest").Logger()
 
-	router.GET("/health", health(conf))
+	router.GET("/health", health(conf, s.pendingReplyRepo))
 
 	var api *gin.RouterGroup
 
@@ -79,7 +86,13 @@ func (s *Server) routes(router *gin.Engine, conf config.Config) {
 	api.POST("/reddit/comment/inject/:name", inject(s.msg, "/inject"))
 
 	api.GET("/security/:wkn", getSecurity(s.securityRepo, "/security"))
+	api.GET("/security/isin/:isin", getSecurityByISIN(s.securityRepo, "/security/isin"))
+	api.POST("/securities/batch", getSecurities(s.securityRepo, "/securities/batch"))
+	api.GET("/securities/search", searchSecurities(s.securityRepo, "/securities/search"))
 	api.GET("/infolink/:wkn", getInfoLink(s.infoLinkRepo, "/infolink"))
+
+	api.GET("/deadletters", listDeadLetters(s.deadLetterRepo, "/deadletters"))
+	api.POST("/deadletters/:id/reinject", reinjectDeadLetter(s.msg, conf.Queue.Codec, s.deadLetterRepo, "/deadletters/reinject"))
 }
 
 func getSecurity(repo mswkn.SecurityRepository, route string) func(c *gin.Context) {
@@ -100,6 +113,53 @@ func getSecurity(repo mswkn.SecurityRepository, route string) func(c *gin.Contex
 	}
 }
 
+func getSecurityByISIN(repo mswkn.SecurityRepository, route string) func(c *gin.Context) {
+	lg := log.With().Str("comp", "rest").Str("route", route).Logger()
+	return func(c *gin.Context) {
+		isin := c.Param("isin")
+		sec, err := repo.GetByISIN(c.Request.Context(), isin)
+		if err != nil {
+			if err == mswkn.ErrSecurityNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"message": "not found"})
+				return
+			}
+			lg.Error().Err(err).Str("route", c.Request.URL.String()).Msg("error")
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "internal error"})
+			return
+		}
+		c.JSON(http.StatusOK, sec)
+	}
+}
+
+//maxBatchSize limits the WKNs of a batch request
+const maxBatchSize = 500
+
+func getSecurities(repo mswkn.SecurityRepository, route string) func(c *gin.Context) {
+	lg := log.With().Str("comp", "rest").Str("route", route).Logger()
+	return func(c *gin.Context) {
+		type Body struct {
+			WKNs []string `json:"wkns" binding:"required"`
+		}
+		var b Body
+		if err := c.Bind(&b); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		if len(b.WKNs) > maxBatchSize {
+			c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("at most %d wkns per request", maxBatchSize)})
+			return
+		}
+
+		secs, err := repo.GetMany(c.Request.Context(), b.WKNs)
+		if err != nil {
+			lg.Error().Err(err).Str("route", c.Request.URL.String()).Msg("error")
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "internal error"})
+			return
+		}
+		c.JSON(http.StatusOK, secs)
+	}
+}
+
 func getInfoLink(repo mswkn.InfoLinkRepository, route string) func(c *gin.Context) {
 	lg := log.With().Str("comp", "rest").Str("route", route).Logger()
 
@@ -119,6 +179,40 @@ func getInfoLink(repo mswkn.InfoLinkRepository, route string) func(c *gin.Contex
 	}
 }
 
+func listDeadLetters(repo mswkn.DeadLetterRepository, route string) func(c *gin.Context) {
+	lg := log.With().Str("comp", "rest").Str("route", route).Logger()
+
+	return func(c *gin.Context) {
+		dls, err := repo.List(c.Request.Context())
+		if err != nil {
+			lg.Error().Err(err).Str("route", c.Request.URL.String()).Msg("error")
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "internal error"})
+			return
+		}
+		c.JSON(http.StatusOK, dls)
+	}
+}
+
+func reinjectDeadLetter(msg mswkn.Broker, codec string, repo mswkn.DeadLetterRepository, route string) func(c *gin.Context) {
+	lg := log.With().Str("comp", "rest").Str("route", route).Logger()
+
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if err := deadletters.Reinject(c.Request.Context(), msg, codec, repo, id); err != nil {
+			if err == mswkn.ErrDeadLetterNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"message": "not found"})
+				return
+			}
+			lg.Error().Err(err).Str("route", c.Request.URL.String()).Msg("error")
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "internal error"})
+			return
+		}
+
+		lg.Info().Str("id", id).Msg("re-injected dead letter")
+		c.String(http.StatusNoContent, "")
+	}
+}
+
 func inject(msg mswkn.Broker, route string) func(c *gin.Context) {
 	lg := log.With().Str("comp", "rest").Str("route", route).Logger()
 
@@ -134,8 +228,10 @@ func inject(msg mswkn.Broker, route string) func(c *gin.Context) {
 		}
 
 		req := mswkn.RedditRequest{
-			Name: c.Param("name"),
-			Text: b.Body,
+			SchemaVersion: mswkn.BrokerSchemaVersion,
+			Trace:         tracing.NewTrace(),
+			Name:          c.Param("name"),
+			Text:          b.Body,
 		}
 
 		lg.Debug().Msgf("injecting %+v", req)
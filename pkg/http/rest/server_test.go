@@ -0,0 +1,155 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/mswkn/bot"
+	"gitlab.com/mswkn/bot/pkg/config"
+	"gitlab.com/mswkn/bot/pkg/db"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecurityRoutes(t *testing.T) {
+	repo := db.NewMemorySecurityRepository()
+	assert.NoError(t, repo.AddBulk(context.Background(), []*mswkn.Security{
+		{Name: "SAP", ISIN: "DE0007164600", WKN: "716460"},
+		{Name: "Apple", ISIN: "US0378331005", WKN: "865985"},
+	}))
+
+	conf := config.Config{}
+	conf.HTTPServer.BasicAuthDisabled = true
+	s := NewServer(conf, nil, repo, nil, nil, nil)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantCode int
+		want     string
+	}{
+		{name: "wkn", method: http.MethodGet, path: "/api/v1/security/716460", wantCode: http.StatusOK, want: "SAP"},
+		{name: "isin", method: http.MethodGet, path: "/api/v1/security/isin/us0378331005", wantCode: http.StatusOK, want: "Apple"},
+		{name: "isin not found", method: http.MethodGet, path: "/api/v1/security/isin/DE0007164601", wantCode: http.StatusNotFound},
+		{name: "batch", method: http.MethodPost, path: "/api/v1/securities/batch", body: `{"wkns":["716460","865985","AAAAAA"]}`, wantCode: http.StatusOK},
+		{name: "batch without wkns", method: http.MethodPost, path: "/api/v1/securities/batch", body: `{}`, wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			s.s.Handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.want != "" {
+				sec := &mswkn.Security{}
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), sec))
+				assert.Equal(t, tt.want, sec.Name)
+			}
+		})
+	}
+}
+
+func TestSecurityBatch(t *testing.T) {
+	repo := db.NewMemorySecurityRepository()
+	assert.NoError(t, repo.Add(context.Background(), &mswkn.Security{Name: "SAP", ISIN: "DE0007164600", WKN: "716460"}))
+
+	conf := config.Config{}
+	conf.HTTPServer.BasicAuthDisabled = true
+	s := NewServer(conf, nil, repo, nil, nil, nil)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/securities/batch", strings.NewReader(`{"wkns":["716460","AAAAAA"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	s.s.Handler.ServeHTTP(w, req)
+
+	secs := make(map[string]*mswkn.Security)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &secs))
+	assert.Len(t, secs, 1)
+	assert.Equal(t, "SAP", secs["716460"].Name)
+}
+
+func TestSearchSecurities(t *testing.T) {
+	expire := time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC)
+	repo := db.NewMemorySecurityRepository()
+	assert.NoError(t, repo.AddBulk(context.Background(), []*mswkn.Security{
+		{Name: "HSBC CALL 24 NVIDIA", WKN: "AAAAAA", ISIN: "DE000AAAAAA1", Type: mswkn.SecurityTypeWarrant, Expire: &expire},
+		{Name: "SG CALL 24 TSLA", WKN: "BBBBBB", ISIN: "DE000BBBBBB1", Type: mswkn.SecurityTypeWarrant, Expire: &expire},
+		{Name: "NVIDIA CORP", WKN: "918422", ISIN: "US67066G1040", Type: mswkn.SecurityTypeCommonStock},
+		{Name: "TESLA INC", WKN: "A1CX3T", ISIN: "US88160R1014", Type: mswkn.SecurityTypeCommonStock},
+	}))
+
+	conf := config.Config{}
+	conf.HTTPServer.BasicAuthDisabled = true
+	s := NewServer(conf, nil, repo, nil, nil, nil)
+
+	tests := []struct {
+		name      string
+		query     string
+		wantCode  int
+		wantWKNs  []string
+		wantTotal int
+	}{
+		{name: "best match first", query: "q=Nvidia+call+2024+TSLA", wantCode: http.StatusOK, wantWKNs: []string{"AAAAAA", "BBBBBB", "918422"}, wantTotal: 3},
+		{name: "partial word", query: "q=tesl", wantCode: http.StatusOK, wantWKNs: []string{"A1CX3T"}, wantTotal: 1},
+		{name: "type", query: "q=nvidia&type=stock", wantCode: http.StatusOK, wantWKNs: []string{"918422"}, wantTotal: 1},
+		{name: "issuer", query: "q=call&issuer=sg", wantCode: http.StatusOK, wantWKNs: []string{"BBBBBB"}, wantTotal: 1},
+		{name: "expiry", query: "q=nvidia&expire_from=2024-01-01&expire_to=2024-12-31", wantCode: http.StatusOK, wantWKNs: []string{"AAAAAA"}, wantTotal: 1},
+		{name: "pagination", query: "q=call&limit=1&offset=1", wantCode: http.StatusOK, wantWKNs: []string{"BBBBBB"}, wantTotal: 2},
+		{name: "no results", query: "q=xyz", wantCode: http.StatusOK, wantWKNs: []string{}, wantTotal: 0},
+		{name: "short words are ignored", query: "q=sg+24+tesla", wantCode: http.StatusOK, wantWKNs: []string{"A1CX3T"}, wantTotal: 1},
+		{name: "empty query", query: "q=", wantCode: http.StatusBadRequest},
+		{name: "short words only", query: "q=sg+24", wantCode: http.StatusBadRequest},
+		{name: "unknown type", query: "q=call&type=foo", wantCode: http.StatusBadRequest},
+		{name: "bad date", query: "q=call&expire_to=24", wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.s.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/securities/search?"+tt.query, nil))
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			res := &mswkn.SecuritySearchResult{}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), res))
+			wkns := make([]string, 0, len(res.Securities))
+			for _, sec := range res.Securities {
+				wkns = append(wkns, sec.WKN)
+			}
+			assert.Equal(t, tt.wantWKNs, wkns)
+			assert.Equal(t, tt.wantTotal, res.Total)
+		})
+	}
+}
+
+func TestHealthReplyQueue(t *testing.T) {
+	created := time.Date(2021, 4, 1, 12, 0, 0, 0, time.UTC)
+	repo := db.NewMemoryPendingReplyRepository()
+	assert.NoError(t, repo.Add(context.Background(), &mswkn.PendingReply{ID: "a", CreatedAt: created}))
+	assert.NoError(t, repo.Add(context.Background(), &mswkn.PendingReply{ID: "b", CreatedAt: created.Add(time.Minute)}))
+
+	conf := config.Config{}
+	conf.HTTPServer.BasicAuthDisabled = true
+	s := NewServer(conf, nil, db.NewMemorySecurityRepository(), nil, nil, repo)
+
+	w := httptest.NewRecorder()
+	s.s.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	var res struct {
+		ReplyQueue struct {
+			Depth  int       `json:"depth"`
+			Oldest time.Time `json:"oldest"`
+		} `json:"reply_queue"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, 2, res.ReplyQueue.Depth)
+	assert.True(t, created.Equal(res.ReplyQueue.Oldest))
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/rs/zerolog/log"
 	"gitlab.com/mswkn/bot"
 	"gitlab.com/mswkn/bot/pkg/onvista"
+	"gitlab.com/mswkn/bot/pkg/tracing"
 	"time"
 )
 
@@ -27,16 +28,23 @@ func NewService(msg mswkn.Broker, onvistaClient *onvista.Client, ilRepo mswkn.In
 func (i *InfoLinks) Start(ctx context.Context) {
 	lg := log.With().Str("comp", "infolinks").Logger()
 
-	handler := func(wr *mswkn.InfoLinksRequest) {
-		lg := lg.With().Str("name", wr.Name).Logger()
+	handler := func(wr *mswkn.InfoLinksRequest) (err error) {
+		lg := lg.With().Str("name", wr.Name).Str("request_id", wr.Trace.RequestID).Logger()
 		lg.Debug().Msgf("received InfoLinksRequest: %+v", wr)
+		stage := tracing.StartStage(wr.Trace, "infolinks", wr.Name)
+		defer func() { stage.End(err) }()
 
 		infoLinks := make(map[string]*mswkn.InfoLink)
+		errs := make(map[string]mswkn.ErrorCode)
+		for wkn, code := range wr.Errors {
+			errs[wkn] = code
+		}
 
 		for wkn, sec := range wr.Securities {
 			il, err := i.fetchInfoLink(sec)
 			if err != nil {
 				lg.Error().Err(err).Msg("could not fetch link")
+				errs[wkn] = mswkn.ErrorCodeInfoLinkNotFound
 				continue
 			}
 			infoLinks[wkn] = il
@@ -47,22 +55,29 @@ func (i *InfoLinks) Start(ctx context.Context) {
 		lg.Debug().Int("infolinks", len(infoLinks)).Msg("infolink lookup done")
 
 		ilf := &mswkn.RedditReplyRequest{
-			Name:       wr.Name,
-			WKNs:       wr.WKNs,
-			Securities: wr.Securities,
-			InfoLinks:  infoLinks,
+			SchemaVersion: mswkn.BrokerSchemaVersion,
+			Trace:         stage.Next(),
+			Name:          wr.Name,
+			WKNs:          wr.WKNs,
+			Securities:    wr.Securities,
+			InfoLinks:     infoLinks,
+			Errors:        errs,
+			ReplyTarget:   wr.ReplyTarget,
+			Suggestions:   wr.Suggestions,
+			Command:       wr.Command,
 		}
 		lg.Trace().Msg("sending RedditReplyRequest")
 		if err := i.msg.Publish(mswkn.BrokerSubjectRedditRepplyRequest, ilf); err != nil {
 			lg.Error().Err(err).Msg("could not send RedditReplyRequest")
-			return
+			return err
 		}
 		lg.Trace().Msg("RedditReplyRequest sent")
+		return nil
 	}
 
-	err := i.msg.Subscribe(mswkn.BrokerSubjectInfoLinksRequest, handler)
+	err := i.msg.QueueSubscribe(mswkn.BrokerSubjectInfoLinksRequest, mswkn.BrokerQueueInfoLinks, handler)
 	if err != nil {
-		lg.Fatal().Err(err).Str("subject", mswkn.BrokerSubjectInfoLinksRequest).Msg("could not subscribe to subject")
+		lg.Fatal().Err(err).Str("subject", mswkn.BrokerSubjectInfoLinksRequest).Str("queue", mswkn.BrokerQueueInfoLinks).Msg("could not subscribe to subject")
 	}
 
 	<-ctx.Done()
@@ -0,0 +1,178 @@
+package integration
+
+import (
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/mswkn/bot"
+	"gitlab.com/mswkn/bot/pkg/config"
+	"gitlab.com/mswkn/bot/pkg/db"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+//newTestPgDb connects to the database configured by the DATABASE_PG_* variables, the tests only run with PG_TEST=1
+func newTestPgDb(t *testing.T) *sql.DB {
+	if os.Getenv("PG_TEST") != "1" {
+		t.Skip("PG_TEST is not set")
+	}
+	pg := db.NewPgDb(config.LoadConfigFromEnv("test"))
+	t.Cleanup(func() {
+		_ = pg.Close()
+	})
+	return pg
+}
+
+//testName returns a comment name which is unique between test runs
+func testName(prefix string) string {
+	return prefix + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+func TestPgProcessedCommentRepository_noWKNs(t *testing.T) {
+	repo := db.NewPgProcessedCommentRepository(newTestPgDb(t))
+	ctx := context.Background()
+
+	//the help command and edits without WKNs store no WKNs
+	now := time.Now()
+	pc := &mswkn.ProcessedComment{Name: testName("t1_"), Author: "user", ProcessedAt: now, UpdatedAt: now}
+	assert.NoError(t, repo.Add(ctx, pc))
+	defer func() {
+		assert.NoError(t, repo.Delete(ctx, pc.Name))
+	}()
+
+	got, err := repo.Get(ctx, pc.Name)
+	assert.NoError(t, err)
+	assert.Empty(t, got.WKNs)
+
+	got.WKNs = []string{"A1B2C3"}
+	assert.NoError(t, repo.Update(ctx, got))
+	got.WKNs = nil
+	assert.NoError(t, repo.Update(ctx, got))
+
+	got, err = repo.Get(ctx, pc.Name)
+	assert.NoError(t, err)
+	assert.Empty(t, got.WKNs)
+}
+
+func TestPgPendingReplyRepository_deleteWithoutWKNs(t *testing.T) {
+	repo := db.NewPgPendingReplyRepository(newTestPgDb(t))
+	ctx := context.Background()
+
+	//an edited comment without WKNs deletes the reply and has no WKNs, it is older than other queued replies
+	now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	pr := &mswkn.PendingReply{
+		ID:        testName("test-"),
+		Name:      testName("t1_"),
+		Action:    mswkn.PendingReplyActionDelete,
+		Target:    testName("t1_reply_"),
+		NotBefore: now,
+		CreatedAt: now,
+	}
+	assert.NoError(t, repo.Add(ctx, pr))
+	defer func() {
+		_ = repo.Delete(ctx, pr.ID)
+	}()
+
+	got, err := repo.Claim(ctx, time.Now(), time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, pr.ID, got.ID)
+	assert.Equal(t, mswkn.PendingReplyActionDelete, got.Action)
+	assert.Empty(t, got.WKNs)
+	assert.NoError(t, repo.Delete(ctx, got.ID))
+}
+
+func TestPgDeadLetterRepository(t *testing.T) {
+	repo := db.NewPgDeadLetterRepository(newTestPgDb(t))
+	ctx := context.Background()
+
+	dl := &mswkn.DeadLetter{
+		ID:       testName("test-"),
+		Subject:  "scan",
+		Payload:  []byte(`{"name":"t1_abc"}`),
+		Codec:    "json",
+		Error:    "decode failed",
+		Attempts: 3,
+		FailedAt: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	assert.NoError(t, repo.Add(ctx, dl))
+
+	got, err := repo.Get(ctx, dl.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, dl.Payload, got.Payload)
+	assert.Equal(t, dl.Attempts, got.Attempts)
+	assert.True(t, dl.FailedAt.Equal(got.FailedAt))
+
+	dls, err := repo.List(ctx)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, dls)
+
+	assert.NoError(t, repo.Delete(ctx, dl.ID))
+	assert.ErrorIs(t, repo.Delete(ctx, dl.ID), mswkn.ErrDeadLetterNotFound)
+	_, err = repo.Get(ctx, dl.ID)
+	assert.ErrorIs(t, err, mswkn.ErrDeadLetterNotFound)
+}
+
+func TestPgSecurityRepository_ticker(t *testing.T) {
+	repo := db.NewPgSecurityRepository(newTestPgDb(t))
+	ctx := context.Background()
+
+	name := testName("")
+	wkn := strings.ToUpper(name[len(name)-6:])
+	sec := &mswkn.Security{Name: "Ticker Test", ISIN: "XX" + wkn + "0000", WKN: wkn, Ticker: "TTT"}
+	assert.NoError(t, repo.AddBulk(ctx, []*mswkn.Security{sec}))
+
+	got, err := repo.Get(ctx, wkn)
+	assert.NoError(t, err)
+	assert.Equal(t, "TTT", got.Ticker)
+
+	got, err = repo.GetByISIN(ctx, sec.ISIN)
+	assert.NoError(t, err)
+	assert.Equal(t, "TTT", got.Ticker)
+}
+
+func TestPgProcessedCommentRepository_timeZone(t *testing.T) {
+	repo := db.NewPgProcessedCommentRepository(newTestPgDb(t))
+	ctx := context.Background()
+
+	//the edit check compares the update time with the UTC edit times of reddit
+	updated := time.Date(2021, 4, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	pc := &mswkn.ProcessedComment{Name: testName("t1_"), Author: "user", ProcessedAt: updated, UpdatedAt: updated}
+	assert.NoError(t, repo.Add(ctx, pc))
+	defer func() {
+		assert.NoError(t, repo.Delete(ctx, pc.Name))
+	}()
+
+	got, err := repo.Get(ctx, pc.Name)
+	assert.NoError(t, err)
+	assert.True(t, updated.Equal(got.UpdatedAt), "got %s", got.UpdatedAt)
+	assert.True(t, updated.Equal(got.ProcessedAt), "got %s", got.ProcessedAt)
+}
+
+func TestPgPendingReplyRepository_replace(t *testing.T) {
+	repo := db.NewPgPendingReplyRepository(newTestPgDb(t))
+	ctx := context.Background()
+
+	//an edit replaces the pending edit of the comment but not its pending answer
+	now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	name := testName("t1_")
+	prs := []*mswkn.PendingReply{
+		{ID: testName("test-"), Name: name, Action: mswkn.PendingReplyActionComment, Target: name, NotBefore: now, CreatedAt: now},
+		{ID: testName("test-"), Name: name, Action: mswkn.PendingReplyActionEdit, Target: name, NotBefore: now, CreatedAt: now},
+	}
+	for _, pr := range prs {
+		assert.NoError(t, repo.Add(ctx, pr))
+	}
+	edit := &mswkn.PendingReply{ID: testName("test-"), Name: name, Action: mswkn.PendingReplyActionEdit, Target: name, NotBefore: now, CreatedAt: now}
+	assert.NoError(t, repo.Replace(ctx, edit))
+	defer func() {
+		_ = repo.Delete(ctx, prs[0].ID)
+		_ = repo.Delete(ctx, edit.ID)
+	}()
+
+	assert.ErrorIs(t, repo.Delete(ctx, prs[1].ID), mswkn.ErrPendingReplyNotFound)
+	assert.NoError(t, repo.Update(ctx, prs[0]))
+	assert.NoError(t, repo.Update(ctx, edit))
+}
@@ -0,0 +1,183 @@
+package integration
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/mswkn/bot"
+	"gitlab.com/mswkn/bot/pkg/broker"
+	"gitlab.com/mswkn/bot/pkg/config"
+	"gitlab.com/mswkn/bot/pkg/db"
+	"gitlab.com/mswkn/bot/pkg/infolinks"
+	"gitlab.com/mswkn/bot/pkg/listener"
+	"gitlab.com/mswkn/bot/pkg/onvista"
+	"gitlab.com/mswkn/bot/pkg/reddit"
+	"gitlab.com/mswkn/bot/pkg/reddit/reddittest"
+	"gitlab.com/mswkn/bot/pkg/responder"
+	"gitlab.com/mswkn/bot/pkg/scanner"
+	"gitlab.com/mswkn/bot/pkg/securities"
+	"strings"
+	"testing"
+	"time"
+)
+
+const pipelineSubReddit = "mauerstrassenwetten"
+
+type pipeline struct {
+	srv       *reddittest.Server
+	processed mswkn.ProcessedCommentRepository
+}
+
+//startPipeline runs all services against the fake reddit server with memory brokers and repositories
+func startPipeline(t *testing.T) *pipeline {
+	conf := config.Config{}
+	conf.Queue.Memory.Enabled = true
+	conf.Queue.Memory.Size = 10
+	conf.Reddit.Agent = "mswkn-test"
+	conf.Reddit.ClientID = "id"
+	conf.Reddit.ClientSecret = "secret"
+	conf.Reddit.Username = "mswkn_bot"
+	conf.Reddit.Password = "pass"
+	conf.Reddit.SubReddits = []string{pipelineSubReddit}
+	conf.Reddit.Mentions = true
+	conf.Reddit.Messages = true
+	conf.Reddit.EditCheckInterval = time.Millisecond * 500
+	conf.Reddit.EditCheckWindow = time.Hour
+	conf.Scan.Default = config.ScanConfig{
+		Keywords:   []string{"$WKN"},
+		Strategies: []string{scanner.StrategyKeyword, scanner.StrategyDollar},
+		Language:   "de",
+	}
+	conf.Responder.QueueMaxAttempts = 3
+
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := reddittest.NewServer()
+
+	secRepo := db.NewMemorySecurityRepository()
+	ilRepo := db.NewMemoryInfoLinkRepository()
+	for _, sec := range []*mswkn.Security{
+		{Name: "SAP SE", ISIN: "DE0007164600", WKN: "716460"},
+		{Name: "Apple Inc.", ISIN: "US0378331005", WKN: "865985"},
+	} {
+		require.NoError(t, secRepo.Add(ctx, sec))
+		//cached info links keep onvista out of the test
+		require.NoError(t, ilRepo.Add(ctx, &mswkn.InfoLink{WKN: sec.WKN, URL: "https://www.onvista.de/aktien/" + sec.WKN}))
+	}
+
+	p := &pipeline{
+		srv:       srv,
+		processed: db.NewMemoryProcessedCommentRepository(),
+	}
+	msg := broker.NewMemoryClient(conf)
+	client := reddit.NewClientWithHTTPClient(conf, srv.Client())
+
+	go scanner.NewScanner(conf, msg, db.NewMemoryAliasRepository()).Start(ctx)
+	go securities.NewService(msg, secRepo).Start(ctx)
+	go infolinks.NewService(msg, onvista.NewClient(), ilRepo).Start(ctx)
+	go responder.NewResponder(conf, msg, client, p.processed, db.NewMemoryPendingReplyRepository()).Start(ctx)
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		listener.NewListener(conf, client, msg, p.processed).Start(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+		srv.Close()
+	})
+
+	//graw skips the things of the first listing
+	require.Eventually(t, func() bool {
+		return srv.ListingRequests("/r/"+pipelineSubReddit+"/comments") >= 1 &&
+			srv.ListingRequests("/message/mentions") >= 1 &&
+			srv.ListingRequests("/message/inbox") >= 1
+	}, time.Second*10, time.Millisecond*20)
+	return p
+}
+
+//reply waits for the only reply to a comment
+func (p *pipeline) reply(t *testing.T, name string) *reddittest.Comment {
+	var replies []*reddittest.Comment
+	require.Eventually(t, func() bool {
+		replies = p.srv.Replies(name)
+		return len(replies) > 0
+	}, time.Second*15, time.Millisecond*50)
+	require.Len(t, replies, 1)
+	return replies[0]
+}
+
+func TestPipeline(t *testing.T) {
+	p := startPipeline(t)
+
+	name := p.srv.AddComment(pipelineSubReddit, "user", "$WKN 716460 sieht gut aus")
+	reply := p.reply(t, name)
+	assert.Equal(t, "mswkn_bot", reply.Author)
+	assert.Contains(t, reply.Body, "716460")
+	assert.Contains(t, reply.Body, "SAP SE")
+
+	assert.Eventually(t, func() bool {
+		pc, err := p.processed.Get(context.Background(), name)
+		return err == nil && pc.ReplyID == reply.Name
+	}, time.Second*5, time.Millisecond*20)
+
+	//the edit is usually in the same second as the reply, reddit reports edits in whole seconds
+	p.srv.EditComment(name, "doch lieber $WKN 865985")
+	assert.Eventually(t, func() bool {
+		return strings.Contains(p.srv.Comment(reply.Name).Body, "Apple Inc.")
+	}, time.Second*15, time.Millisecond*50)
+	assert.NotContains(t, p.srv.Comment(reply.Name).Body, "SAP SE")
+
+	//the own reply was streamed as well but is not answered
+	assert.Empty(t, p.srv.Replies(reply.Name))
+	assert.Len(t, p.srv.Replies(name), 1)
+}
+
+func TestPipeline_rateLimit(t *testing.T) {
+	p := startPipeline(t)
+
+	p.srv.RateLimitNext("you are doing that too much. try again in 1 second.")
+	name := p.srv.AddComment(pipelineSubReddit, "user", "$716460")
+	reply := p.reply(t, name)
+	assert.Contains(t, reply.Body, "SAP SE")
+}
+
+func TestPipeline_mention(t *testing.T) {
+	p := startPipeline(t)
+
+	//mentions in other subreddits need no keyword
+	name := p.srv.AddMention("wallstreetbets", "user", "u/mswkn_bot 716460")
+	reply := p.reply(t, name)
+	assert.Contains(t, reply.Body, "SAP SE")
+}
+
+func TestPipeline_message(t *testing.T) {
+	p := startPipeline(t)
+
+	p.srv.AddMessage("user", "Frage", "716460")
+	var msgs []*reddittest.Message
+	require.Eventually(t, func() bool {
+		msgs = p.srv.Messages()
+		return len(msgs) > 0
+	}, time.Second*15, time.Millisecond*50)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "user", msgs[0].To)
+	assert.Equal(t, "re: Frage", msgs[0].Subject)
+	assert.Contains(t, msgs[0].Body, "SAP SE")
+}
+
+func TestPipeline_mentionInWatchedSubreddit(t *testing.T) {
+	p := startPipeline(t)
+
+	//the mention is answered once from the comment stream, it needs no keyword either
+	name := p.srv.AddMention(pipelineSubReddit, "user", "u/mswkn_bot 716460")
+	reply := p.reply(t, name)
+	assert.Contains(t, reply.Body, "SAP SE")
+
+	//other users are no mention of the bot
+	name = p.srv.AddComment(pipelineSubReddit, "user", "u/mswkn_bot2 716460 $WKN 865985")
+	reply = p.reply(t, name)
+	assert.Contains(t, reply.Body, "Apple Inc.")
+	assert.NotContains(t, reply.Body, "SAP SE")
+}
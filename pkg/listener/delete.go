@@ -0,0 +1,111 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/turnage/graw/reddit"
+	"gitlab.com/mswkn/bot"
+	r "gitlab.com/mswkn/bot/pkg/reddit"
+	"strings"
+	"time"
+)
+
+//deleteCommand is answered to a reply of the bot by the author of the original comment to remove the reply
+const deleteCommand = "!delete"
+
+//CommentReply handles answers to replies of the bot, the author of the original comment can delete the reply
+func (c *commentListener) CommentReply(reply *reddit.Message) error {
+	lg := log.With().Str("comp", "listener").Str("name", reply.Name).Str("reply", reply.ParentID).Logger()
+	lg.Debug().Msgf("received reddit comment reply: %s", reply.Body)
+
+	if !strings.EqualFold(strings.TrimSpace(reply.Body), deleteCommand) {
+		return nil
+	}
+
+	ctx := context.Background()
+	pc, err := c.processed.GetByReply(ctx, reply.ParentID)
+	if err != nil {
+		if !errors.Is(err, mswkn.ErrProcessedCommentNotFound) {
+			lg.Error().Err(err).Msg("could not look up processed comment")
+		}
+		return nil
+	}
+
+	if !strings.EqualFold(pc.Author, reply.Author) {
+		lg.Info().Str("author", reply.Author).Msg("delete requested by someone else than the author")
+		return nil
+	}
+
+	deleteReply(ctx, lg, c.client, c.processed, pc)
+	return nil
+}
+
+//watchScores periodically deletes recent replies of the bot with a score at or below the threshold
+func (l *Listener) watchScores(ctx context.Context) {
+	lg := log.With().Str("comp", "listener").Str("job", "scores").Logger()
+
+	t := time.NewTicker(l.conf.Reddit.ScoreCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			l.checkScores(ctx, lg)
+		}
+	}
+}
+
+func (l *Listener) checkScores(ctx context.Context, lg zerolog.Logger) {
+	pcs, err := l.processed.List(ctx, time.Now().Add(-l.conf.Reddit.ScoreCheckWindow))
+	if err != nil {
+		lg.Error().Err(err).Msg("could not list processed comments")
+		return
+	}
+
+	byReply := make(map[string]*mswkn.ProcessedComment)
+	replies := make([]string, 0, len(pcs))
+	for _, pc := range pcs {
+		if pc.ReplyID == "" {
+			continue
+		}
+		byReply[pc.ReplyID] = pc
+		replies = append(replies, pc.ReplyID)
+	}
+	if len(replies) == 0 {
+		return
+	}
+
+	scores, err := l.client.Scores(replies)
+	if err != nil {
+		lg.Error().Err(err).Msg("could not fetch scores of replies")
+		return
+	}
+
+	for reply, score := range scores {
+		pc, ok := byReply[reply]
+		if !ok || score > l.conf.Reddit.ScoreThreshold {
+			continue
+		}
+		lg := lg.With().Str("name", pc.Name).Str("reply", reply).Int("score", score).Logger()
+		lg.Info().Msg("reply is below score threshold")
+		deleteReply(ctx, lg, l.client, l.processed, pc)
+	}
+}
+
+//deleteReply removes the reply of the bot and clears it in the processed comment record
+func deleteReply(ctx context.Context, lg zerolog.Logger, client r.RedditAPI, processed mswkn.ProcessedCommentRepository, pc *mswkn.ProcessedComment) {
+	if err := client.Delete(pc.ReplyID); err != nil {
+		lg.Error().Err(err).Msg("could not delete reply")
+		return
+	}
+	lg.Info().Msg("reddit reply deleted")
+
+	pc.ReplyID = ""
+	pc.UpdatedAt = time.Now()
+	if err := processed.Update(ctx, pc); err != nil {
+		lg.Error().Err(err).Msg("could not store deletion of reply")
+	}
+}
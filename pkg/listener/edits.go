@@ -0,0 +1,72 @@
+package listener
+
+import (
+	"context"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"gitlab.com/mswkn/bot"
+	"time"
+)
+
+//watchEdits periodically checks answered comments for edits and runs the pipeline again for them
+func (l *Listener) watchEdits(ctx context.Context) {
+	lg := log.With().Str("comp", "listener").Str("job", "edits").Logger()
+
+	t := time.NewTicker(l.conf.Reddit.EditCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			l.checkEdits(ctx, lg)
+		}
+	}
+}
+
+func (l *Listener) checkEdits(ctx context.Context, lg zerolog.Logger) {
+	pcs, err := l.processed.List(ctx, time.Now().Add(-l.conf.Reddit.EditCheckWindow))
+	if err != nil {
+		lg.Error().Err(err).Msg("could not list processed comments")
+		return
+	}
+
+	//private messages can not be edited and deleted replies are not restored
+	byName := make(map[string]*mswkn.ProcessedComment)
+	names := make([]string, 0, len(pcs))
+	for _, pc := range pcs {
+		if pc.ReplyID == "" {
+			continue
+		}
+		byName[pc.Name] = pc
+		names = append(names, pc.Name)
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	things, err := l.client.Info(names)
+	if err != nil {
+		lg.Error().Err(err).Msg("could not fetch processed comments")
+		return
+	}
+
+	for _, t := range things {
+		//reddit reports edits in whole seconds, an edit in the second of the last reply is processed again
+		pc, ok := byName[t.Name]
+		if !ok || t.Edited.IsZero() || t.Edited.Before(pc.UpdatedAt.Truncate(time.Second)) {
+			continue
+		}
+
+		lg := lg.With().Str("name", t.Name).Logger()
+		lg.Debug().Time("edited", t.Edited).Msg("answered comment was edited")
+		rt := mswkn.ReplyTarget{
+			Kind:    mswkn.ReplyKindComment,
+			Author:  t.Author,
+			ReplyID: pc.ReplyID,
+			//answered comments of other subreddits are mentions
+			Direct: !l.watches(t.Subreddit) || mentioned(t.Text, l.mention()),
+		}
+		publishRequest(lg, l.msg, t.Name, t.Subreddit, t.Text, rt)
+	}
+}
@@ -2,16 +2,51 @@ package listener
 
 import (
 	"context"
+	"errors"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/turnage/graw/reddit"
 	"gitlab.com/mswkn/bot"
 	"gitlab.com/mswkn/bot/pkg/config"
 	r "gitlab.com/mswkn/bot/pkg/reddit"
+	"gitlab.com/mswkn/bot/pkg/tracing"
+	"strings"
 )
 
 type commentListener struct {
+	client     r.RedditAPI
 	ignoreUser string
 	msg        mswkn.Broker
+	processed  mswkn.ProcessedCommentRepository
+	//subReddits are already watched for comments, mentions from there are skipped to avoid double replies
+	subReddits map[string]bool
+	//mention is the lower case "u/username" of the bot when mentions are answered, empty otherwise
+	mention string
+}
+
+//mentioned reports if the text contains the mention of the bot, the comment stream answers these like the mentions of
+//other subreddits
+func mentioned(text, mention string) bool {
+	if mention == "" {
+		return false
+	}
+	text = strings.ToLower(text)
+	for i := strings.Index(text, mention); i >= 0; {
+		end := i + len(mention)
+		if end == len(text) || !isUsernameChar(text[end]) {
+			return true
+		}
+		next := strings.Index(text[end:], mention)
+		if next < 0 {
+			break
+		}
+		i = end + next
+	}
+	return false
+}
+
+func isUsernameChar(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || b == '_' || b == '-'
 }
 
 func (c *commentListener) Comment(post *reddit.Comment) error {
@@ -23,46 +58,171 @@ func (c *commentListener) Comment(post *reddit.Comment) error {
 		return nil
 	}
 
+	rt := mswkn.ReplyTarget{Kind: mswkn.ReplyKindComment, Author: post.Author, Direct: mentioned(post.Body, c.mention)}
+	c.publish(lg, post.Name, post.Subreddit, post.Body, rt)
+	return nil
+}
+
+//Post handles new submissions, title and self text are scanned together
+func (c *commentListener) Post(post *reddit.Post) error {
+	lg := log.With().Str("comp", "listener").Str("name", post.Name).Logger()
+	lg.Debug().Msgf("received reddit post: %s", post.Title)
+
+	if post.Author == c.ignoreUser {
+		lg.Debug().Msg("got own post")
+		return nil
+	}
+
+	text := post.Title + "\n\n" + post.SelfText
+	rt := mswkn.ReplyTarget{Kind: mswkn.ReplyKindComment, Author: post.Author, Direct: mentioned(text, c.mention)}
+	c.publish(lg, post.Name, post.Subreddit, text, rt)
+	return nil
+}
+
+//Mention handles username mentions in comments of any subreddit, they are answered with a comment
+func (c *commentListener) Mention(mention *reddit.Message) error {
+	lg := log.With().Str("comp", "listener").Str("name", mention.Name).Logger()
+	lg.Debug().Msgf("received reddit mention: %s", mention.Body)
+
+	if mention.Author == c.ignoreUser {
+		lg.Debug().Msg("got own mention")
+		return nil
+	}
+
+	if c.subReddits[strings.ToLower(mention.Subreddit)] {
+		lg.Debug().Str("subreddit", mention.Subreddit).Msg("mention is in a watched subreddit, it is answered from the comment stream")
+		return nil
+	}
+
+	c.publish(lg, mention.Name, mention.Subreddit, mention.Body, mswkn.ReplyTarget{Kind: mswkn.ReplyKindComment, Author: mention.Author, Direct: true})
+	return nil
+}
+
+//Message handles private messages, they are answered with a private message
+func (c *commentListener) Message(pm *reddit.Message) error {
+	lg := log.With().Str("comp", "listener").Str("name", pm.Name).Logger()
+	lg.Debug().Msgf("received reddit message: %s", pm.Body)
+
+	if pm.Author == c.ignoreUser || pm.Author == "" {
+		lg.Debug().Msg("got own or system message")
+		return nil
+	}
+
+	rt := mswkn.ReplyTarget{
+		Kind:    mswkn.ReplyKindMessage,
+		Author:  pm.Author,
+		Subject: pm.Subject,
+		Direct:  true,
+	}
+	c.publish(lg, pm.Name, "", pm.Body, rt)
+	return nil
+}
+
+func (c *commentListener) publish(lg zerolog.Logger, name, subreddit, text string, rt mswkn.ReplyTarget) {
+	if _, err := c.processed.Get(context.Background(), name); err == nil {
+		lg.Debug().Msg("comment was already answered")
+		return
+	} else if !errors.Is(err, mswkn.ErrProcessedCommentNotFound) {
+		lg.Error().Err(err).Msg("could not check processed comments")
+	}
+
+	publishRequest(lg, c.msg, name, subreddit, text, rt)
+}
+
+//publishRequest starts the pipeline for a comment
+func publishRequest(lg zerolog.Logger, msg mswkn.Broker, name, subreddit, text string, rt mswkn.ReplyTarget) {
+	stage := tracing.StartStage(tracing.NewTrace(), "listener", name)
 	rc := &mswkn.RedditRequest{
-		Name: post.Name,
-		Text: post.Body,
+		SchemaVersion: mswkn.BrokerSchemaVersion,
+		Trace:         stage.Next(),
+		Name:          name,
+		Text:          text,
+		ReplyTarget:   rt,
+		Subreddit:     subreddit,
 	}
+	lg = lg.With().Str("request_id", rc.Trace.RequestID).Logger()
 	lg.Trace().Msg("sending RedditRequest")
-	if err := c.msg.Publish(mswkn.BrokerSubjectWKNRequest, rc); err != nil {
+	if err := msg.Publish(mswkn.BrokerSubjectWKNRequest, rc); err != nil {
 		lg.Error().Err(err).Msg("could not send RedditRequest")
-		return nil
+		stage.End(err)
+		return
 	}
 	lg.Trace().Msg("RedditRequest sent")
-	return nil
+	stage.End(nil)
 }
 
 type Listener struct {
-	client *r.Client
-	conf   config.Config
-	msg    mswkn.Broker
+	client    r.RedditAPI
+	conf      config.Config
+	msg       mswkn.Broker
+	processed mswkn.ProcessedCommentRepository
 }
 
-func NewListener(conf config.Config, client *r.Client, msg mswkn.Broker) *Listener {
+func NewListener(conf config.Config, client r.RedditAPI, msg mswkn.Broker, processed mswkn.ProcessedCommentRepository) *Listener {
 	l := &Listener{
-		client: client,
-		conf:   conf,
-		msg:    msg,
+		client:    client,
+		conf:      conf,
+		msg:       msg,
+		processed: processed,
 	}
 	return l
 }
 
+//watches reports if the comments or posts of a subreddit are streamed
+func (l *Listener) watches(subreddit string) bool {
+	for _, sr := range l.conf.Reddit.SubReddits {
+		if strings.EqualFold(sr, subreddit) {
+			return true
+		}
+	}
+	for _, sr := range l.conf.Reddit.PostSubReddits {
+		if strings.EqualFold(sr, subreddit) {
+			return true
+		}
+	}
+	return false
+}
+
+//mention returns how comments mention the bot, it is empty when mentions are not answered
+func (l *Listener) mention() string {
+	if !l.conf.Reddit.Mentions {
+		return ""
+	}
+	return "u/" + strings.ToLower(l.conf.Reddit.Username)
+}
+
 func (l *Listener) Start(ctx context.Context) {
+	subReddits := make(map[string]bool)
+	for _, sr := range l.conf.Reddit.SubReddits {
+		subReddits[strings.ToLower(sr)] = true
+	}
+
 	p := r.CommentHandlerParams{
 		Ctx: ctx,
 		Handler: &commentListener{
+			client:     l.client,
 			ignoreUser: l.conf.Reddit.Username,
 			msg:        l.msg,
+			processed:  l.processed,
+			subReddits: subReddits,
+			mention:    l.mention(),
 		},
-		SubReddits: l.conf.Reddit.SubReddits,
+		SubReddits:     l.conf.Reddit.SubReddits,
+		PostSubReddits: l.conf.Reddit.PostSubReddits,
+		Mentions:       l.conf.Reddit.Mentions,
+		Messages:       l.conf.Reddit.Messages,
+		CommentReplies: l.conf.Reddit.DeleteCommand,
 	}
 
 	start := l.client.RegisterCommentHandler(p)
 
+	if l.conf.Reddit.EditCheckInterval > 0 {
+		go l.watchEdits(ctx)
+	}
+	if l.conf.Reddit.ScoreCheckInterval > 0 {
+		go l.watchScores(ctx)
+	}
+
 	if err := start(); err != nil {
 		log.Fatal().Err(err).Str("comp", "listener").Msg("could not start reddit listener")
 	}
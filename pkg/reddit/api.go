@@ -0,0 +1,332 @@
+package reddit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/oauth2"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	apiURL      = "https://oauth.reddit.com"
+	apiTokenURL = "https://www.reddit.com/api/v1/access_token"
+)
+
+//apiScopes contains the edit scope which graw does not request
+var apiScopes = []string{"identity", "read", "edit", "history", "submit", "privatemessages"}
+
+//apiClient calls the reddit API for actions graw does not support, e.g. editing and deleting comments.
+//Replies are sent with it as well, because graw hides the rate limit headers.
+type apiClient struct {
+	baseURL string
+	agent   string
+	client  *http.Client
+
+	lock      sync.Mutex
+	rateLimit RateLimit
+}
+
+//RateLimit is the state of the API rate limit as reported by the X-Ratelimit headers of the last response
+type RateLimit struct {
+	//Remaining is the number of requests left in the current period
+	Remaining float64
+	//Used is the number of requests made in the current period
+	Used int
+	//Reset is the end of the current period
+	Reset time.Time
+}
+
+//Known reports if a response with rate limit headers was received
+func (r RateLimit) Known() bool {
+	return !r.Reset.IsZero()
+}
+
+//RateLimitError is returned when reddit rejects a request because of its rate limit
+type RateLimitError struct {
+	//Wait is the time until reddit accepts requests again
+	Wait    time.Duration
+	Message string
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("reddit rate limit, retry in %s: %s", e.Wait, e.Message)
+}
+
+func newAPIClient(baseURL, tokenURL, agent, clientID, clientSecret, username, password string, client *http.Client) *apiClient {
+	cfg := &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Endpoint: oauth2.Endpoint{
+			TokenURL:  tokenURL,
+			AuthStyle: oauth2.AuthStyleInHeader,
+		},
+		Scopes: apiScopes,
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, client)
+	ts := oauth2.ReuseTokenSource(nil, &passwordTokenSource{
+		ctx:      ctx,
+		cfg:      cfg,
+		username: username,
+		password: password,
+	})
+
+	a := &apiClient{
+		baseURL: baseURL,
+		agent:   agent,
+		client:  oauth2.NewClient(ctx, ts),
+		lock:    sync.Mutex{},
+	}
+	return a
+}
+
+//passwordTokenSource fetches a new token when the old one expired, reddit issues no refresh tokens for scripts
+type passwordTokenSource struct {
+	ctx      context.Context
+	cfg      *oauth2.Config
+	username string
+	password string
+}
+
+func (p *passwordTokenSource) Token() (*oauth2.Token, error) {
+	return p.cfg.PasswordCredentialsToken(p.ctx, p.username, p.password)
+}
+
+func (a *apiClient) post(ctx context.Context, path string, values url.Values) ([]byte, error) {
+	values.Set("api_type", "json")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.baseURL+path, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return a.do(req)
+}
+
+func (a *apiClient) get(ctx context.Context, path string, values url.Values) ([]byte, error) {
+	values.Set("raw_json", "1")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.baseURL+path+"?"+values.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return a.do(req)
+}
+
+func (a *apiClient) do(req *http.Request) ([]byte, error) {
+	req.Header.Set("User-Agent", a.agent)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	rl, ok := parseRateLimit(resp.Header, time.Now())
+	if ok {
+		a.lock.Lock()
+		a.rateLimit = rl
+		a.lock.Unlock()
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		wait := time.Minute
+		if ok {
+			wait = time.Until(rl.Reset)
+		}
+		if wait < minRateLimitWait {
+			wait = minRateLimitWait
+		}
+		return nil, &RateLimitError{Wait: wait, Message: fmt.Sprintf("%s %s: too many requests", req.Method, req.URL.Path)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: bad response code: %d", req.Method, req.URL.Path, resp.StatusCode)
+	}
+	return body, checkAPIErrors(body)
+}
+
+//minRateLimitWait is the shortest wait after a 429 response, the reset of the last response may already have passed
+const minRateLimitWait = time.Second
+
+//getRateLimit returns the rate limit state of the last response
+func (a *apiClient) getRateLimit() RateLimit {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.rateLimit
+}
+
+//parseRateLimit reads the X-Ratelimit headers, ok is false if the response has none
+func parseRateLimit(h http.Header, now time.Time) (rl RateLimit, ok bool) {
+	remaining, err := strconv.ParseFloat(h.Get("X-Ratelimit-Remaining"), 64)
+	if err != nil {
+		return rl, false
+	}
+	reset, err := strconv.Atoi(h.Get("X-Ratelimit-Reset"))
+	if err != nil {
+		return rl, false
+	}
+	used, _ := strconv.Atoi(h.Get("X-Ratelimit-Used"))
+
+	rl = RateLimit{
+		Remaining: remaining,
+		Used:      used,
+		Reset:     now.Add(time.Duration(reset) * time.Second),
+	}
+	return rl, true
+}
+
+//rateLimitWait matches the wait time of RATELIMIT errors, e.g. "you are doing that too much. try again in 6 minutes."
+var rateLimitWait = regexp.MustCompile(`(\d+) (millisecond|second|minute|hour)s?`)
+
+//parseRateLimitWait returns the wait time of a RATELIMIT error message, a minute if it has none
+func parseRateLimitWait(msg string) time.Duration {
+	m := rateLimitWait.FindStringSubmatch(msg)
+	if m == nil {
+		return time.Minute
+	}
+	n, _ := strconv.Atoi(m[1])
+	unit := map[string]time.Duration{
+		"millisecond": time.Millisecond,
+		"second":      time.Second,
+		"minute":      time.Minute,
+		"hour":        time.Hour,
+	}[m[2]]
+	return time.Duration(n) * unit
+}
+
+//checkAPIErrors returns the errors reddit reports with status code 200 for api_type=json
+func checkAPIErrors(body []byte) error {
+	var res struct {
+		JSON struct {
+			Errors [][]interface{} `json:"errors"`
+		} `json:"json"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil || len(res.JSON.Errors) == 0 {
+		return nil
+	}
+	msgs := make([]string, 0, len(res.JSON.Errors))
+	for _, e := range res.JSON.Errors {
+		parts := make([]string, 0, len(e))
+		for _, p := range e {
+			parts = append(parts, fmt.Sprint(p))
+		}
+		msg := strings.Join(parts, ": ")
+		if len(parts) > 1 && parts[0] == "RATELIMIT" {
+			return &RateLimitError{Wait: parseRateLimitWait(parts[1]), Message: msg}
+		}
+		msgs = append(msgs, msg)
+	}
+	return fmt.Errorf("reddit api error: %s", strings.Join(msgs, ", "))
+}
+
+//Thing is a comment or post as returned by the info endpoint
+type Thing struct {
+	Name      string
+	Author    string
+	Subreddit string
+	//Text is the body of a comment, or title and self text of a post
+	Text string
+	//Edited is the time of the last edit, it is zero for unedited things
+	Edited time.Time
+	Score  int
+}
+
+type apiThing struct {
+	Kind string `json:"kind"`
+	Data struct {
+		Name      string      `json:"name"`
+		Author    string      `json:"author"`
+		Subreddit string      `json:"subreddit"`
+		Body      string      `json:"body"`
+		Title     string      `json:"title"`
+		SelfText  string      `json:"selftext"`
+		Edited    interface{} `json:"edited"`
+		Score     int         `json:"score"`
+	} `json:"data"`
+}
+
+func (t *apiThing) toThing() *Thing {
+	th := &Thing{
+		Name:      t.Data.Name,
+		Author:    t.Data.Author,
+		Subreddit: t.Data.Subreddit,
+		Text:      t.Data.Body,
+		Score:     t.Data.Score,
+	}
+	if t.Kind == "t3" {
+		th.Text = t.Data.Title + "\n\n" + t.Data.SelfText
+	}
+	//edited is false or a unix timestamp
+	if edited, ok := t.Data.Edited.(float64); ok && edited > 0 {
+		th.Edited = time.Unix(int64(edited), 0)
+	}
+	return th
+}
+
+func (a *apiClient) info(ctx context.Context, names []string) ([]*Thing, error) {
+	body, err := a.get(ctx, "/api/info", url.Values{"id": {strings.Join(names, ",")}})
+	if err != nil {
+		return nil, err
+	}
+
+	var listing struct {
+		Data struct {
+			Children []*apiThing `json:"children"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &listing); err != nil {
+		return nil, fmt.Errorf("could not decode info listing: %w", err)
+	}
+
+	things := make([]*Thing, 0, len(listing.Data.Children))
+	for _, c := range listing.Data.Children {
+		things = append(things, c.toThing())
+	}
+	return things, nil
+}
+
+//comment replies to a thing and returns the name of the created comment
+func (a *apiClient) comment(ctx context.Context, name, text string) (string, error) {
+	body, err := a.post(ctx, "/api/comment", url.Values{
+		"thing_id": {name},
+		"text":     {text},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var res struct {
+		JSON struct {
+			Data struct {
+				Things []*apiThing `json:"things"`
+			} `json:"data"`
+		} `json:"json"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return "", fmt.Errorf("could not decode comment response: %w", err)
+	}
+	if len(res.JSON.Data.Things) == 0 {
+		return "", fmt.Errorf("comment response contains no comment")
+	}
+	return res.JSON.Data.Things[0].Data.Name, nil
+}
+
+//compose sends a private message
+func (a *apiClient) compose(ctx context.Context, user, subject, text string) error {
+	_, err := a.post(ctx, "/api/compose", url.Values{
+		"to":      {user},
+		"subject": {subject},
+		"text":    {text},
+	})
+	return err
+}
@@ -0,0 +1,144 @@
+package reddit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func newTestAPI(t *testing.T, handler http.HandlerFunc) *apiClient {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/access_token", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "password", r.PostForm.Get("grant_type"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"token","token_type":"bearer","expires_in":3600}`)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "agent", r.Header.Get("User-Agent"))
+		handler(w, r)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return newAPIClient(srv.URL, srv.URL+"/api/v1/access_token", "agent", "id", "secret", "user", "pass", srv.Client())
+}
+
+func TestAPIClientInfo(t *testing.T) {
+	api := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/info", r.URL.Path)
+		assert.Equal(t, "t1_a,t3_b", r.URL.Query().Get("id"))
+		fmt.Fprint(w, `{"kind":"Listing","data":{"children":[
+			{"kind":"t1","data":{"name":"t1_a","author":"foo","body":"$A1B2C3","edited":1617278400,"score":-4}},
+			{"kind":"t3","data":{"name":"t3_b","author":"bar","title":"title","selftext":"text","edited":false}}
+		]}}`)
+	})
+
+	things, err := api.info(context.Background(), []string{"t1_a", "t3_b"})
+	assert.NoError(t, err)
+	assert.Equal(t, []*Thing{
+		{Name: "t1_a", Author: "foo", Text: "$A1B2C3", Edited: time.Unix(1617278400, 0), Score: -4},
+		{Name: "t3_b", Author: "bar", Text: "title\n\ntext"},
+	}, things)
+}
+
+func TestAPIClientPostErrors(t *testing.T) {
+	api := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "json", r.PostForm.Get("api_type"))
+		assert.Equal(t, "t1_a", r.PostForm.Get("thing_id"))
+		fmt.Fprint(w, `{"json":{"errors":[["TOO_LONG","this is too long","text"]]}}`)
+	})
+
+	_, err := api.post(context.Background(), "/api/editusertext", url.Values{"thing_id": {"t1_a"}, "text": {"foo"}})
+	assert.EqualError(t, err, "reddit api error: TOO_LONG: this is too long: text")
+}
+
+func TestAPIClientComment(t *testing.T) {
+	api := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/comment", r.URL.Path)
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "t1_a", r.PostForm.Get("thing_id"))
+		assert.Equal(t, "text", r.PostForm.Get("text"))
+		w.Header().Set("X-Ratelimit-Remaining", "598.0")
+		w.Header().Set("X-Ratelimit-Used", "2")
+		w.Header().Set("X-Ratelimit-Reset", "300")
+		fmt.Fprint(w, `{"json":{"errors":[],"data":{"things":[{"kind":"t1","data":{"name":"t1_reply"}}]}}}`)
+	})
+
+	assert.False(t, api.getRateLimit().Known())
+	name, err := api.comment(context.Background(), "t1_a", "text")
+	assert.NoError(t, err)
+	assert.Equal(t, "t1_reply", name)
+
+	rl := api.getRateLimit()
+	assert.True(t, rl.Known())
+	assert.Equal(t, 598.0, rl.Remaining)
+	assert.Equal(t, 2, rl.Used)
+	assert.WithinDuration(t, time.Now().Add(time.Second*300), rl.Reset, time.Second*5)
+}
+
+func TestAPIClientRateLimitErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     int
+		header   string
+		body     string
+		wantWait time.Duration
+	}{
+		{
+			name:     "ratelimit error",
+			code:     http.StatusOK,
+			body:     `{"json":{"errors":[["RATELIMIT","you are doing that too much. try again in 6 minutes.","ratelimit"]]}}`,
+			wantWait: time.Minute * 6,
+		},
+		{
+			name:     "ratelimit error seconds",
+			code:     http.StatusOK,
+			body:     `{"json":{"errors":[["RATELIMIT","Looks like you've been doing that a lot. Take a break for 42 seconds before trying again.","ratelimit"]]}}`,
+			wantWait: time.Second * 42,
+		},
+		{
+			name:     "too many requests",
+			code:     http.StatusTooManyRequests,
+			header:   "120",
+			wantWait: time.Second * 120,
+		},
+		{
+			name:     "too many requests with passed reset",
+			code:     http.StatusTooManyRequests,
+			header:   "0",
+			wantWait: minRateLimitWait,
+		},
+		{
+			name:     "too many requests without header",
+			code:     http.StatusTooManyRequests,
+			wantWait: time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+				if tt.header != "" {
+					w.Header().Set("X-Ratelimit-Remaining", "0")
+					w.Header().Set("X-Ratelimit-Reset", tt.header)
+				}
+				w.WriteHeader(tt.code)
+				fmt.Fprint(w, tt.body)
+			})
+
+			_, err := api.comment(context.Background(), "t1_a", "text")
+			var rlErr *RateLimitError
+			assert.True(t, errors.As(err, &rlErr))
+			assert.InDelta(t, tt.wantWait.Seconds(), rlErr.Wait.Seconds(), 2)
+			assert.GreaterOrEqual(t, rlErr.Wait, minRateLimitWait)
+		})
+	}
+}
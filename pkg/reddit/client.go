@@ -7,14 +7,47 @@ import (
 	"github.com/turnage/graw/reddit"
 	"gitlab.com/mswkn/bot/pkg/config"
 	"net/http"
+	"net/url"
 	"time"
 )
 
+//RedditAPI is the part of the reddit API used by the listener and the responder, it is implemented by Client.
+//Tests use a Client connected to the fake reddit of the reddittest package.
+type RedditAPI interface {
+	//Reply comments on a thing and returns the name of the created comment
+	Reply(name, text string) (string, error)
+	//SendMessage sends a private message to a user
+	SendMessage(user, subject, text string) error
+	//Edit replaces the text of a comment of the bot
+	Edit(name, text string) error
+	//Delete removes a comment of the bot
+	Delete(name string) error
+	//Info fetches the current state of comments and posts by their names
+	Info(names []string) ([]*Thing, error)
+	//Scores fetches the current score of comments by their names
+	Scores(names []string) (map[string]int, error)
+	//RateLimit returns the API rate limit state of the last request
+	RateLimit() RateLimit
+	//RegisterCommentHandler streams new comments, posts and inbox messages to the handler until the context is done.
+	//The returned function blocks until the stream fails.
+	RegisterCommentHandler(p CommentHandlerParams) func() error
+}
+
 type Client struct {
 	bot reddit.Bot
+	api *apiClient
 }
 
 func NewClient(conf config.Config) *Client {
+	httpClient := &http.Client{
+		Timeout: time.Second * 15,
+	}
+	return NewClientWithHTTPClient(conf, httpClient)
+}
+
+//NewClientWithHTTPClient creates a client which sends all requests with the given http client,
+//e.g. the client of a reddittest.Server
+func NewClientWithHTTPClient(conf config.Config, httpClient *http.Client) *Client {
 	bCfg := reddit.BotConfig{
 		Agent: conf.Reddit.Agent,
 		App: reddit.App{
@@ -23,41 +56,145 @@ func NewClient(conf config.Config) *Client {
 			Username: conf.Reddit.Username,
 			Password: conf.Reddit.Password,
 		},
-		Client: &http.Client{
-			Timeout: time.Second * 15,
-		},
+		Client: httpClient,
 	}
 	bot, err := reddit.NewBot(bCfg)
 	if err != nil {
 		log.Fatal().Err(err).Msg("could not initialize bot")
 	}
 
-	c := &Client{bot: bot}
+	api := newAPIClient(
+		apiURL,
+		apiTokenURL,
+		conf.Reddit.Agent,
+		conf.Reddit.ClientID,
+		conf.Reddit.ClientSecret,
+		conf.Reddit.Username,
+		conf.Reddit.Password,
+		httpClient,
+	)
+
+	c := &Client{bot: bot, api: api}
 	return c
 }
 
 type CommentHandlerParams struct {
-	Ctx        context.Context
-	Handler    interface{}
+	Ctx     context.Context
+	Handler interface{}
+	//SubReddits are watched for new comments
 	SubReddits []string
+	//PostSubReddits are watched for new submissions, Handler has to implement a PostHandler then
+	PostSubReddits []string
+	//Mentions enables username mentions from the inbox, Handler has to implement a MentionHandler then
+	Mentions bool
+	//Messages enables private messages from the inbox, Handler has to implement a MessageHandler then
+	Messages bool
+	//CommentReplies enables replies to comments of the bot from the inbox, Handler has to implement a CommentReplyHandler then
+	CommentReplies bool
 }
 
-func (c *Client) Reply(name, text string) error {
+//Reply comments on a thing and returns the name of the created comment
+func (c *Client) Reply(name, text string) (string, error) {
 	lg := log.With().Str("comp", "reddit").Str("name", name).Logger()
 
 	lg.Debug().Msg("trying to sent comment")
-	if err := c.bot.Reply(name, text); err != nil {
+	reply, err := c.api.comment(context.Background(), name, text)
+	if err != nil {
+		return "", err
+	}
+	lg.Debug().Str("reply", reply).Msg("comment sent")
+
+	return reply, nil
+
+}
+
+//SendMessage sends a private message to a user
+func (c *Client) SendMessage(user, subject, text string) error {
+	lg := log.With().Str("comp", "reddit").Str("user", user).Logger()
+
+	lg.Debug().Msg("trying to sent private message")
+	if err := c.api.compose(context.Background(), user, subject, text); err != nil {
+		return err
+	}
+	lg.Debug().Msg("private message sent")
+
+	return nil
+}
+
+//Edit replaces the text of a comment of the bot
+func (c *Client) Edit(name, text string) error {
+	lg := log.With().Str("comp", "reddit").Str("name", name).Logger()
+
+	lg.Debug().Msg("trying to edit comment")
+	_, err := c.api.post(context.Background(), "/api/editusertext", url.Values{
+		"thing_id": {name},
+		"text":     {text},
+	})
+	if err != nil {
+		return err
+	}
+	lg.Debug().Msg("comment edited")
+
+	return nil
+}
+
+//Delete removes a comment of the bot
+func (c *Client) Delete(name string) error {
+	lg := log.With().Str("comp", "reddit").Str("name", name).Logger()
+
+	lg.Debug().Msg("trying to delete comment")
+	if _, err := c.api.post(context.Background(), "/api/del", url.Values{"id": {name}}); err != nil {
 		return err
 	}
-	lg.Debug().Msg("comment sent")
+	lg.Debug().Msg("comment deleted")
 
 	return nil
+}
+
+//Info fetches the current state of comments and posts by their names
+func (c *Client) Info(names []string) ([]*Thing, error) {
+	things := make([]*Thing, 0, len(names))
+	//the info endpoint accepts up to 100 names
+	for start := 0; start < len(names); start += 100 {
+		end := start + 100
+		if end > len(names) {
+			end = len(names)
+		}
+		t, err := c.api.info(context.Background(), names[start:end])
+		if err != nil {
+			return nil, err
+		}
+		things = append(things, t...)
+	}
+	return things, nil
+}
+
+//Scores fetches the current score of comments by their names
+func (c *Client) Scores(names []string) (map[string]int, error) {
+	things, err := c.Info(names)
+	if err != nil {
+		return nil, err
+	}
+	scores := make(map[string]int, len(things))
+	for _, t := range things {
+		scores[t.Name] = t.Score
+	}
+	return scores, nil
+}
 
+//RateLimit returns the API rate limit state of the last request, Reply and SendMessage return a *RateLimitError
+//when reddit rejects a request because of it
+func (c *Client) RateLimit() RateLimit {
+	return c.api.getRateLimit()
 }
 
 func (c *Client) RegisterCommentHandler(p CommentHandlerParams) func() error {
 	cfg := graw.Config{
 		SubredditComments: p.SubReddits,
+		Subreddits:        p.PostSubReddits,
+		Mentions:          p.Mentions,
+		Messages:          p.Messages,
+		CommentReplies:    p.CommentReplies,
 	}
 
 	stop, wait, err := graw.Run(p.Handler, c.bot, cfg)
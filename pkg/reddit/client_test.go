@@ -0,0 +1,96 @@
+package reddit
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/turnage/graw/reddit"
+	"gitlab.com/mswkn/bot/pkg/config"
+	"gitlab.com/mswkn/bot/pkg/reddit/reddittest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T) (*Client, *reddittest.Server) {
+	srv := reddittest.NewServer()
+	t.Cleanup(srv.Close)
+
+	conf := config.Config{}
+	conf.Reddit.Agent = "agent"
+	conf.Reddit.ClientID = "id"
+	conf.Reddit.ClientSecret = "secret"
+	conf.Reddit.Username = "bot"
+	conf.Reddit.Password = "pass"
+	return NewClientWithHTTPClient(conf, srv.Client()), srv
+}
+
+func TestClientReplies(t *testing.T) {
+	c, srv := newTestClient(t)
+	name := srv.AddComment("mauerstrassenwetten", "user", "$WKN A1B2C3")
+
+	reply, err := c.Reply(name, "reply")
+	assert.NoError(t, err)
+	assert.Equal(t, []*reddittest.Comment{srv.Comment(reply)}, srv.Replies(name))
+	assert.Equal(t, "bot", srv.Comment(reply).Author)
+	assert.True(t, c.RateLimit().Known())
+
+	assert.NoError(t, c.Edit(reply, "edited"))
+	things, err := c.Info([]string{reply})
+	assert.NoError(t, err)
+	assert.Len(t, things, 1)
+	assert.Equal(t, "edited", things[0].Text)
+	assert.False(t, things[0].Edited.IsZero())
+
+	assert.NoError(t, c.Delete(reply))
+	assert.True(t, srv.Comment(reply).Deleted)
+
+	assert.NoError(t, c.SendMessage("user", "re: WKNs", "message"))
+	assert.Equal(t, []*reddittest.Message{{From: "bot", To: "user", Subject: "re: WKNs", Body: "message"}}, srv.Messages())
+
+	srv.RateLimitNext("you are doing that too much. try again in 3 seconds.")
+	_, err = c.Reply(name, "reply")
+	var rlErr *RateLimitError
+	assert.True(t, errors.As(err, &rlErr))
+	assert.Equal(t, time.Second*3, rlErr.Wait)
+}
+
+type testCommentHandler struct {
+	lock     sync.Mutex
+	comments []string
+}
+
+func (h *testCommentHandler) Comment(c *reddit.Comment) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.comments = append(h.comments, c.Name+" "+c.Body)
+	return nil
+}
+
+func (h *testCommentHandler) received() []string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return append([]string{}, h.comments...)
+}
+
+func TestClientRegisterCommentHandler(t *testing.T) {
+	c, srv := newTestClient(t)
+	//comments before the start are not streamed
+	srv.AddComment("mauerstrassenwetten", "user", "old")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &testCommentHandler{}
+	wait := c.RegisterCommentHandler(CommentHandlerParams{Ctx: ctx, Handler: h, SubReddits: []string{"mauerstrassenwetten"}})
+
+	first := srv.AddComment("mauerstrassenwetten", "user", "first")
+	srv.AddComment("wallstreetbets", "user", "other subreddit")
+	second := srv.AddComment("Mauerstrassenwetten", "user", "second")
+
+	assert.Eventually(t, func() bool {
+		return len(h.received()) == 2
+	}, time.Second*10, time.Millisecond*50)
+	assert.ElementsMatch(t, []string{first + " first", second + " second"}, h.received())
+
+	cancel()
+	assert.NoError(t, wait())
+}
@@ -0,0 +1,559 @@
+//Package reddittest provides a fake reddit for tests without network. It serves the OAuth token endpoint,
+//comment listings of subreddits, the inbox of the bot and the endpoints the bot uses to answer.
+package reddittest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Token is the access token issued to every client
+const Token = "reddittest-token"
+
+//Comment is a comment on the fake reddit
+type Comment struct {
+	Name      string
+	ParentID  string
+	Subreddit string
+	Author    string
+	Body      string
+	Score     int
+	Created   time.Time
+	//Edited is zero for unedited comments
+	Edited  time.Time
+	Deleted bool
+}
+
+//Message is a private message sent on the fake reddit
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+//inboxMessage is a message in the inbox of the bot, mentions refer to a comment
+type inboxMessage struct {
+	name    string
+	author  string
+	subject string
+	body    string
+	created time.Time
+	//mention is the comment mentioning the bot, it is nil for private messages
+	mention *Comment
+}
+
+//Server is a fake reddit, its Client sends requests for any host to it
+type Server struct {
+	srv *httptest.Server
+
+	lock     sync.Mutex
+	comments []*Comment
+	messages []*Message
+	inbox    []*inboxMessage
+	ids      int
+	//username is the user of the last token request, comments and messages are sent as this user
+	username string
+	//rateLimitErrs are returned by the next comment and compose requests
+	rateLimitErrs []string
+	//listings is the number of served listings of each path
+	listings  map[string]int
+	remaining float64
+	used      int
+	reset     time.Duration
+}
+
+func NewServer() *Server {
+	s := &Server{
+		listings:  make(map[string]int),
+		remaining: 600,
+		reset:     time.Minute * 10,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/access_token", s.token)
+	mux.HandleFunc("/api/comment", s.authorized(s.comment))
+	mux.HandleFunc("/api/compose", s.authorized(s.compose))
+	mux.HandleFunc("/api/editusertext", s.authorized(s.edit))
+	mux.HandleFunc("/api/del", s.authorized(s.delete))
+	mux.HandleFunc("/api/info", s.authorized(s.info))
+	mux.HandleFunc("/", s.authorized(s.listing))
+	s.srv = httptest.NewServer(mux)
+	return s
+}
+
+//URL is the base URL of the fake reddit
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+//Client returns a http client which sends the requests for all hosts, e.g. oauth.reddit.com, to the fake reddit
+func (s *Server) Client() *http.Client {
+	target, _ := url.Parse(s.srv.URL)
+	return &http.Client{
+		Timeout: time.Second * 15,
+		Transport: &rewriteTransport{
+			target: target,
+			base:   s.srv.Client().Transport,
+		},
+	}
+}
+
+type rewriteTransport struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.URL.Scheme = t.target.Scheme
+	r.URL.Host = t.target.Host
+	r.Host = t.target.Host
+	return t.base.RoundTrip(r)
+}
+
+//AddComment posts a comment of author in a subreddit and returns its name
+func (s *Server) AddComment(subreddit, author, body string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.add("t3_thread", subreddit, author, body).Name
+}
+
+//AddMention posts a comment of author mentioning the bot in a subreddit, it is delivered to the inbox of the bot as
+//well. The name of the comment is returned.
+func (s *Server) AddMention(subreddit, author, body string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c := s.add("t3_thread", subreddit, author, body)
+	s.inbox = append(s.inbox, &inboxMessage{name: c.Name, author: author, body: body, created: c.Created, mention: c})
+	return c.Name
+}
+
+//AddMessage sends a private message of author to the bot and returns its name
+func (s *Server) AddMessage(author, subject, body string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.ids++
+	m := &inboxMessage{
+		name:    fmt.Sprintf("t4_%x", s.ids),
+		author:  author,
+		subject: subject,
+		body:    body,
+		created: time.Now(),
+	}
+	s.inbox = append(s.inbox, m)
+	return m.name
+}
+
+//EditComment replaces the text of a comment
+func (s *Server) EditComment(name, body string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if c := s.find(name); c != nil {
+		c.Body = body
+		c.Edited = time.Now()
+	}
+}
+
+//SetScore sets the score of a comment
+func (s *Server) SetScore(name string, score int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if c := s.find(name); c != nil {
+		c.Score = score
+	}
+}
+
+//Comment returns a copy of a comment, it is nil for unknown names
+func (s *Server) Comment(name string) *Comment {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c := s.find(name)
+	if c == nil {
+		return nil
+	}
+	cp := *c
+	return &cp
+}
+
+//Replies returns copies of the comments answering a thing, including deleted ones
+func (s *Server) Replies(parent string) []*Comment {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	replies := make([]*Comment, 0)
+	for _, c := range s.comments {
+		if c.ParentID == parent {
+			cp := *c
+			replies = append(replies, &cp)
+		}
+	}
+	return replies
+}
+
+//Messages returns copies of the sent private messages
+func (s *Server) Messages() []*Message {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	msgs := make([]*Message, 0, len(s.messages))
+	for _, m := range s.messages {
+		cp := *m
+		msgs = append(msgs, &cp)
+	}
+	return msgs
+}
+
+//ListingRequests returns the number of served listings of a path, e.g. /r/wallstreetbets/comments or
+///message/inbox. The listener ignores things older than its first listing, tests wait for it before adding them.
+func (s *Server) ListingRequests(path string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.listings[path]
+}
+
+//RateLimitNext rejects the next comment or private message with a RATELIMIT error,
+//e.g. "you are doing that too much. try again in 1 second."
+func (s *Server) RateLimitNext(msg string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.rateLimitErrs = append(s.rateLimitErrs, msg)
+}
+
+//SetRateLimit sets the X-Ratelimit headers of the following responses
+func (s *Server) SetRateLimit(remaining float64, reset time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.remaining = remaining
+	s.reset = reset
+}
+
+func (s *Server) add(parent, subreddit, author, body string) *Comment {
+	s.ids++
+	c := &Comment{
+		Name:      fmt.Sprintf("t1_%x", s.ids),
+		ParentID:  parent,
+		Subreddit: subreddit,
+		Author:    author,
+		Body:      body,
+		Score:     1,
+		Created:   time.Now(),
+	}
+	s.comments = append(s.comments, c)
+	return c
+}
+
+func (s *Server) find(name string) *Comment {
+	for _, c := range s.comments {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "password" {
+		http.Error(w, `{"error":"unsupported_grant_type"}`, http.StatusBadRequest)
+		return
+	}
+	if _, _, ok := r.BasicAuth(); !ok {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	s.lock.Lock()
+	s.username = r.PostForm.Get("username")
+	s.lock.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"access_token": Token,
+		"token_type":   "bearer",
+		"expires_in":   3600,
+		"scope":        r.PostForm.Get("scope"),
+	})
+}
+
+//authorized rejects requests without the token and sets the rate limit headers
+func (s *Server) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+Token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		s.lock.Lock()
+		s.used++
+		if s.remaining > 0 {
+			s.remaining--
+		}
+		w.Header().Set("X-Ratelimit-Remaining", strconv.FormatFloat(s.remaining, 'f', 1, 64))
+		w.Header().Set("X-Ratelimit-Used", strconv.Itoa(s.used))
+		w.Header().Set("X-Ratelimit-Reset", strconv.Itoa(int(s.reset.Seconds())))
+		s.lock.Unlock()
+
+		handler(w, r)
+	}
+}
+
+//listing serves the comments of subreddits at /r/<sub>+<sub>/comments and the inbox at /message/mentions and
+///message/inbox, other listings are empty
+func (s *Server) listing(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+	path := strings.TrimSuffix(r.URL.Path, ".json")
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 25
+	}
+
+	s.lock.Lock()
+	s.listings[path]++
+	//things are sorted oldest first, deleted things are nil but their names can still be a tip
+	var names []string
+	var things []map[string]interface{}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(parts) == 3 && parts[0] == "r" && parts[2] == "comments":
+		subs := make(map[string]bool)
+		for _, sub := range strings.Split(parts[1], "+") {
+			subs[strings.ToLower(sub)] = true
+		}
+		for _, c := range s.comments {
+			if !subs[strings.ToLower(c.Subreddit)] {
+				continue
+			}
+			names = append(names, c.Name)
+			if c.Deleted {
+				things = append(things, nil)
+			} else {
+				things = append(things, thingJSON(c))
+			}
+		}
+	case path == "/message/mentions" || path == "/message/inbox":
+		for _, m := range s.inbox {
+			if m.mention != nil || path == "/message/inbox" {
+				names = append(names, m.name)
+				things = append(things, inboxJSON(m))
+			}
+		}
+	}
+	s.lock.Unlock()
+
+	//listings are sorted newest first, before only returns things newer than the given one
+	children := make([]interface{}, 0)
+	before := r.URL.Query().Get("before")
+	found := before == ""
+	for i := len(things) - 1; i >= 0; i-- {
+		if names[i] == before {
+			found = true
+			break
+		}
+		if things[i] != nil && len(children) < limit {
+			children = append(children, things[i])
+		}
+	}
+	if !found {
+		children = children[:0]
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"kind": "Listing",
+		"data": map[string]interface{}{"children": children},
+	})
+}
+
+func (s *Server) info(w http.ResponseWriter, r *http.Request) {
+	children := make([]interface{}, 0)
+	s.lock.Lock()
+	for _, name := range strings.Split(r.URL.Query().Get("id"), ",") {
+		if c := s.find(name); c != nil {
+			children = append(children, thingJSON(c))
+		}
+	}
+	s.lock.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"kind": "Listing",
+		"data": map[string]interface{}{"children": children},
+	})
+}
+
+func (s *Server) comment(w http.ResponseWriter, r *http.Request) {
+	if !s.post(w, r) || s.rateLimited(w) {
+		return
+	}
+
+	s.lock.Lock()
+	parent := s.find(r.PostForm.Get("thing_id"))
+	if parent == nil || parent.Deleted {
+		s.lock.Unlock()
+		writeAPIError(w, "DELETED_COMMENT", "that comment has been deleted", "parent")
+		return
+	}
+	c := s.add(parent.Name, parent.Subreddit, s.username, r.PostForm.Get("text"))
+	thing := thingJSON(c)
+	s.lock.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"json": map[string]interface{}{
+			"errors": []interface{}{},
+			"data":   map[string]interface{}{"things": []interface{}{thing}},
+		},
+	})
+}
+
+func (s *Server) compose(w http.ResponseWriter, r *http.Request) {
+	if !s.post(w, r) || s.rateLimited(w) {
+		return
+	}
+
+	s.lock.Lock()
+	s.messages = append(s.messages, &Message{
+		From:    s.username,
+		To:      r.PostForm.Get("to"),
+		Subject: r.PostForm.Get("subject"),
+		Body:    r.PostForm.Get("text"),
+	})
+	s.lock.Unlock()
+
+	writeAPIErrors(w)
+}
+
+func (s *Server) edit(w http.ResponseWriter, r *http.Request) {
+	if !s.post(w, r) {
+		return
+	}
+
+	s.lock.Lock()
+	c := s.find(r.PostForm.Get("thing_id"))
+	if c == nil || c.Deleted || c.Author != s.username {
+		s.lock.Unlock()
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	c.Body = r.PostForm.Get("text")
+	c.Edited = time.Now()
+	s.lock.Unlock()
+
+	writeAPIErrors(w)
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request) {
+	if !s.post(w, r) {
+		return
+	}
+
+	s.lock.Lock()
+	if c := s.find(r.PostForm.Get("id")); c != nil && c.Author == s.username {
+		c.Deleted = true
+		c.Body = "[deleted]"
+		c.Author = "[deleted]"
+	}
+	s.lock.Unlock()
+
+	writeJSON(w, map[string]interface{}{})
+}
+
+//post parses the form of a POST request, it answers other methods with not found
+func (s *Server) post(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return false
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+//rateLimited answers with a queued RATELIMIT error
+func (s *Server) rateLimited(w http.ResponseWriter) bool {
+	s.lock.Lock()
+	if len(s.rateLimitErrs) == 0 {
+		s.lock.Unlock()
+		return false
+	}
+	msg := s.rateLimitErrs[0]
+	s.rateLimitErrs = s.rateLimitErrs[1:]
+	s.lock.Unlock()
+
+	writeAPIError(w, "RATELIMIT", msg, "ratelimit")
+	return true
+}
+
+func thingJSON(c *Comment) map[string]interface{} {
+	var edited interface{} = false
+	if !c.Edited.IsZero() {
+		edited = c.Edited.Unix()
+	}
+	return map[string]interface{}{
+		"kind": "t1",
+		"data": map[string]interface{}{
+			"id":          strings.TrimPrefix(c.Name, "t1_"),
+			"name":        c.Name,
+			"parent_id":   c.ParentID,
+			"link_id":     "t3_thread",
+			"subreddit":   c.Subreddit,
+			"author":      c.Author,
+			"body":        c.Body,
+			"score":       c.Score,
+			"ups":         c.Score,
+			"created_utc": c.Created.Unix(),
+			"edited":      edited,
+		},
+	}
+}
+
+//inboxJSON returns a message of the inbox, reddit returns mentions as comments with message fields
+func inboxJSON(m *inboxMessage) map[string]interface{} {
+	kind, subreddit := "t4", ""
+	if m.mention != nil {
+		kind, subreddit = "t1", m.mention.Subreddit
+	}
+	return map[string]interface{}{
+		"kind": kind,
+		"data": map[string]interface{}{
+			"id":          m.name[3:],
+			"name":        m.name,
+			"author":      m.author,
+			"subject":     m.subject,
+			"body":        m.body,
+			"subreddit":   subreddit,
+			"was_comment": m.mention != nil,
+			"new":         true,
+			"created_utc": m.created.Unix(),
+		},
+	}
+}
+
+func writeAPIErrors(w http.ResponseWriter) {
+	writeJSON(w, map[string]interface{}{
+		"json": map[string]interface{}{"errors": []interface{}{}},
+	})
+}
+
+func writeAPIError(w http.ResponseWriter, code, msg, field string) {
+	writeJSON(w, map[string]interface{}{
+		"json": map[string]interface{}{"errors": []interface{}{[]string{code, msg, field}}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,91 @@
+package responder
+
+import (
+	"gitlab.com/mswkn/bot"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/message/catalog"
+	"text/template"
+)
+
+//dateLayout is translated to the date format of a language
+const dateLayout = "2006-01-02"
+
+//translations of the english messages of the templates and labels
+var translations = map[language.Tag]map[string]string{
+	language.German: {
+		dateLayout:                           "02.01.2006",
+		"nothing found":                      "nix gefunden",
+		"Type":                               "Typ",
+		"Strike":                             "Basispreis",
+		"Expire":                             "Fälligkeit",
+		"Underlying":                         "Basiswert",
+		"Did you mean?":                      "Meintest du?",
+		"I am a bot":                         "ich bin ein bot",
+		"Comparison:":                        "Vergleich:",
+		"How I work:":                        "So funktioniere ich:",
+		"or":                                 "oder",
+		"name, type and links of WKNs":       "Name, Typ und Links zu WKNs",
+		"the same for ISINs":                 "dasselbe für ISINs",
+		"all details of a security":          "alle Angaben zu einem Wertpapier",
+		"up to five securities side by side": "bis zu fünf Wertpapiere nebeneinander",
+		"this help":                          "diese Hilfe",
+		"and %d more WKNs":                   "und %d weitere WKNs",
+		"Stock":                              "Aktie",
+		"Bond":                               "Anleihe",
+		"Warrant":                            "Optionsschein",
+	},
+}
+
+//languages are the supported languages of replies
+var languages = map[string]language.Tag{
+	mswkn.LanguageGerman:  language.German,
+	mswkn.LanguageEnglish: language.English,
+}
+
+//locale contains the printer and the template functions of a language
+type locale struct {
+	printer *message.Printer
+	funcs   template.FuncMap
+}
+
+var locales = newLocales()
+
+func newLocales() map[string]*locale {
+	b := catalog.NewBuilder(catalog.Fallback(language.English))
+	for tag, messages := range translations {
+		for key, msg := range messages {
+			if err := b.SetString(tag, key, msg); err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	locales := make(map[string]*locale, len(languages))
+	for lang, tag := range languages {
+		p := message.NewPrinter(tag, message.Catalog(b))
+		locales[lang] = &locale{
+			printer: p,
+			funcs: template.FuncMap{
+				//t translates a message of a template
+				"t": func(key string, args ...interface{}) string {
+					return p.Sprintf(key, args...)
+				},
+			},
+		}
+	}
+	return locales
+}
+
+//languageOf returns the language if it is supported, otherwise german
+func languageOf(lang string) string {
+	if _, ok := locales[lang]; ok {
+		return lang
+	}
+	return mswkn.LanguageGerman
+}
+
+//localeFor returns the locale of a language, unknown languages get the german locale
+func localeFor(lang string) *locale {
+	return locales[languageOf(lang)]
+}
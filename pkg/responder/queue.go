@@ -0,0 +1,259 @@
+package responder
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"gitlab.com/mswkn/bot"
+	"gitlab.com/mswkn/bot/pkg/config"
+	"gitlab.com/mswkn/bot/pkg/reddit"
+	"time"
+)
+
+const (
+	//queuePollInterval is the time between checks for due replies when no reply is queued
+	queuePollInterval = time.Second * 2
+	//queueLease hides a claimed reply from other responders while it is sent
+	queueLease = time.Minute * 2
+	//queueRetryBackoff is multiplied with the square of the failed attempts of a reply
+	queueRetryBackoff = time.Second * 10
+	//queueMaxRetryBackoff caps the delay of a failed reply, high QUEUE_MAX_ATTEMPTS would postpone replies for days
+	queueMaxRetryBackoff = time.Minute * 15
+	//rateLimitReserve requests are left to the listener, which shares the rate limit of the bot account
+	rateLimitReserve = 10
+)
+
+//replyClient sends the queued replies, it is the part of reddit.RedditAPI used by the queue
+type replyClient interface {
+	Reply(name, text string) (string, error)
+	SendMessage(user, subject, text string) error
+	Edit(name, text string) error
+	Delete(name string) error
+	RateLimit() reddit.RateLimit
+}
+
+//ReplyQueue sends the replies of the responder in order and waits when reddit limits the requests of the bot.
+//Pending replies are persisted in the repository, so they are sent after a restart.
+type ReplyQueue struct {
+	client      replyClient
+	repo        mswkn.PendingReplyRepository
+	processed   mswkn.ProcessedCommentRepository
+	maxAttempts int
+	notify      chan struct{}
+	//blockedUntil is set by a RATELIMIT error, it is only used by the sending goroutine
+	blockedUntil time.Time
+}
+
+func NewReplyQueue(conf config.Config, client replyClient, repo mswkn.PendingReplyRepository, processed mswkn.ProcessedCommentRepository) *ReplyQueue {
+	q := &ReplyQueue{
+		client:      client,
+		repo:        repo,
+		processed:   processed,
+		maxAttempts: conf.Responder.QueueMaxAttempts,
+		notify:      make(chan struct{}, 1),
+	}
+	if q.maxAttempts <= 0 {
+		q.maxAttempts = 1
+	}
+	return q
+}
+
+//Enqueue stores a reply, it is sent as soon as the rate limit allows
+func (q *ReplyQueue) Enqueue(ctx context.Context, pr *mswkn.PendingReply) error {
+	return q.store(ctx, pr, q.repo.Add)
+}
+
+//Replace stores an edit or delete of a reply instead of the pending ones of the same comment. The edit check publishes
+//an edit again on every poll until it is sent, the queue must not grow while the rate limit holds it back.
+func (q *ReplyQueue) Replace(ctx context.Context, pr *mswkn.PendingReply) error {
+	return q.store(ctx, pr, q.repo.Replace)
+}
+
+func (q *ReplyQueue) store(ctx context.Context, pr *mswkn.PendingReply, add func(ctx context.Context, pr *mswkn.PendingReply) error) error {
+	if pr.ID == "" {
+		pr.ID = newPendingReplyID()
+	}
+	if pr.CreatedAt.IsZero() {
+		pr.CreatedAt = time.Now()
+	}
+	if pr.NotBefore.IsZero() {
+		pr.NotBefore = pr.CreatedAt
+	}
+	if err := add(ctx, pr); err != nil {
+		return err
+	}
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+//Start sends the due replies until the context is done
+func (q *ReplyQueue) Start(ctx context.Context) {
+	lg := log.With().Str("comp", "responder").Str("part", "queue").Logger()
+	lg.Debug().Msg("starting reply queue")
+
+	for {
+		wait := q.sendNext(ctx, lg)
+		if wait <= 0 {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			lg.Info().Msg("stopping reply queue")
+			return
+		case <-q.notify:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+//sendNext sends the next due reply and returns the time to wait before the next send
+func (q *ReplyQueue) sendNext(ctx context.Context, lg zerolog.Logger) time.Duration {
+	now := time.Now()
+	if wait := q.rateLimitWait(now); wait > 0 {
+		lg.Debug().Dur("wait", wait).Msg("waiting for rate limit")
+		return wait
+	}
+
+	pr, err := q.repo.Claim(ctx, now, queueLease)
+	if err != nil {
+		if !errors.Is(err, mswkn.ErrPendingReplyNotFound) {
+			lg.Error().Err(err).Msg("could not claim pending reply")
+		}
+		return queuePollInterval
+	}
+	lg = lg.With().Str("name", pr.Name).Str("action", pr.Action).Str("id", pr.ID).Logger()
+
+	replyID, err := q.send(pr)
+	if err == nil {
+		q.sent(ctx, lg, pr, replyID)
+		return 0
+	}
+
+	var rlErr *reddit.RateLimitError
+	if errors.As(err, &rlErr) {
+		lg.Warn().Err(err).Msg("reddit rate limit reached")
+		q.blockedUntil = now.Add(rlErr.Wait)
+		//the claim returned the old send time, the reply keeps its place in the queue
+		if err := q.repo.Update(ctx, pr); err != nil {
+			lg.Error().Err(err).Msg("could not release pending reply")
+		}
+		return rlErr.Wait
+	}
+
+	pr.Attempts++
+	if pr.Attempts >= q.maxAttempts {
+		lg.Error().Err(err).Int("attempts", pr.Attempts).Msg("dropping reply")
+		q.drop(ctx, lg, pr)
+		return 0
+	}
+
+	lg.Error().Err(err).Int("attempts", pr.Attempts).Msg("could not send reply")
+	pr.NotBefore = now.Add(retryBackoff(pr.Attempts))
+	if err := q.repo.Update(ctx, pr); err != nil {
+		lg.Error().Err(err).Msg("could not postpone pending reply")
+	}
+	return 0
+}
+
+//retryBackoff returns the delay of a reply after its failed attempts
+func retryBackoff(attempts int) time.Duration {
+	//the attempts are limited before squaring them, the delay can not overflow
+	if attempts > 1000 {
+		attempts = 1000
+	}
+	delay := time.Duration(attempts*attempts) * queueRetryBackoff
+	if delay > queueMaxRetryBackoff {
+		return queueMaxRetryBackoff
+	}
+	return delay
+}
+
+//rateLimitWait returns the time until reddit accepts the next reply
+func (q *ReplyQueue) rateLimitWait(now time.Time) time.Duration {
+	if q.blockedUntil.After(now) {
+		return q.blockedUntil.Sub(now)
+	}
+	rl := q.client.RateLimit()
+	if rl.Known() && rl.Remaining < rateLimitReserve && rl.Reset.After(now) {
+		return rl.Reset.Sub(now)
+	}
+	return 0
+}
+
+//send executes the action of a reply and returns the name of a created comment
+func (q *ReplyQueue) send(pr *mswkn.PendingReply) (string, error) {
+	switch pr.Action {
+	case mswkn.PendingReplyActionComment:
+		return q.client.Reply(pr.Target, pr.Body)
+	case mswkn.PendingReplyActionMessage:
+		return "", q.client.SendMessage(pr.Target, pr.Subject, pr.Body)
+	case mswkn.PendingReplyActionEdit:
+		return "", q.client.Edit(pr.Target, pr.Body)
+	case mswkn.PendingReplyActionDelete:
+		return "", q.client.Delete(pr.Target)
+	}
+	return "", fmt.Errorf("unknown reply action: %s", pr.Action)
+}
+
+//sent removes a reply from the queue and stores it in the ledger of processed comments
+func (q *ReplyQueue) sent(ctx context.Context, lg zerolog.Logger, pr *mswkn.PendingReply, replyID string) {
+	lg.Info().Str("reply", replyID).Msg("reply sent")
+	if err := q.repo.Delete(ctx, pr.ID); err != nil {
+		lg.Error().Err(err).Msg("could not remove sent reply from queue")
+	}
+
+	pc, err := q.processed.Get(ctx, pr.Name)
+	if err != nil {
+		lg.Error().Err(err).Msg("could not get processed comment of reply")
+		return
+	}
+	switch pr.Action {
+	case mswkn.PendingReplyActionComment:
+		pc.ReplyID = replyID
+	case mswkn.PendingReplyActionEdit:
+		pc.WKNs = pr.WKNs
+	case mswkn.PendingReplyActionDelete:
+		pc.ReplyID = ""
+		pc.WKNs = pr.WKNs
+	}
+	pc.UpdatedAt = time.Now()
+	if err := q.processed.Update(ctx, pc); err != nil {
+		lg.Error().Err(err).Msg("could not store reply of processed comment")
+	}
+}
+
+//drop removes a reply which could not be sent, the claim of an unanswered comment is released
+func (q *ReplyQueue) drop(ctx context.Context, lg zerolog.Logger, pr *mswkn.PendingReply) {
+	if err := q.repo.Delete(ctx, pr.ID); err != nil {
+		lg.Error().Err(err).Msg("could not remove dropped reply from queue")
+	}
+	if pr.Action != mswkn.PendingReplyActionComment && pr.Action != mswkn.PendingReplyActionMessage {
+		return
+	}
+	if err := q.processed.Delete(ctx, pr.Name); err != nil {
+		lg.Error().Err(err).Msg("could not release claim of comment")
+	}
+}
+
+func newPendingReplyID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,235 @@
+package responder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/mswkn/bot"
+	"gitlab.com/mswkn/bot/pkg/config"
+	"gitlab.com/mswkn/bot/pkg/db"
+	"gitlab.com/mswkn/bot/pkg/reddit"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type fakeReplyClient struct {
+	calls     []string
+	errs      []error
+	rateLimit reddit.RateLimit
+}
+
+func (f *fakeReplyClient) call(call string) error {
+	f.calls = append(f.calls, call)
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func (f *fakeReplyClient) Reply(name, text string) (string, error) {
+	if err := f.call("reply " + name); err != nil {
+		return "", err
+	}
+	return "t1_re_" + name, nil
+}
+
+func (f *fakeReplyClient) SendMessage(user, subject, text string) error {
+	return f.call(fmt.Sprintf("message %s %s", user, subject))
+}
+
+func (f *fakeReplyClient) Edit(name, text string) error {
+	return f.call("edit " + name)
+}
+
+func (f *fakeReplyClient) Delete(name string) error {
+	return f.call("delete " + name)
+}
+
+func (f *fakeReplyClient) RateLimit() reddit.RateLimit {
+	return f.rateLimit
+}
+
+func newTestQueue(t *testing.T, client *fakeReplyClient, pending mswkn.PendingReplyRepository, names ...string) (*ReplyQueue, mswkn.ProcessedCommentRepository) {
+	processed := db.NewMemoryProcessedCommentRepository()
+	for _, name := range names {
+		assert.NoError(t, processed.Add(context.Background(), &mswkn.ProcessedComment{Name: name, ReplyID: "t1_old_" + name}))
+	}
+	conf := config.Config{}
+	conf.Responder.QueueMaxAttempts = 2
+	return NewReplyQueue(conf, client, pending, processed), processed
+}
+
+func TestReplyQueue_sendNext(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeReplyClient{}
+	pending := db.NewMemoryPendingReplyRepository()
+	q, processed := newTestQueue(t, client, pending, "t1_a", "t1_b", "t1_c", "t1_d")
+
+	created := time.Now().Add(-time.Minute)
+	assert.NoError(t, q.Enqueue(ctx, &mswkn.PendingReply{Name: "t1_a", Action: mswkn.PendingReplyActionComment, Target: "t1_a", CreatedAt: created}))
+	assert.NoError(t, q.Enqueue(ctx, &mswkn.PendingReply{Name: "t1_b", Action: mswkn.PendingReplyActionMessage, Target: "user", Subject: "re: WKN", CreatedAt: created.Add(time.Second)}))
+	assert.NoError(t, q.Enqueue(ctx, &mswkn.PendingReply{Name: "t1_c", Action: mswkn.PendingReplyActionEdit, Target: "t1_old_t1_c", WKNs: []string{"A1B2C3"}, CreatedAt: created.Add(time.Second * 2)}))
+	assert.NoError(t, q.Enqueue(ctx, &mswkn.PendingReply{Name: "t1_d", Action: mswkn.PendingReplyActionDelete, Target: "t1_old_t1_d", CreatedAt: created.Add(time.Second * 3)}))
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, time.Duration(0), q.sendNext(ctx, zerolog.Nop()))
+	}
+	assert.Equal(t, queuePollInterval, q.sendNext(ctx, zerolog.Nop()))
+	assert.Equal(t, []string{"reply t1_a", "message user re: WKN", "edit t1_old_t1_c", "delete t1_old_t1_d"}, client.calls)
+
+	stats, err := pending.Stats(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stats.Depth)
+
+	pc, err := processed.Get(ctx, "t1_a")
+	assert.NoError(t, err)
+	assert.Equal(t, "t1_re_t1_a", pc.ReplyID)
+	pc, err = processed.Get(ctx, "t1_c")
+	assert.NoError(t, err)
+	assert.Equal(t, "t1_old_t1_c", pc.ReplyID)
+	assert.Equal(t, []string{"A1B2C3"}, pc.WKNs)
+	pc, err = processed.Get(ctx, "t1_d")
+	assert.NoError(t, err)
+	assert.Equal(t, "", pc.ReplyID)
+}
+
+func TestReplyQueue_rateLimitError(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeReplyClient{errs: []error{&reddit.RateLimitError{Wait: time.Minute * 6}}}
+	pending := db.NewMemoryPendingReplyRepository()
+	q, processed := newTestQueue(t, client, pending, "t1_a", "t1_b")
+
+	created := time.Now().Add(-time.Minute)
+	assert.NoError(t, q.Enqueue(ctx, &mswkn.PendingReply{Name: "t1_a", Action: mswkn.PendingReplyActionComment, Target: "t1_a", CreatedAt: created}))
+	assert.NoError(t, q.Enqueue(ctx, &mswkn.PendingReply{Name: "t1_b", Action: mswkn.PendingReplyActionComment, Target: "t1_b", CreatedAt: created.Add(time.Second)}))
+
+	assert.Equal(t, time.Minute*6, q.sendNext(ctx, zerolog.Nop()))
+	wait := q.sendNext(ctx, zerolog.Nop())
+	assert.Greater(t, int64(wait), int64(time.Minute*5))
+	assert.Equal(t, []string{"reply t1_a"}, client.calls)
+
+	//rate limits do not count as failed attempts and keep the order
+	q.blockedUntil = time.Time{}
+	assert.Equal(t, time.Duration(0), q.sendNext(ctx, zerolog.Nop()))
+	assert.Equal(t, []string{"reply t1_a", "reply t1_a"}, client.calls)
+
+	pc, err := processed.Get(ctx, "t1_a")
+	assert.NoError(t, err)
+	assert.Equal(t, "t1_re_t1_a", pc.ReplyID)
+}
+
+func TestReplyQueue_rateLimitHeaders(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeReplyClient{rateLimit: reddit.RateLimit{Remaining: 3, Reset: time.Now().Add(time.Second * 30)}}
+	pending := db.NewMemoryPendingReplyRepository()
+	q, _ := newTestQueue(t, client, pending, "t1_a")
+	assert.NoError(t, q.Enqueue(ctx, &mswkn.PendingReply{Name: "t1_a", Action: mswkn.PendingReplyActionComment, Target: "t1_a"}))
+
+	wait := q.sendNext(ctx, zerolog.Nop())
+	assert.InDelta(t, (time.Second * 30).Seconds(), wait.Seconds(), 1)
+	assert.Empty(t, client.calls)
+
+	client.rateLimit.Remaining = 500
+	assert.Equal(t, time.Duration(0), q.sendNext(ctx, zerolog.Nop()))
+	assert.Equal(t, []string{"reply t1_a"}, client.calls)
+}
+
+func TestReplyQueue_dropAfterAttempts(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeReplyClient{errs: []error{errors.New("boom"), errors.New("boom")}}
+	pending := db.NewMemoryPendingReplyRepository()
+	q, processed := newTestQueue(t, client, pending, "t1_a")
+	assert.NoError(t, q.Enqueue(ctx, &mswkn.PendingReply{Name: "t1_a", Action: mswkn.PendingReplyActionComment, Target: "t1_a"}))
+
+	assert.Equal(t, time.Duration(0), q.sendNext(ctx, zerolog.Nop()))
+	//the failed reply is postponed
+	assert.Equal(t, queuePollInterval, q.sendNext(ctx, zerolog.Nop()))
+	assert.Len(t, client.calls, 1)
+
+	pr, err := pending.Claim(ctx, time.Now().Add(queueRetryBackoff), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pr.Attempts)
+	assert.NoError(t, pending.Update(ctx, &mswkn.PendingReply{ID: pr.ID, Attempts: pr.Attempts}))
+
+	assert.Equal(t, time.Duration(0), q.sendNext(ctx, zerolog.Nop()))
+	assert.Len(t, client.calls, 2)
+
+	stats, err := pending.Stats(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stats.Depth)
+	_, err = processed.Get(ctx, "t1_a")
+	assert.ErrorIs(t, err, mswkn.ErrProcessedCommentNotFound)
+}
+
+func Test_retryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: queueRetryBackoff},
+		{attempts: 3, want: queueRetryBackoff * 9},
+		{attempts: 10, want: queueMaxRetryBackoff},
+		{attempts: 1 << 40, want: queueMaxRetryBackoff},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.attempts), func(t *testing.T) {
+			assert.Equal(t, tt.want, retryBackoff(tt.attempts))
+		})
+	}
+}
+
+func TestReplyQueue_restart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pending := db.NewMemoryPendingReplyRepository()
+
+	//a reply queued by a stopped responder
+	assert.NoError(t, pending.Add(ctx, &mswkn.PendingReply{ID: "a", Name: "t1_a", Action: mswkn.PendingReplyActionComment, Target: "t1_a"}))
+
+	client := &fakeReplyClient{}
+	q, processed := newTestQueue(t, client, pending, "t1_a")
+	go q.Start(ctx)
+
+	assert.Eventually(t, func() bool {
+		pc, err := processed.Get(ctx, "t1_a")
+		return err == nil && pc.ReplyID == "t1_re_t1_a"
+	}, time.Second*2, time.Millisecond*10)
+}
+
+func TestReplyQueue_replaceEdits(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeReplyClient{rateLimit: reddit.RateLimit{Remaining: 3, Reset: time.Now().Add(time.Second * 30)}}
+	pending := db.NewMemoryPendingReplyRepository()
+	q, processed := newTestQueue(t, client, pending, "t1_a", "t1_b")
+	s := &Responder{processed: processed, queue: q}
+	assert.NoError(t, q.Enqueue(ctx, &mswkn.PendingReply{Name: "t1_b", Action: mswkn.PendingReplyActionComment, Target: "t1_b"}))
+
+	//the edit check publishes the edit on every poll while the rate limit holds the queue back
+	edit := func(wkns ...string) {
+		rrr := &mswkn.RedditReplyRequest{Name: "t1_a", WKNs: wkns, ReplyTarget: mswkn.ReplyTarget{ReplyID: "t1_old_t1_a"}}
+		assert.NoError(t, s.edit(ctx, rrr, "body"))
+		assert.Greater(t, int64(q.sendNext(ctx, zerolog.Nop())), int64(0))
+	}
+	edit("A1B2C3")
+	edit("A1B2C3", "D4E5F6")
+
+	stats, err := pending.Stats(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.Depth)
+
+	client.rateLimit.Remaining = 500
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, time.Duration(0), q.sendNext(ctx, zerolog.Nop()))
+	}
+	assert.Equal(t, queuePollInterval, q.sendNext(ctx, zerolog.Nop()))
+	assert.ElementsMatch(t, []string{"reply t1_b", "edit t1_old_t1_a"}, client.calls)
+
+	pc, err := processed.Get(ctx, "t1_a")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"A1B2C3", "D4E5F6"}, pc.WKNs)
+}
@@ -3,31 +3,43 @@ package responder
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/rs/zerolog/log"
 	"gitlab.com/mswkn/bot"
+	"gitlab.com/mswkn/bot/pkg/config"
 	"gitlab.com/mswkn/bot/pkg/reddit"
-	"golang.org/x/text/language"
+	"gitlab.com/mswkn/bot/pkg/tracing"
 	"golang.org/x/text/message"
 	"os"
 	"strings"
 	"text/template"
 	"time"
+	"unicode/utf8"
 )
 
-var tDefault = template.Must(template.New("default").Parse(replyTmpl))
-
-var dePrinter = message.NewPrinter(language.German)
-
 type Responder struct {
-	client *reddit.Client
-	msg    mswkn.Broker
+	conf      config.Config
+	msg       mswkn.Broker
+	processed mswkn.ProcessedCommentRepository
+	templates *Templates
+	queue     *ReplyQueue
 }
 
-func NewResponder(msg mswkn.Broker, client *reddit.Client) *Responder {
+func NewResponder(conf config.Config, msg mswkn.Broker, client reddit.RedditAPI, processed mswkn.ProcessedCommentRepository, pending mswkn.PendingReplyRepository) *Responder {
+	lg := log.With().Str("comp", "responder").Logger()
+
+	templates, err := NewTemplates(conf.Responder.TemplateDir, conf.TemplateSets()...)
+	if err != nil {
+		lg.Fatal().Err(err).Str("dir", conf.Responder.TemplateDir).Msg("invalid reply templates")
+	}
+
 	r := &Responder{
-		client: client,
-		msg:    msg,
+		conf:      conf,
+		msg:       msg,
+		processed: processed,
+		templates: templates,
+		queue:     NewReplyQueue(conf, client, pending, processed),
 	}
 	return r
 }
@@ -35,18 +47,22 @@ func NewResponder(msg mswkn.Broker, client *reddit.Client) *Responder {
 func (s *Responder) Start(ctx context.Context) {
 	lg := log.With().Str("comp", "responder").Logger()
 
-	handler := func(rrr *mswkn.RedditReplyRequest) {
-		lg := lg.With().Str("name", rrr.Name).Logger()
+	handler := func(rrr *mswkn.RedditReplyRequest) (err error) {
+		lg := lg.With().Str("name", rrr.Name).Str("request_id", rrr.Trace.RequestID).Logger()
 		lg.Debug().Msgf("received RedditReplyRequest: %+v", rrr)
+		stage := tracing.StartStage(rrr.Trace, "responder", rrr.Name)
+		defer func() { stage.EndPipeline(err) }()
 
-		body, err := renderReply(rrr)
+		body, err := renderReply(s.templates, rrr)
 		if err != nil {
+			//the request is retried and not marked as answered, an empty reply is never sent
 			lg.Error().Err(err).Msg("could not render response")
+			return err
 		}
 
 		if os.Getenv("RESPOND_DRY_MODE") == "1" {
 			log.Info().Str("respond", "RESPOND_DRY_MODE").Msg(body)
-			return
+			return nil
 		}
 
 		lg.Trace().Str("body", body).Msg("rendered response")
@@ -55,52 +71,201 @@ func (s *Responder) Start(ctx context.Context) {
 			fmt.Println(body)
 		}
 
-		lg.Trace().Msg("sending reddit reply")
-		if err := s.client.Reply(rrr.Name, body); err != nil {
-			lg.Error().Err(err).Msg("could not send response")
-			return
+		if rrr.ReplyTarget.IsEdit() {
+			return s.edit(ctx, rrr, body)
 		}
-		lg.Info().Msg("reddit reply sent")
+
+		pc := &mswkn.ProcessedComment{
+			Name:        rrr.Name,
+			Author:      rrr.ReplyTarget.Author,
+			WKNs:        rrr.WKNs,
+			ProcessedAt: time.Now(),
+			UpdatedAt:   time.Now(),
+		}
+		if err := s.processed.Add(ctx, pc); err != nil {
+			if errors.Is(err, mswkn.ErrProcessedCommentExists) {
+				lg.Info().Msg("comment was already answered")
+				return nil
+			}
+			lg.Error().Err(err).Msg("could not claim comment")
+			return err
+		}
+
+		if err := s.queue.Enqueue(ctx, newPendingReply(rrr, body)); err != nil {
+			lg.Error().Err(err).Msg("could not queue response")
+			if dErr := s.processed.Delete(ctx, rrr.Name); dErr != nil {
+				lg.Error().Err(dErr).Msg("could not release claim of comment")
+			}
+			return err
+		}
+		lg.Debug().Msg("response queued")
+		return nil
 	}
 
-	err := s.msg.Subscribe(mswkn.BrokerSubjectRedditRepplyRequest, handler)
+	go s.queue.Start(ctx)
+
+	if s.conf.Responder.TemplateDir != "" && s.conf.Responder.TemplateReloadInterval > 0 {
+		go s.templates.Watch(ctx, s.conf.Responder.TemplateReloadInterval)
+	}
+
+	err := s.msg.QueueSubscribe(mswkn.BrokerSubjectRedditRepplyRequest, mswkn.BrokerQueueResponder, handler)
 	if err != nil {
-		lg.Fatal().Err(err).Str("subject", mswkn.BrokerSubjectRedditRepplyRequest).Msg("could not subscribe to subject")
+		lg.Fatal().Err(err).Str("subject", mswkn.BrokerSubjectRedditRepplyRequest).Str("queue", mswkn.BrokerQueueResponder).Msg("could not subscribe to subject")
 	}
 
 	<-ctx.Done()
 }
 
-func renderReply(rrr *mswkn.RedditReplyRequest) (string, error) {
-	replies := getReplyLines(rrr)
-	buf := &bytes.Buffer{}
-	err := tDefault.Execute(buf, replies)
+//edit updates the existing reply of an edited comment, the reply is deleted if the comment contains no WKNs or command any more
+func (s *Responder) edit(ctx context.Context, rrr *mswkn.RedditReplyRequest, body string) error {
+	lg := log.With().Str("comp", "responder").Str("name", rrr.Name).Str("reply", rrr.ReplyTarget.ReplyID).Str("request_id", rrr.Trace.RequestID).Logger()
+
+	pc, err := s.processed.Get(ctx, rrr.Name)
 	if err != nil {
-		return "", fmt.Errorf("could not execute template: %w", err)
+		if errors.Is(err, mswkn.ErrProcessedCommentNotFound) {
+			lg.Warn().Msg("edited comment was never answered")
+			return nil
+		}
+		return err
 	}
-	return buf.String(), nil
+	if pc.ReplyID != rrr.ReplyTarget.ReplyID {
+		lg.Info().Msg("reply was already deleted or replaced")
+		return nil
+	}
+
+	pr := &mswkn.PendingReply{
+		Name:   rrr.Name,
+		Action: mswkn.PendingReplyActionEdit,
+		Target: pc.ReplyID,
+		Body:   body,
+		WKNs:   rrr.WKNs,
+	}
+	if len(rrr.WKNs) == 0 && rrr.Command == mswkn.CommandLookup {
+		pr.Action = mswkn.PendingReplyActionDelete
+		pr.Body = ""
+	}
+	if err := s.queue.Replace(ctx, pr); err != nil {
+		lg.Error().Err(err).Msg("could not queue edit of reply")
+		return err
+	}
+	lg.Debug().Str("action", pr.Action).Msg("edit of reply queued")
+	return nil
 }
 
-const replyTmpl = `
-**WKNs:**
+//newPendingReply answers with a private message or a comment, depending on the reply target
+func newPendingReply(rrr *mswkn.RedditReplyRequest, body string) *mswkn.PendingReply {
+	pr := &mswkn.PendingReply{
+		Name:   rrr.Name,
+		Action: mswkn.PendingReplyActionComment,
+		Target: rrr.Name,
+		Body:   body,
+		WKNs:   rrr.WKNs,
+	}
+	if rrr.ReplyTarget.IsMessage() {
+		pr.Action = mswkn.PendingReplyActionMessage
+		pr.Target = rrr.ReplyTarget.Author
+		pr.Subject = messageSubject(rrr.ReplyTarget.Subject)
+	}
+	return pr
+}
+
+//messageSubject builds the subject of a private message answer
+func messageSubject(subject string) string {
+	subject = strings.TrimSpace(subject)
+	if subject == "" {
+		return "WKNs"
+	}
+	if strings.HasPrefix(strings.ToLower(subject), "re:") {
+		return subject
+	}
+	return "re: " + subject
+}
 
-{{range . -}} 
-{{.SecURL}} - {{.Name}}
+//Reply is the data of the reply templates
+type Reply struct {
+	Lines       []*ReplyLine
+	Suggestions []*SuggestionLine
+	//Cards are only set for the details and compare commands
+	Cards []*DetailCard
+	//More is the number of WKNs omitted because of the size limit of replies
+	More int
+}
+
+func renderReply(templates *Templates, rrr *mswkn.RedditReplyRequest) (string, error) {
+	lang := languageOf(rrr.ReplyTarget.Language)
+	tmpl, err := templates.get(templateSetOf(rrr), lang, rrr.Command)
+	if err != nil {
+		return "", err
+	}
 
+	body, err := executeTemplate(tmpl, localeFor(lang), rrr, 0)
+	if err != nil || utf8.RuneCountInString(body) <= maxBodyLength {
+		return body, err
+	}
+	return truncateReply(tmpl, localeFor(lang), rrr)
+}
 
-{{end}}
+//maxBodyLength is the maximum number of characters of a reddit comment or private message
+const maxBodyLength = 10_000
+
+//truncateReply renders as many WKNs as fit into a reply, the template summarizes the omitted ones.
+//The body is cut if not even a single WKN fits, e.g. because of a large custom template.
+func truncateReply(tmpl *template.Template, loc *locale, rrr *mswkn.RedditReplyRequest) (string, error) {
+	body := ""
+	//binary search for the most WKNs which fit, all of them are known to be too long
+	low, high := 0, len(rrr.WKNs)-1
+	for low <= high {
+		n := (low + high) / 2
+		part := *rrr
+		part.WKNs = rrr.WKNs[:n]
+		b, err := executeTemplate(tmpl, loc, &part, len(rrr.WKNs)-n)
+		if err != nil {
+			return "", err
+		}
+		if utf8.RuneCountInString(b) <= maxBodyLength {
+			body = b
+			low = n + 1
+		} else {
+			high = n - 1
+		}
+	}
+	if body != "" {
+		return body, nil
+	}
 
+	b, err := executeTemplate(tmpl, loc, rrr, 0)
+	if err != nil {
+		return "", err
+	}
+	return string([]rune(b)[:maxBodyLength]), nil
+}
 
-**Details:**
+//templateSetOf returns the name of the template set of a request
+func templateSetOf(rrr *mswkn.RedditReplyRequest) string {
+	if rrr.ReplyTarget.Template == "" {
+		return DefaultTemplateSet
+	}
+	return rrr.ReplyTarget.Template
+}
 
-|**WKN**|**Name**|**Type**|**Strike**|**Expire**|**Underlying**|
-|:-|:-|:-|-:|:-|:-|:-|:-|
-{{range . -}} 
-|{{.SecURL}}|{{.Name}}|{{.Type}}|{{.Strike}}|{{.Expire}}|{{.Underlying}}|
-{{end}}
+//executeTemplate renders the reply of a request, more is the number of omitted WKNs
+func executeTemplate(tmpl *template.Template, loc *locale, rrr *mswkn.RedditReplyRequest, more int) (string, error) {
+	reply := &Reply{
+		More:        more,
+		Lines:       getReplyLines(rrr, loc.printer),
+		Suggestions: getSuggestionLines(rrr),
+	}
+	if rrr.Command == mswkn.CommandDetails || rrr.Command == mswkn.CommandCompare {
+		reply.Cards = getDetailCards(rrr, reply.Lines)
+	}
 
-^(ich bin ein bot)
-`
+	buf := &bytes.Buffer{}
+	err := tmpl.Execute(buf, reply)
+	if err != nil {
+		return "", fmt.Errorf("could not execute template: %w", err)
+	}
+	return buf.String(), nil
+}
 
 type ReplyLine struct {
 	SecURL     string
@@ -111,7 +276,7 @@ type ReplyLine struct {
 	Underlying string
 }
 
-func getReplyLines(rrr *mswkn.RedditReplyRequest) []*ReplyLine {
+func getReplyLines(rrr *mswkn.RedditReplyRequest, p *message.Printer) []*ReplyLine {
 	replies := make([]*ReplyLine, 0)
 	for _, wkn := range rrr.WKNs {
 		sec, secFound := rrr.Securities[wkn]
@@ -119,7 +284,7 @@ func getReplyLines(rrr *mswkn.RedditReplyRequest) []*ReplyLine {
 
 		if !secFound {
 			sec = &mswkn.Security{
-				Name: "nix gefunden",
+				Name: p.Sprintf("nothing found"),
 				WKN:  wkn,
 			}
 		}
@@ -130,7 +295,7 @@ func getReplyLines(rrr *mswkn.RedditReplyRequest) []*ReplyLine {
 			}
 		}
 
-		rl := buildReplyLine(sec, il)
+		rl := buildReplyLine(sec, il, p)
 
 		if strings.TrimSpace(sec.Underlying) != "" {
 			var underlying string
@@ -152,23 +317,77 @@ func getReplyLines(rrr *mswkn.RedditReplyRequest) []*ReplyLine {
 	return replies
 }
 
-func buildReplyLine(sec *mswkn.Security, il *mswkn.InfoLink) *ReplyLine {
+//DetailCard extends a reply line with the identifiers of the security
+type DetailCard struct {
+	*ReplyLine
+	ISIN   string
+	Ticker string
+}
+
+func getDetailCards(rrr *mswkn.RedditReplyRequest, lines []*ReplyLine) []*DetailCard {
+	cards := make([]*DetailCard, 0, len(lines))
+	for i, wkn := range rrr.WKNs {
+		card := &DetailCard{ReplyLine: lines[i]}
+		if sec, ok := rrr.Securities[wkn]; ok {
+			card.ISIN = sec.ISIN
+			card.Ticker = sec.Ticker
+		}
+		cards = append(cards, card)
+	}
+	return cards
+}
+
+//SuggestionLine lists the similar WKNs of an unknown WKN
+type SuggestionLine struct {
+	WKN         string
+	Suggestions string
+}
+
+func getSuggestionLines(rrr *mswkn.RedditReplyRequest) []*SuggestionLine {
+	lines := make([]*SuggestionLine, 0)
+	for _, wkn := range rrr.WKNs {
+		sugs, ok := rrr.Suggestions[wkn]
+		if !ok || len(sugs) == 0 {
+			continue
+		}
+
+		texts := make([]string, 0, len(sugs))
+		for _, sug := range sugs {
+			text := sug
+			if il, ok := rrr.InfoLinks[sug]; ok {
+				text = infoLinkURL(sug, il.URL)
+			}
+			if sec, ok := rrr.Securities[sug]; ok {
+				text = fmt.Sprintf("%s (%s)", text, sec.Name)
+			}
+			texts = append(texts, text)
+		}
+
+		lines = append(lines, &SuggestionLine{
+			WKN:         wkn,
+			Suggestions: strings.Join(texts, ", "),
+		})
+	}
+	return lines
+}
+
+func buildReplyLine(sec *mswkn.Security, il *mswkn.InfoLink, p *message.Printer) *ReplyLine {
 	rl := &ReplyLine{
 		SecURL:     infoLinkURL(il.WKN, il.URL),
 		Name:       sec.Name,
-		Type:       getTypeText(sec),
+		Type:       getTypeText(sec, p),
 		Underlying: sec.Underlying,
 	}
 
 	if sec.Strike > 0 {
-		rl.Strike = dePrinter.Sprintf("%.2f", sec.Strike)
+		rl.Strike = p.Sprintf("%.2f", sec.Strike)
 	}
 
 	if sec.Expire != nil {
 		future := time.Now().Add(time.Hour * 24 * 365 * 20)
 
 		if sec.Expire.Unix() < future.Unix() {
-			rl.Expire = sec.Expire.Format("2006-01-02")
+			rl.Expire = sec.Expire.Format(p.Sprintf(dateLayout))
 		}
 	}
 
@@ -182,7 +401,8 @@ func infoLinkURL(text, url string) string {
 	return text
 }
 
-func getTypeText(sec *mswkn.Security) string {
+//getTypeText returns the translated type label of a security
+func getTypeText(sec *mswkn.Security, p *message.Printer) string {
 	if sec.Type == mswkn.SecurityTypeWarrant {
 		return fmt.Sprintf("%s %s",
 			getWarrantSubType(sec.WarrantSubType),
@@ -190,7 +410,7 @@ func getTypeText(sec *mswkn.Security) string {
 		)
 	}
 
-	return getType(sec.Type)
+	return p.Sprintf(getType(sec.Type))
 }
 
 func getWarrantSubType(wType int) string {
@@ -1,9 +1,13 @@
 package responder
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"gitlab.com/mswkn/bot"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 )
 
 func Test_getReplyLines(t *testing.T) {
@@ -96,7 +100,7 @@ func Test_getReplyLines(t *testing.T) {
 				{
 					SecURL:     "[CCCCCC](CCCCCC-URL)",
 					Name:       "c",
-					Type:       "Stock",
+					Type:       "Aktie",
 					Strike:     "",
 					Expire:     "",
 					Underlying: "",
@@ -122,8 +126,195 @@ func Test_getReplyLines(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := getReplyLines(tt.args.rrr)
+			got := getReplyLines(tt.args.rrr, localeFor(mswkn.LanguageGerman).printer)
 			assert.Equal(t, tt.want, got)
 		})
 	}
 }
+
+func Test_messageSubject(t *testing.T) {
+	tests := []struct {
+		subject string
+		want    string
+	}{
+		{subject: "", want: "WKNs"},
+		{subject: "  ", want: "WKNs"},
+		{subject: "A1B2C3", want: "re: A1B2C3"},
+		{subject: "Re: A1B2C3", want: "Re: A1B2C3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.subject, func(t *testing.T) {
+			assert.Equal(t, tt.want, messageSubject(tt.subject))
+		})
+	}
+}
+
+func Test_renderReplySuggestions(t *testing.T) {
+	rrr := &mswkn.RedditReplyRequest{
+		WKNs: []string{"AABBCC", "A0BBCC"},
+		Securities: map[string]*mswkn.Security{
+			"AABBCC": {Name: "a", WKN: "AABBCC"},
+			"AOBBCC": {Name: "o", WKN: "AOBBCC"},
+		},
+		InfoLinks: map[string]*mswkn.InfoLink{
+			"AOBBCC": {WKN: "AOBBCC", URL: "AOBBCC-URL"},
+		},
+		Suggestions: map[string][]string{
+			"A0BBCC": {"AOBBCC"},
+		},
+	}
+
+	got, err := renderReply(newBuiltinTemplates(t), rrr)
+	assert.NoError(t, err)
+	assert.Contains(t, got, "**Meintest du?**")
+	assert.Contains(t, got, "A0BBCC: [AOBBCC](AOBBCC-URL) (o)")
+
+	rrr.Suggestions = nil
+	got, err = renderReply(newBuiltinTemplates(t), rrr)
+	assert.NoError(t, err)
+	assert.NotContains(t, got, "**Meintest du?**")
+}
+
+func Test_renderReplyCommands(t *testing.T) {
+	rrr := &mswkn.RedditReplyRequest{
+		WKNs: []string{"716460", "A1CX3T"},
+		Securities: map[string]*mswkn.Security{
+			"716460": {Name: "SAP SE", WKN: "716460", ISIN: "DE0007164600", Ticker: "SAP", Type: mswkn.SecurityTypeCommonStock},
+			"A1CX3T": {Name: "Tesla", WKN: "A1CX3T", ISIN: "US88160R1014", Type: mswkn.SecurityTypeCommonStock},
+		},
+		InfoLinks: map[string]*mswkn.InfoLink{
+			"716460": {WKN: "716460", URL: "716460-URL"},
+		},
+	}
+
+	tests := []struct {
+		command mswkn.Command
+		want    []string
+	}{
+		{command: mswkn.CommandLookup, want: []string{"**WKNs:**", "|[716460](716460-URL)|SAP SE|Aktie|"}},
+		{command: mswkn.CommandHelp, want: []string{"**So funktioniere ich:**", "$WKN compare"}},
+		{command: mswkn.CommandDetails, want: []string{"**SAP SE**", "|**ISIN**|DE0007164600|", "|**Ticker**|SAP|"}},
+		{command: mswkn.CommandCompare, want: []string{"||[716460](716460-URL)|A1CX3T|", "|**ISIN**|DE0007164600|US88160R1014|"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.command), func(t *testing.T) {
+			rrr.Command = tt.command
+			got, err := renderReply(newBuiltinTemplates(t), rrr)
+			assert.NoError(t, err)
+			for _, want := range tt.want {
+				assert.Contains(t, got, want)
+			}
+		})
+	}
+
+	rrr.Command = "foo"
+	_, err := renderReply(newBuiltinTemplates(t), rrr)
+	assert.Error(t, err)
+}
+
+func Test_renderReplyLanguages(t *testing.T) {
+	expire := time.Date(2021, 6, 18, 0, 0, 0, 0, time.UTC)
+	rrr := &mswkn.RedditReplyRequest{
+		WKNs: []string{"AABBCC", "A0BBCC"},
+		Securities: map[string]*mswkn.Security{
+			"AABBCC": {Name: "a", WKN: "AABBCC", Type: mswkn.SecurityTypeBond, Strike: 1234.5, Expire: &expire},
+		},
+		Suggestions: map[string][]string{
+			"A0BBCC": {"AABBCC"},
+		},
+	}
+
+	tests := []struct {
+		language string
+		want     []string
+	}{
+		{language: "", want: []string{"|AABBCC|a|Anleihe|1.234,50|18.06.2021|", "|A0BBCC|nix gefunden|-|", "**Meintest du?**", "^(ich bin ein bot)"}},
+		{language: mswkn.LanguageGerman, want: []string{"|AABBCC|a|Anleihe|1.234,50|18.06.2021|", "**Basiswert**"}},
+		{language: mswkn.LanguageEnglish, want: []string{"|AABBCC|a|Bond|1,234.50|2021-06-18|", "|A0BBCC|nothing found|-|", "**Did you mean?**", "^(I am a bot)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.language, func(t *testing.T) {
+			rrr.ReplyTarget.Language = tt.language
+			got, err := renderReply(newBuiltinTemplates(t), rrr)
+			assert.NoError(t, err)
+			for _, want := range tt.want {
+				assert.Contains(t, got, want)
+			}
+		})
+	}
+}
+
+func newBuiltinTemplates(t *testing.T) *Templates {
+	templates, err := NewTemplates("")
+	assert.NoError(t, err)
+	return templates
+}
+
+//largeReplyRequest builds a request with n WKNs with long names
+func largeReplyRequest(n int) *mswkn.RedditReplyRequest {
+	rrr := &mswkn.RedditReplyRequest{
+		Securities: make(map[string]*mswkn.Security),
+		InfoLinks:  make(map[string]*mswkn.InfoLink),
+	}
+	for i := 0; i < n; i++ {
+		wkn := fmt.Sprintf("A%05d", i)
+		rrr.WKNs = append(rrr.WKNs, wkn)
+		rrr.Securities[wkn] = &mswkn.Security{
+			Name:           "HSBC Trinkaus & Burkhardt AG TurboC O.End " + wkn,
+			WKN:            wkn,
+			Type:           mswkn.SecurityTypeWarrant,
+			WarrantType:    mswkn.SecurityWarrantTypeCall,
+			WarrantSubType: mswkn.SecurityWarrantSubTypeKnockout,
+			Strike:         1234.56,
+		}
+		rrr.InfoLinks[wkn] = &mswkn.InfoLink{WKN: wkn, URL: "https://www.onvista.de/derivate/Knock-Outs/" + wkn}
+	}
+	return rrr
+}
+
+func Test_renderReplySizeLimit(t *testing.T) {
+	templates := newBuiltinTemplates(t)
+
+	tests := []struct {
+		name     string
+		wkns     int
+		command  mswkn.Command
+		wantMore bool
+	}{
+		{name: "small", wkns: 3},
+		{name: "limit", wkns: 30},
+		{name: "large", wkns: 60, wantMore: true},
+		{name: "huge", wkns: 500, wantMore: true},
+		{name: "compare", wkns: 5, command: mswkn.CommandCompare},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rrr := largeReplyRequest(tt.wkns)
+			rrr.Command = tt.command
+			got, err := renderReply(templates, rrr)
+			assert.NoError(t, err)
+			assert.LessOrEqual(t, utf8.RuneCountInString(got), maxBodyLength)
+			assert.Contains(t, got, "A00000")
+			assert.Contains(t, got, "^(ich bin ein bot)")
+
+			shown := strings.Count(got, "|[A")
+			if !tt.wantMore {
+				assert.NotContains(t, got, "weitere WKNs")
+				return
+			}
+			assert.Less(t, shown, tt.wkns)
+			assert.Contains(t, got, fmt.Sprintf("*und %d weitere WKNs*", tt.wkns-shown))
+		})
+	}
+}
+
+func Test_renderReplyCutsLargeTemplates(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "default", "lookup.tmpl", strings.Repeat("x", maxBodyLength)+"{{range .Lines}}{{.Name}}{{end}}")
+	templates, err := NewTemplates(dir)
+	assert.NoError(t, err)
+
+	got, err := renderReply(templates, largeReplyRequest(2))
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("x", maxBodyLength), got)
+}
@@ -0,0 +1,442 @@
+package responder
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"gitlab.com/mswkn/bot"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+//DefaultTemplateSet is used for requests without template set
+const DefaultTemplateSet = "default"
+
+//templateExt is the extension of template files
+const templateExt = ".tmpl"
+
+//templateFiles are the names of the files overriding the built-in template of a command, e.g. details.tmpl
+var templateFiles = map[mswkn.Command]string{
+	mswkn.CommandLookup:  "lookup",
+	mswkn.CommandHelp:    "help",
+	mswkn.CommandDetails: "details",
+	mswkn.CommandCompare: "compare",
+}
+
+//builtinTemplates are used for commands without template file
+var builtinTemplates = map[mswkn.Command]string{
+	mswkn.CommandLookup:  replyTmpl,
+	mswkn.CommandHelp:    helpTmpl,
+	mswkn.CommandDetails: detailsTmpl,
+	mswkn.CommandCompare: compareTmpl,
+}
+
+//templateSet contains the templates of each language and command
+type templateSet map[string]map[mswkn.Command]*template.Template
+
+//Templates are the reply templates. The built-in templates can be overridden with files in a directory, every sub
+//directory is a named template set with files like lookup.tmpl or details.tmpl. Other files of a set can define shared
+//templates. The set default is used for requests without template set, unknown sets are an error.
+type Templates struct {
+	dir string
+	//required are the configured template sets, loading fails without them
+	required []string
+	lock     sync.RWMutex
+	sets     map[string]templateSet
+	//version is a hash of the loaded files to detect changes
+	version string
+}
+
+//NewTemplates loads and validates the templates, an empty directory means built-in templates only.
+//Loading fails if one of the required template sets does not exist.
+func NewTemplates(dir string, required ...string) (*Templates, error) {
+	t := &Templates{
+		dir:      dir,
+		required: required,
+	}
+	if _, err := t.Reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+//Reload loads the templates again if the files changed. Broken templates are not applied, the previous ones are kept.
+func (t *Templates) Reload() (bool, error) {
+	version, files, err := templateFilesOf(t.dir)
+	if err != nil {
+		return false, err
+	}
+
+	t.lock.RLock()
+	unchanged := t.sets != nil && version == t.version
+	t.lock.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	sets := make(map[string]templateSet, len(files)+1)
+	for name, setFiles := range files {
+		set, err := parseTemplateSet(setFiles)
+		if err != nil {
+			return false, fmt.Errorf("template set %s: %w", name, err)
+		}
+		sets[name] = set
+	}
+	if _, ok := sets[DefaultTemplateSet]; !ok {
+		set, err := parseTemplateSet(nil)
+		if err != nil {
+			return false, err
+		}
+		sets[DefaultTemplateSet] = set
+	}
+	for _, name := range t.required {
+		if _, ok := sets[name]; !ok {
+			return false, fmt.Errorf("unknown template set %s", name)
+		}
+	}
+
+	for name, set := range sets {
+		if err := validateTemplateSet(set); err != nil {
+			return false, fmt.Errorf("template set %s: %w", name, err)
+		}
+	}
+
+	t.lock.Lock()
+	t.sets = sets
+	t.version = version
+	t.lock.Unlock()
+	return true, nil
+}
+
+//Watch reloads changed templates periodically until the context is done
+func (t *Templates) Watch(ctx context.Context, interval time.Duration) {
+	lg := log.With().Str("comp", "responder").Str("job", "templates").Str("dir", t.dir).Logger()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := t.Reload()
+			if err != nil {
+				lg.Error().Err(err).Msg("could not reload templates, keeping the previous ones")
+				continue
+			}
+			if reloaded {
+				lg.Info().Msg("reloaded templates")
+			}
+		}
+	}
+}
+
+//get returns the template of a command
+func (t *Templates) get(set, language string, cmd mswkn.Command) (*template.Template, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	s, ok := t.sets[set]
+	if !ok {
+		return nil, fmt.Errorf("unknown template set %q", set)
+	}
+	tmpl, ok := s[language][cmd]
+	if !ok {
+		return nil, fmt.Errorf("no template for command %q", cmd)
+	}
+	return tmpl, nil
+}
+
+//templateFilesOf returns the template files of each set and a hash of their names and contents as version
+func templateFilesOf(dir string) (string, map[string][]string, error) {
+	files := make(map[string][]string)
+	if dir == "" {
+		return "", files, nil
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", nil, err
+	}
+
+	version := sha256.New()
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		paths, err := filepath.Glob(filepath.Join(dir, entry.Name(), "*"+templateExt))
+		if err != nil {
+			return "", nil, err
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				return "", nil, err
+			}
+			fmt.Fprintf(version, "%s:%d:", path, len(b))
+			version.Write(b)
+		}
+		files[entry.Name()] = paths
+	}
+	return hex.EncodeToString(version.Sum(nil)), files, nil
+}
+
+//parseTemplateSet parses the templates of every language, commands without file get the built-in template
+func parseTemplateSet(files []string) (templateSet, error) {
+	contents := make(map[string]string, len(files))
+	for _, path := range files {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		contents[strings.TrimSuffix(filepath.Base(path), templateExt)] = string(b)
+	}
+
+	set := make(templateSet, len(locales))
+	for lang, loc := range locales {
+		set[lang] = make(map[mswkn.Command]*template.Template, len(templateFiles))
+		for cmd, name := range templateFiles {
+			body, ok := contents[name]
+			if !ok {
+				body = builtinTemplates[cmd]
+			}
+
+			tmpl, err := template.New(name).Funcs(loc.funcs).Parse(partialsTmpl)
+			if err != nil {
+				return nil, err
+			}
+			//the other files of the set are available as named templates, e.g. {{template "footer" .}}
+			for file, content := range contents {
+				if _, isCommand := commandOf(file); isCommand {
+					continue
+				}
+				if _, err := tmpl.New(file).Parse(content); err != nil {
+					return nil, fmt.Errorf("%s%s: %w", file, templateExt, err)
+				}
+			}
+			if _, err := tmpl.Parse(body); err != nil {
+				return nil, fmt.Errorf("%s%s: %w", name, templateExt, err)
+			}
+			set[lang][cmd] = tmpl
+		}
+	}
+	return set, nil
+}
+
+func commandOf(file string) (mswkn.Command, bool) {
+	for cmd, name := range templateFiles {
+		if name == file {
+			return cmd, true
+		}
+	}
+	return "", false
+}
+
+//validateTemplateSet renders every template with the sample requests, so broken templates fail before replying
+func validateTemplateSet(set templateSet) error {
+	//sorted to report the same error on every start
+	langs := make([]string, 0, len(set))
+	for lang := range set {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+
+	for _, lang := range langs {
+		cmds := make([]string, 0, len(set[lang]))
+		for cmd := range set[lang] {
+			cmds = append(cmds, string(cmd))
+		}
+		sort.Strings(cmds)
+
+		for _, cmd := range cmds {
+			tmpl := set[lang][mswkn.Command(cmd)]
+			for _, sample := range sampleReplyRequests() {
+				rrr := sample.rrr
+				rrr.Command = mswkn.Command(cmd)
+				rrr.ReplyTarget.Language = lang
+				//with and without omitted WKNs
+				for _, more := range []int{0, 3} {
+					if _, err := executeTemplate(tmpl, localeFor(lang), rrr, more); err != nil {
+						return fmt.Errorf("%s%s (%s, %s): %w", tmpl.Name(), templateExt, lang, sample.name, err)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+type sampleRequest struct {
+	name string
+	rrr  *mswkn.RedditReplyRequest
+}
+
+//sampleReplyRequests contain the kinds of data a template has to handle, every branch of a template is rendered once
+func sampleReplyRequests() []sampleRequest {
+	full := sampleReplyRequest()
+
+	single := sampleReplyRequest()
+	single.WKNs = []string{"716460"}
+	single.Errors = nil
+	single.Suggestions = nil
+
+	//a WKN without security and suggestions and a security without info link
+	failed := sampleReplyRequest()
+	failed.WKNs = []string{"A0BBCE", "A0BBCD"}
+	failed.InfoLinks = nil
+	failed.Suggestions = nil
+	failed.Errors = map[string]mswkn.ErrorCode{
+		"A0BBCE": mswkn.ErrorCodeSecurityNotFound,
+		"A0BBCD": mswkn.ErrorCodeInfoLinkNotFound,
+	}
+
+	//e.g. the help command or an edited comment without WKNs
+	empty := &mswkn.RedditReplyRequest{SchemaVersion: mswkn.BrokerSchemaVersion, Name: "t1_sample"}
+
+	return []sampleRequest{
+		{name: "multiple WKNs", rrr: full},
+		{name: "single WKN", rrr: single},
+		{name: "errors", rrr: failed},
+		{name: "no WKNs", rrr: empty},
+	}
+}
+
+//sampleReplyRequest contains all kinds of data a template has to handle
+func sampleReplyRequest() *mswkn.RedditReplyRequest {
+	expire := time.Date(2030, 12, 20, 0, 0, 0, 0, time.UTC)
+	return &mswkn.RedditReplyRequest{
+		SchemaVersion: mswkn.BrokerSchemaVersion,
+		Name:          "t1_sample",
+		WKNs:          []string{"TT6DHP", "716460", "A0BBCC"},
+		Securities: map[string]*mswkn.Security{
+			"TT6DHP": {
+				Name:           "HSBC KO PUT SAP",
+				ISIN:           "DE000TT6DHP1",
+				WKN:            "TT6DHP",
+				Underlying:     "716460",
+				Type:           mswkn.SecurityTypeWarrant,
+				WarrantType:    mswkn.SecurityWarrantTypePut,
+				WarrantSubType: mswkn.SecurityWarrantSubTypeKnockout,
+				Strike:         123.45,
+				Expire:         &expire,
+			},
+			"716460": {Name: "SAP SE", ISIN: "DE0007164600", WKN: "716460", Type: mswkn.SecurityTypeCommonStock, Ticker: "SAP"},
+			"A0BBCD": {Name: "Sample", WKN: "A0BBCD", Type: mswkn.SecurityTypeBond},
+		},
+		InfoLinks: map[string]*mswkn.InfoLink{
+			"TT6DHP": {WKN: "TT6DHP", URL: "https://example.com/TT6DHP"},
+		},
+		Errors: map[string]mswkn.ErrorCode{
+			"A0BBCC": mswkn.ErrorCodeSecurityNotFound,
+		},
+		Suggestions: map[string][]string{
+			"A0BBCC": {"A0BBCD"},
+		},
+	}
+}
+
+const replyTmpl = `
+**WKNs:**
+
+{{range .Lines -}} 
+{{.SecURL}} - {{.Name}}
+
+
+{{end}}
+
+
+**Details:**
+
+|**WKN**|**Name**|**{{t "Type"}}**|**{{t "Strike"}}**|**{{t "Expire"}}**|**{{t "Underlying"}}**|
+|:-|:-|:-|-:|:-|:-|:-|:-|
+{{range .Lines -}} 
+|{{.SecURL}}|{{.Name}}|{{.Type}}|{{.Strike}}|{{.Expire}}|{{.Underlying}}|
+{{end}}
+{{- template "suggestions" .}}
+{{- template "more" .}}
+
+^({{t "I am a bot"}})
+`
+
+//partialsTmpl defines the templates included by the other templates
+const partialsTmpl = `{{define "suggestions"}}
+{{- if .Suggestions}}
+
+**{{t "Did you mean?"}}**
+
+{{range .Suggestions -}} 
+{{.WKN}}: {{.Suggestions}}
+
+
+{{end}}
+{{- end}}
+{{- end}}
+
+{{- define "more"}}
+{{- if .More}}
+
+*{{t "and %d more WKNs" .More}}*
+{{- end}}
+{{- end}}`
+
+const helpTmpl = `
+**{{t "How I work:"}}**
+
+* ` + "`$WKN A1B2C3`" + ` {{t "or"}} ` + "`$A1B2C3`" + ` - {{t "name, type and links of WKNs"}}
+* ` + "`$ISIN DE0007164600`" + ` - {{t "the same for ISINs"}}
+* ` + "`$WKN details A1B2C3`" + ` - {{t "all details of a security"}}
+* ` + "`$WKN compare A1B2C3 716460`" + ` - {{t "up to five securities side by side"}}
+* ` + "`$WKN help`" + ` - {{t "this help"}}
+
+^({{t "I am a bot"}})
+`
+
+const detailsTmpl = `
+{{range .Cards -}}
+**{{.Name}}**
+
+|||
+|:-|:-|
+|**WKN**|{{.SecURL}}|
+{{if .ISIN}}|**ISIN**|{{.ISIN}}|
+{{end -}}
+{{if .Ticker}}|**Ticker**|{{.Ticker}}|
+{{end -}}
+|**{{t "Type"}}**|{{.Type}}|
+{{if .Strike}}|**{{t "Strike"}}**|{{.Strike}}|
+{{end -}}
+{{if .Expire}}|**{{t "Expire"}}**|{{.Expire}}|
+{{end -}}
+{{if .Underlying}}|**{{t "Underlying"}}**|{{.Underlying}}|
+{{end}}
+{{end}}
+{{- template "suggestions" .}}
+{{- template "more" .}}
+
+^({{t "I am a bot"}})
+`
+
+const compareTmpl = `
+**{{t "Comparison:"}}**
+
+||{{range .Cards}}{{.SecURL}}|{{end}}
+|:-|{{range .Cards}}:-|{{end}}
+|**Name**|{{range .Cards}}{{.Name}}|{{end}}
+|**ISIN**|{{range .Cards}}{{.ISIN}}|{{end}}
+|**{{t "Type"}}**|{{range .Cards}}{{.Type}}|{{end}}
+|**{{t "Strike"}}**|{{range .Cards}}{{.Strike}}|{{end}}
+|**{{t "Expire"}}**|{{range .Cards}}{{.Expire}}|{{end}}
+|**{{t "Underlying"}}**|{{range .Cards}}{{.Underlying}}|{{end}}
+{{- template "suggestions" .}}
+{{- template "more" .}}
+
+^({{t "I am a bot"}})
+`
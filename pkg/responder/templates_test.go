@@ -0,0 +1,140 @@
+package responder
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/mswkn/bot"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTemplate(t *testing.T, dir, set, file, content string) {
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, set), 0o755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, set, file), []byte(content), 0o644))
+}
+
+func TestTemplates(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "default", "lookup.tmpl", `{{range .Lines}}{{.Name}};{{end}}{{template "footer" .}}`)
+	writeTemplate(t, dir, "default", "footer.tmpl", `^({{t "I am a bot"}})`)
+	writeTemplate(t, dir, "wsb", "lookup.tmpl", `wsb {{len .Lines}}`)
+
+	templates, err := NewTemplates(dir)
+	assert.NoError(t, err)
+
+	rrr := &mswkn.RedditReplyRequest{
+		WKNs:       []string{"716460"},
+		Securities: map[string]*mswkn.Security{"716460": {Name: "SAP SE", WKN: "716460"}},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		language string
+		command  mswkn.Command
+		want     string
+		wantErr  bool
+	}{
+		{name: "default set", want: "SAP SE;^(ich bin ein bot)"},
+		{name: "english", language: mswkn.LanguageEnglish, want: "SAP SE;^(I am a bot)"},
+		{name: "named set", template: "wsb", want: "wsb 1"},
+		{name: "unknown set", template: "foo", wantErr: true},
+		{name: "built-in command", template: "wsb", command: mswkn.CommandHelp, want: "\n**So funktioniere ich:**"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rrr.ReplyTarget.Template = tt.template
+			rrr.ReplyTarget.Language = tt.language
+			rrr.Command = tt.command
+			got, err := renderReply(templates, rrr)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			if tt.command == mswkn.CommandLookup {
+				assert.Equal(t, tt.want, got)
+			} else {
+				assert.Contains(t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplatesValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{name: "parse error", file: "details.tmpl", content: `{{range .Cards}}`, wantErr: "template set default: details.tmpl: "},
+		{name: "unknown field", file: "compare.tmpl", content: `{{.Foo}}`, wantErr: "template set default: compare.tmpl "},
+		{name: "unknown function", file: "help.tmpl", content: `{{foo}}`, wantErr: "template set default: help.tmpl: "},
+		{name: "no WKNs branch", file: "lookup.tmpl", content: `{{if not .Lines}}{{.Foo}}{{end}}`, wantErr: "lookup.tmpl (de, no WKNs)"},
+		{name: "single WKN branch", file: "lookup.tmpl", content: `{{if eq (len .Lines) 1}}{{.Foo}}{{end}}`, wantErr: "lookup.tmpl (de, single WKN)"},
+		{name: "without more branch", file: "details.tmpl", content: `{{if not .More}}{{.Foo}}{{end}}`, wantErr: "template set default: details.tmpl "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTemplate(t, dir, "default", tt.file, tt.content)
+			_, err := NewTemplates(dir)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTemplatesReload(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "default", "lookup.tmpl", `v1`)
+	templates, err := NewTemplates(dir)
+	assert.NoError(t, err)
+
+	reloaded, err := templates.Reload()
+	assert.NoError(t, err)
+	assert.False(t, reloaded)
+
+	//changes of the same size are detected by the content
+	writeTemplate(t, dir, "default", "lookup.tmpl", `v2`)
+	reloaded, err = templates.Reload()
+	assert.NoError(t, err)
+	assert.True(t, reloaded)
+	got, err := renderReply(templates, &mswkn.RedditReplyRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", got)
+
+	//broken templates are not applied
+	writeTemplate(t, dir, "default", "lookup.tmpl", `{{.Foo}}`)
+	_, err = templates.Reload()
+	assert.Error(t, err)
+	got, err = renderReply(templates, &mswkn.RedditReplyRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", got)
+}
+
+func TestTemplatesRequiredSets(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "wsb", "lookup.tmpl", `wsb`)
+
+	_, err := NewTemplates(dir, "foo")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unknown template set foo")
+	}
+	_, err = NewTemplates("", "wsb")
+	assert.Error(t, err)
+
+	templates, err := NewTemplates(dir, "wsb")
+	assert.NoError(t, err)
+
+	//a removed set is not applied
+	assert.NoError(t, os.RemoveAll(filepath.Join(dir, "wsb")))
+	_, err = templates.Reload()
+	assert.Error(t, err)
+	got, err := renderReply(templates, &mswkn.RedditReplyRequest{ReplyTarget: mswkn.ReplyTarget{Template: "wsb"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "wsb", got)
+}
@@ -0,0 +1,71 @@
+package scanner
+
+import (
+	"gitlab.com/mswkn/bot"
+	"strings"
+)
+
+//maxCompareWKNs keeps the comparison table readable
+const maxCompareWKNs = 5
+
+//commands maps the upper case command names to the commands
+var commands = map[string]mswkn.Command{
+	"HELP":    mswkn.CommandHelp,
+	"DETAILS": mswkn.CommandDetails,
+	"COMPARE": mswkn.CommandCompare,
+}
+
+//CommandRequest is a command of a comment with its arguments
+type CommandRequest struct {
+	Command mswkn.Command
+	WKNs    []string
+	ISINs   []string
+}
+
+//parseCommand finds the first command following one of the keywords, e.g. $WKN compare A1B2C3 123456.
+//A command with missing arguments is answered with the help.
+func parseCommand(tokens []string, keywords []string) *CommandRequest {
+	for i := 0; i+1 < len(tokens); i++ {
+		if !isKeyword(tokens[i], keywords) {
+			continue
+		}
+		cmd, ok := commands[strings.Trim(tokens[i+1], ".,;:!?")]
+		if !ok {
+			continue
+		}
+
+		cr := &CommandRequest{Command: cmd}
+		switch cmd {
+		case mswkn.CommandDetails:
+			cr.WKNs, cr.ISINs = commandArgs(tokens[i+2:], 1)
+			if len(cr.WKNs)+len(cr.ISINs) < 1 {
+				return &CommandRequest{Command: mswkn.CommandHelp}
+			}
+		case mswkn.CommandCompare:
+			cr.WKNs, cr.ISINs = commandArgs(tokens[i+2:], maxCompareWKNs)
+			if len(cr.WKNs)+len(cr.ISINs) < 2 {
+				return &CommandRequest{Command: mswkn.CommandHelp}
+			}
+		}
+		return cr
+	}
+	return nil
+}
+
+//commandArgs returns up to max WKNs and ISINs at the beginning of the tokens
+func commandArgs(tokens []string, max int) (wkns []string, isins []string) {
+	for _, token := range tokens {
+		if len(wkns)+len(isins) == max {
+			break
+		}
+		token = strings.Trim(strings.TrimPrefix(token, "$"), ".,;:!?()")
+		if ValidISIN(token) {
+			isins = append(isins, token)
+		} else if wknTokenRegEx.MatchString(token) {
+			wkns = append(wkns, token)
+		} else {
+			break
+		}
+	}
+	return dedupe(wkns, 0), isins
+}
@@ -0,0 +1,66 @@
+package scanner
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/mswkn/bot"
+	"testing"
+)
+
+func Test_parseCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want *CommandRequest
+	}{
+		{
+			name: "no command",
+			text: "$WKN A1B2C3",
+			want: nil,
+		},
+		{
+			name: "command without keyword",
+			text: "help details A1B2C3",
+			want: nil,
+		},
+		{
+			name: "help",
+			text: "was kannst du? $wkn help!",
+			want: &CommandRequest{Command: mswkn.CommandHelp},
+		},
+		{
+			name: "details",
+			text: "$WKN details a1b2c3 123456",
+			want: &CommandRequest{Command: mswkn.CommandDetails, WKNs: []string{"A1B2C3"}},
+		},
+		{
+			name: "details isin",
+			text: "$WKN details DE0007164600",
+			want: &CommandRequest{Command: mswkn.CommandDetails, WKNs: []string{}, ISINs: []string{"DE0007164600"}},
+		},
+		{
+			name: "details without wkn",
+			text: "$WKN details bitte",
+			want: &CommandRequest{Command: mswkn.CommandHelp},
+		},
+		{
+			name: "compare",
+			text: "$WKN compare A1B2C3, $123456 und mehr",
+			want: &CommandRequest{Command: mswkn.CommandCompare, WKNs: []string{"A1B2C3", "123456"}},
+		},
+		{
+			name: "compare limit",
+			text: "$WKN compare AAAAAA BBBBBB CCCCCC DDDDDD EEEEEE FFFFFF",
+			want: &CommandRequest{Command: mswkn.CommandCompare, WKNs: []string{"AAAAAA", "BBBBBB", "CCCCCC", "DDDDDD", "EEEEEE"}},
+		},
+		{
+			name: "compare single wkn",
+			text: "$WKN compare A1B2C3",
+			want: &CommandRequest{Command: mswkn.CommandHelp},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseCommand(tokenize(tt.text), []string{BotKeyWord}))
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package scanner
+
+import (
+	"regexp"
+	"strings"
+)
+
+//ISINKeyWord is the keyword to request an ISIN
+const ISINKeyWord = "$ISIN"
+
+var isinRegEx = regexp.MustCompile(`^[A-Z]{2}[A-Z0-9]{9}[0-9]$`)
+
+//ValidISIN checks the format and the check digit of an ISIN
+func ValidISIN(isin string) bool {
+	isin = strings.ToUpper(isin)
+	if !isinRegEx.MatchString(isin) {
+		return false
+	}
+
+	//letters are replaced by two digits (A=10 ... Z=35), then the Luhn algorithm is applied
+	digits := make([]int, 0, 24)
+	for _, r := range isin {
+		if r >= 'A' && r <= 'Z' {
+			v := int(r-'A') + 10
+			digits = append(digits, v/10, v%10)
+			continue
+		}
+		digits = append(digits, int(r-'0'))
+	}
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := digits[i]
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+//DollarISINTokenScan finds ISINs in a text in order of their appearance. ISINs are recognized after $ISIN or with
+//a $ prefix, all of them have to pass the check digit validation.
+func DollarISINTokenScan(text string) ([]string, error) {
+	return isinTokenScan(text, false)
+}
+
+//FullISINTokenScan finds ISINs like DollarISINTokenScan and also recognizes them on their own, it is used for
+//mentions and private messages which address the bot directly
+func FullISINTokenScan(text string) ([]string, error) {
+	return isinTokenScan(text, true)
+}
+
+func isinTokenScan(text string, bare bool) ([]string, error) {
+	if text == "" {
+		return nil, ErrEmptyBodyText
+	}
+
+	tokens := strings.Fields(strings.ToUpper(text))
+
+	seen := make(map[string]bool)
+	isins := make([]string, 0)
+	afterKeyword := false
+	for _, token := range tokens {
+		if token == ISINKeyWord {
+			//the following token is checked on its own
+			afterKeyword = true
+			continue
+		}
+		requested := afterKeyword || strings.HasPrefix(token, "$")
+		afterKeyword = false
+		if !requested && !bare {
+			continue
+		}
+
+		token = strings.TrimPrefix(token, "$")
+		token = strings.Trim(token, ".,;:!?()[]\"'*")
+		if ValidISIN(token) && !seen[token] {
+			seen[token] = true
+			isins = append(isins, token)
+		}
+	}
+
+	if len(isins) == 0 {
+		return nil, nil
+	}
+	return isins, nil
+}
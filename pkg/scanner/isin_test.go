@@ -0,0 +1,106 @@
+package scanner
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidISIN(t *testing.T) {
+	tests := []struct {
+		isin string
+		want bool
+	}{
+		{isin: "US0378331005", want: true},
+		{isin: "DE0007164600", want: true},
+		{isin: "de0007164600", want: true},
+		{isin: "DE000TT6DHP1", want: false},
+		{isin: "DE0007164601", want: false},
+		{isin: "US0378331015", want: false},
+		{isin: "0E0007164600", want: false},
+		{isin: "DE000716460", want: false},
+		{isin: "DE00071646000", want: false},
+		{isin: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.isin, func(t *testing.T) {
+			assert.Equal(t, tt.want, ValidISIN(tt.isin))
+		})
+	}
+}
+
+func TestDollarISINTokenScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		full    bool
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "empty",
+			text:    "",
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "no isin",
+			text: "foo $wkn 123456",
+			want: nil,
+		},
+		{
+			name: "plain isin",
+			text: "was haltet ihr von US0378331005?",
+			want: nil,
+		},
+		{
+			name: "plain isin direct",
+			text: "was haltet ihr von US0378331005?",
+			full: true,
+			want: []string{"US0378331005"},
+		},
+		{
+			name: "keyword",
+			text: "$isin de0007164600 und so",
+			want: []string{"DE0007164600"},
+		},
+		{
+			name: "dollar prefix",
+			text: "$DE0007164600\n$US0378331005",
+			want: []string{"DE0007164600", "US0378331005"},
+		},
+		{
+			name: "order of appearance",
+			text: "$US0378331005 oder $isin DE0007164600",
+			want: []string{"US0378331005", "DE0007164600"},
+		},
+		{
+			name: "keyword only applies to the next token",
+			text: "$isin DE0007164600 US0378331005",
+			want: []string{"DE0007164600"},
+		},
+		{
+			name: "invalid check digit",
+			text: "$isin DE0007164601",
+			want: nil,
+		},
+		{
+			name: "duplicates",
+			text: "$DE0007164600 $DE0007164600",
+			want: []string{"DE0007164600"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scan := DollarISINTokenScan
+			if tt.full {
+				scan = FullISINTokenScan
+			}
+			got, err := scan(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DollarISINTokenScan() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
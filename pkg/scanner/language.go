@@ -0,0 +1,49 @@
+package scanner
+
+import (
+	"gitlab.com/mswkn/bot"
+	"strings"
+)
+
+//LanguageAuto detects the reply language from the comment
+const LanguageAuto = "auto"
+
+//germanWords and englishWords are frequent words which are rare in the other language
+var (
+	germanWords = wordSet("und", "der", "die", "das", "ist", "nicht", "ich", "du", "ihr", "wir", "was", "wie", "mit",
+		"auf", "für", "ein", "eine", "einen", "zu", "von", "den", "dem", "oder", "aber", "habe", "hat", "sind", "auch",
+		"noch", "schon", "mal", "kann", "haltet", "meint", "bitte", "danke", "gibt", "welche", "warum")
+	englishWords = wordSet("the", "and", "is", "not", "you", "we", "what", "how", "with", "for", "of", "to",
+		"this", "that", "it", "or", "but", "have", "has", "are", "also", "still", "already", "can", "think", "please",
+		"thanks", "which", "why", "does", "my", "your")
+)
+
+func wordSet(words ...string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[w] = true
+	}
+	return set
+}
+
+//DetectLanguage guesses if a text is german or english by counting frequent words, it returns fallback if unsure
+func DetectLanguage(text, fallback string) string {
+	german, english := 0, 0
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		word = strings.Trim(word, ".,;:!?()[]\"'*")
+		if germanWords[word] {
+			german++
+		}
+		if englishWords[word] {
+			english++
+		}
+	}
+
+	switch {
+	case german > english:
+		return mswkn.LanguageGerman
+	case english > german:
+		return mswkn.LanguageEnglish
+	}
+	return fallback
+}
@@ -0,0 +1,26 @@
+package scanner
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/mswkn/bot"
+	"testing"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		fallback string
+		want     string
+	}{
+		{name: "german", text: "Was haltet ihr von $A1B2C3? Ist das nicht zu teuer?", fallback: mswkn.LanguageEnglish, want: mswkn.LanguageGerman},
+		{name: "english", text: "What do you think of $A1B2C3, is it too expensive?", fallback: mswkn.LanguageGerman, want: mswkn.LanguageEnglish},
+		{name: "unsure", text: "$A1B2C3 to the moon", fallback: mswkn.LanguageGerman, want: mswkn.LanguageEnglish},
+		{name: "no words", text: "$A1B2C3 $123456", fallback: mswkn.LanguageGerman, want: mswkn.LanguageGerman},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, DetectLanguage(tt.text, tt.fallback))
+		})
+	}
+}
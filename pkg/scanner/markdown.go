@@ -0,0 +1,102 @@
+package scanner
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	//linkRegEx matches [text](target) and keeps the text
+	linkRegEx = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	//urlRegEx matches bare URLs, reddit renders them as links
+	urlRegEx = regexp.MustCompile(`(?i)\bhttps?://\S+`)
+	//spoilerRegEx matches >!text!< and keeps the text, a line starting with a spoiler is no blockquote
+	spoilerRegEx = regexp.MustCompile(`(?:>|&gt;)!(.*?)!(?:<|&lt;)`)
+)
+
+//StripMarkdown removes the parts of a reddit markdown text which must not trigger the bot:
+//blockquotes, fenced and inline code and link targets. Link texts and spoilers are kept.
+func StripMarkdown(text string) string {
+	lines := strings.Split(text, "\n")
+	kept := make([]string, 0, len(lines))
+
+	fence := ""
+	for _, line := range lines {
+		if fence == "" {
+			line = spoilerRegEx.ReplaceAllString(line, " $1 ")
+		}
+		trimmed := strings.TrimSpace(line)
+
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") {
+			fence = "```"
+			continue
+		}
+		if strings.HasPrefix(trimmed, "~~~") {
+			fence = "~~~"
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, ">") || strings.HasPrefix(trimmed, "&gt;") {
+			continue
+		}
+
+		kept = append(kept, line)
+	}
+
+	text = strings.Join(kept, "\n")
+	text = stripInlineCode(text)
+	text = linkRegEx.ReplaceAllString(text, "$1")
+	text = urlRegEx.ReplaceAllString(text, " ")
+	return text
+}
+
+//stripInlineCode removes code spans, a span ends with a backtick run of the same length as it started
+func stripInlineCode(text string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(text, "`")
+		if start < 0 {
+			b.WriteString(text)
+			return b.String()
+		}
+		n := backtickRun(text[start:])
+
+		end := -1
+		for i := start + n; i < len(text); {
+			j := strings.Index(text[i:], "`")
+			if j < 0 {
+				break
+			}
+			m := backtickRun(text[i+j:])
+			if m == n {
+				end = i + j + m
+				break
+			}
+			i += j + m
+		}
+
+		if end < 0 {
+			//unmatched backticks are literal
+			b.WriteString(text[:start+n])
+			text = text[start+n:]
+			continue
+		}
+		b.WriteString(text[:start])
+		b.WriteString(" ")
+		text = text[end:]
+	}
+}
+
+func backtickRun(text string) int {
+	n := 0
+	for n < len(text) && text[n] == '`' {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,114 @@
+package scanner
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+)
+
+func TestStripMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "plain",
+			text: "foo $AAAAAA bar",
+			want: []string{"AAAAAA"},
+		},
+		{
+			name: "blockquote",
+			text: "> foo $AAAAAA\n\nbar $BBBBBB",
+			want: []string{"BBBBBB"},
+		},
+		{
+			name: "nested and indented blockquote",
+			text: ">> $AAAAAA\n  > $CCCCCC\nbar $BBBBBB",
+			want: []string{"BBBBBB"},
+		},
+		{
+			name: "escaped blockquote",
+			text: "&gt; $AAAAAA\n$BBBBBB",
+			want: []string{"BBBBBB"},
+		},
+		{
+			name: "spoiler",
+			text: ">!$AAAAAA!< und >!$CCCCCC!<\n> $DDDDDD\n$BBBBBB",
+			want: []string{"AAAAAA", "BBBBBB", "CCCCCC"},
+		},
+		{
+			name: "escaped spoiler",
+			text: "&gt;!$AAAAAA!&lt;",
+			want: []string{"AAAAAA"},
+		},
+		{
+			name: "unclosed spoiler is a blockquote",
+			text: ">!$AAAAAA\n$BBBBBB",
+			want: []string{"BBBBBB"},
+		},
+		{
+			name: "fenced code",
+			text: "```\n$AAAAAA\n$wkn CCCCCC\n```\n$BBBBBB",
+			want: []string{"BBBBBB"},
+		},
+		{
+			name: "tilde fenced code",
+			text: "~~~\n$AAAAAA\n```\n$CCCCCC\n~~~\n$BBBBBB",
+			want: []string{"BBBBBB"},
+		},
+		{
+			name: "unclosed fence",
+			text: "$BBBBBB\n```\n$AAAAAA",
+			want: []string{"BBBBBB"},
+		},
+		{
+			name: "inline code",
+			text: "use `$AAAAAA` like $BBBBBB",
+			want: []string{"BBBBBB"},
+		},
+		{
+			name: "inline code with backtick",
+			text: "``$AAAAAA ` $CCCCCC`` $BBBBBB",
+			want: []string{"BBBBBB"},
+		},
+		{
+			name: "unmatched backtick",
+			text: "it`s $BBBBBB",
+			want: []string{"BBBBBB"},
+		},
+		{
+			name: "link target",
+			text: "[chart](https://example.com/$AAAAAA) $BBBBBB",
+			want: []string{"BBBBBB"},
+		},
+		{
+			name: "link text is kept",
+			text: "[$BBBBBB](https://example.com/$AAAAAA)",
+			want: []string{"BBBBBB"},
+		},
+		{
+			name: "bare url",
+			text: "https://example.com/x?q= $BBBBBB",
+			want: []string{"BBBBBB"},
+		},
+		{
+			name: "keyword in quote",
+			text: "> $wkn AAAAAA\n$wkn BBBBBB",
+			want: []string{"BBBBBB"},
+		},
+		{
+			name: "only quoted",
+			text: "> $AAAAAA\nfoo",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DollarWKNTokenScan(StripMarkdown(tt.text))
+			assert.NoError(t, err)
+			sort.Strings(got)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
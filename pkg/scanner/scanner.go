@@ -3,8 +3,11 @@ package scanner
 import (
 	"context"
 	"errors"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"gitlab.com/mswkn/bot"
+	"gitlab.com/mswkn/bot/pkg/config"
+	"gitlab.com/mswkn/bot/pkg/tracing"
 	"regexp"
 	"strings"
 )
@@ -20,24 +23,68 @@ var (
 )
 
 type Scanner struct {
-	msg mswkn.Broker
+	msg     mswkn.Broker
+	tickers *TickerResolver
+	//defaultScan is used for subreddits without own configuration
+	defaultScan *Scan
+	//scans contains the scan of each configured subreddit, the keys are lower case
+	scans map[string]*Scan
 }
 
-func NewScanner(msg mswkn.Broker) *Scanner {
+func NewScanner(conf config.Config, msg mswkn.Broker, aliasRepo mswkn.AliasRepository) *Scanner {
+	lg := log.With().Str("comp", "scanner").Logger()
+
+	defaultScan, err := NewScan(conf.Scan.Default)
+	if err != nil {
+		lg.Fatal().Err(err).Msg("invalid default scanner configuration")
+	}
+
 	s := &Scanner{
-		msg: msg,
+		msg:         msg,
+		tickers:     NewTickerResolver(aliasRepo),
+		defaultScan: defaultScan,
+		scans:       make(map[string]*Scan),
+	}
+	for sr, sc := range conf.Scan.SubReddits {
+		scan, err := NewScan(sc)
+		if err != nil {
+			lg.Fatal().Err(err).Str("subreddit", sr).Msg("invalid scanner configuration")
+		}
+		s.scans[sr] = scan
 	}
 	return s
 }
 
+//scanFor returns the scan configured for a subreddit
+func (s *Scanner) scanFor(subreddit string) *Scan {
+	if scan, ok := s.scans[strings.ToLower(subreddit)]; ok {
+		return scan
+	}
+	return s.defaultScan
+}
+
 func (s *Scanner) Start(ctx context.Context) {
 	lg := log.With().Str("comp", "scanner").Logger()
 
-	handler := func(wr *mswkn.RedditRequest) {
-		lg := lg.With().Str("name", wr.Name).Logger()
+	handler := func(wr *mswkn.RedditRequest) (err error) {
+		lg := lg.With().Str("name", wr.Name).Str("subreddit", wr.Subreddit).Str("request_id", wr.Trace.RequestID).Logger()
+		stage := tracing.StartStage(wr.Trace, "scanner", wr.Name)
+		defer func() { stage.End(err) }()
 		lg.Debug().Msgf("received RedditRequest: %+v", wr)
 
-		wkns, err := DollarWKNTokenScan(wr.Text)
+		text := StripMarkdown(wr.Text)
+		scan := s.scanFor(wr.Subreddit)
+		if wr.ReplyTarget.Direct {
+			scan = scan.Direct()
+		}
+		wr.ReplyTarget.Language = scan.Language(text)
+		wr.ReplyTarget.Template = scan.template
+		if cr := scan.Command(text); cr != nil {
+			lg.Debug().Str("command", string(cr.Command)).Msg("found command")
+			return s.publish(lg, stage, wr, cr)
+		}
+
+		wkns, err := scan.WKNs(text)
 		if err != nil {
 			if err == ErrEmptyBodyText {
 				lg.Debug().Msg("body is empty")
@@ -46,144 +93,170 @@ func (s *Scanner) Start(ctx context.Context) {
 			} else {
 				lg.Error().Err(err).Msg("could not scan body for comment")
 			}
-			return
+			wkns = nil
 		}
 
-		if len(wkns) < 1 {
-			lg.Debug().Msg("ignoring comment because it has no tokens")
-			return
+		if scan.tickers && text != "" {
+			matches, err := s.tickers.Resolve(ctx, text, scan.tickerMinConfidence)
+			if err != nil {
+				lg.Error().Err(err).Msg("could not resolve tickers")
+			} else if len(matches) > 0 {
+				lg.Debug().Msgf("resolved tickers: %+v", matches)
+				wkns = scan.WithTickers(wkns, matches)
+			}
 		}
 
-		sr := &mswkn.SecuritiesRequest{
-			Name: wr.Name,
-			WKNs: wkns,
+		isinScan := DollarISINTokenScan
+		if wr.ReplyTarget.Direct {
+			isinScan = FullISINTokenScan
+		}
+		isins, err := isinScan(text)
+		if err != nil && err != ErrEmptyBodyText {
+			lg.Error().Err(err).Msg("could not scan body for isins")
 		}
-		lg.Trace().Msg("sending SecuritiesRequest")
-		if err := s.msg.Publish(mswkn.BrokerSubjectSecuritiesRequest, sr); err != nil {
-			lg.Error().Err(err).Str("name", wr.Name).Msg("could not send SecuritiesRequest")
-			return
+		if len(wkns)+len(isins) > scan.maxWKNs {
+			lg.Debug().Int("isins", len(isins)).Msg("dropping isins above the wkn limit")
+			isins = isins[:scan.maxWKNs-len(wkns)]
 		}
-		lg.Trace().Msg("SecuritiesRequest sent")
+
+		//an edited comment without tokens is still forwarded, the responder deletes the existing reply then
+		if len(wkns) < 1 && len(isins) < 1 && !wr.ReplyTarget.IsEdit() {
+			lg.Debug().Msg("ignoring comment because it has no tokens")
+			return nil
+		}
+
+		return s.publish(lg, stage, wr, &CommandRequest{Command: mswkn.CommandLookup, WKNs: wkns, ISINs: isins})
 	}
 
-	err := s.msg.Subscribe(mswkn.BrokerSubjectWKNRequest, handler)
+	err := s.msg.QueueSubscribe(mswkn.BrokerSubjectWKNRequest, mswkn.BrokerQueueScanner, handler)
 	if err != nil {
-		lg.Fatal().Err(err).Str("subject", mswkn.BrokerSubjectWKNRequest).Msg("could not subscribe to subject")
+		lg.Fatal().Err(err).Str("subject", mswkn.BrokerSubjectWKNRequest).Str("queue", mswkn.BrokerQueueScanner).Msg("could not subscribe to subject")
 	}
 
 	<-ctx.Done()
 }
 
+//publish sends the SecuritiesRequest of a command
+func (s *Scanner) publish(lg zerolog.Logger, stage *tracing.Stage, wr *mswkn.RedditRequest, cr *CommandRequest) error {
+	sr := &mswkn.SecuritiesRequest{
+		SchemaVersion: mswkn.BrokerSchemaVersion,
+		Trace:         stage.Next(),
+		Name:          wr.Name,
+		WKNs:          cr.WKNs,
+		ISINs:         cr.ISINs,
+		ReplyTarget:   wr.ReplyTarget,
+		Command:       cr.Command,
+	}
+	lg.Trace().Msg("sending SecuritiesRequest")
+	if err := s.msg.Publish(mswkn.BrokerSubjectSecuritiesRequest, sr); err != nil {
+		lg.Error().Err(err).Str("name", wr.Name).Msg("could not send SecuritiesRequest")
+		return err
+	}
+	lg.Trace().Msg("SecuritiesRequest sent")
+	return nil
+}
+
 func DummyScanner(text string) ([]string, error) {
 	return []string{"TT6DHP"}, nil
 }
 
+//DollarWKNTokenScan finds WKNs following BotKeyWord and WKNs with a $ prefix
 func DollarWKNTokenScan(text string) ([]string, error) {
 	if text == "" {
 		return nil, ErrEmptyBodyText
 	}
 
-	text = strings.ToUpper(text)
-	text = strings.ReplaceAll(text, "\n", " ")
-	text = strings.ReplaceAll(text, "\t", " ")
-	text = strings.ReplaceAll(text, "  ", " ")
-	text = strings.ReplaceAll(text, "  ", " ")
-
-	tokens := strings.Split(text, " ")
-
-	wknMap := make(map[string]bool)
-	if len(tokens) > 1 {
-		dollarWKNKeywordTokenScan(tokens, wknMap)
-	}
-	dollarWKNTokenScan(tokens, wknMap)
-
-	if len(wknMap) == 0 {
+	tokens := tokenize(text)
+	opts := Options{Keywords: []string{BotKeyWord}}
+	wkns := dedupe(append(keywordTokenScan(tokens, opts), dollarWKNTokenScan(tokens, opts)...), 0)
+	if len(wkns) == 0 {
 		return nil, nil
 	}
-
-	wkns := make([]string, 0, len(wknMap))
-	for wkn := range wknMap {
-		wkns = append(wkns, wkn)
-	}
 	return wkns, nil
 }
 
-var dollarWKNTokenRegEx = regexp.MustCompile(`\$([A-Z0-9]{6})`)
-
-func dollarWKNTokenScan(tokens []string, wknMap map[string]bool) {
-	for _, token := range tokens {
-		token = strings.TrimSpace(token)
+//tokenize splits a text into upper case words
+func tokenize(text string) []string {
+	return strings.Fields(strings.ToUpper(text))
+}
 
-		//$AA88YY
-		if len(token) != 7 {
+//dedupe removes duplicate WKNs and keeps the first max WKNs, zero means no limit
+func dedupe(wkns []string, max int) []string {
+	seen := make(map[string]bool, len(wkns))
+	unique := make([]string, 0, len(wkns))
+	for _, wkn := range wkns {
+		if seen[wkn] {
 			continue
 		}
+		seen[wkn] = true
+		unique = append(unique, wkn)
+		if max > 0 && len(unique) == max {
+			break
+		}
+	}
+	return unique
+}
 
+var dollarWKNTokenRegEx = regexp.MustCompile(`^\$([A-Z0-9]{6})$`)
+
+//dollarWKNTokenScan finds tokens like $AA88YY
+func dollarWKNTokenScan(tokens []string, opts Options) []string {
+	wkns := make([]string, 0)
+	for _, token := range tokens {
 		findings := dollarWKNTokenRegEx.FindStringSubmatch(token)
-		for _, finding := range findings {
-			if strings.HasPrefix(finding, "$") {
-				continue
-			}
-			wknMap[finding] = true
+		if len(findings) == 2 {
+			wkns = append(wkns, findings[1])
 		}
 	}
+	return wkns
 }
 
-func dollarWKNKeywordTokenScan(tokens []string, wknMap map[string]bool) {
-	skipNext := false
-	tCount := len(tokens)
-	for i, token := range tokens {
-		if skipNext {
-			skipNext = false
+//keywordTokenScan finds WKNs following one of the keywords, e.g. $WKN AA88YY
+func keywordTokenScan(tokens []string, opts Options) []string {
+	wkns := make([]string, 0)
+	for i := 0; i+1 < len(tokens); i++ {
+		if !isKeyword(tokens[i], opts.Keywords) {
 			continue
 		}
-
-		if token == BotKeyWord {
-			wknI := i + 1
-			if wknI == tCount {
-				continue
-			}
-			wkn := tokens[wknI]
-			if len(wkn) == 6 {
-				wknMap[wkn] = true
-				skipNext = true
-			}
+		wkn := tokens[i+1]
+		if len(wkn) == 6 {
+			wkns = append(wkns, wkn)
+			i++
 		}
 	}
+	return wkns
 }
 
-var wknTokenRegEx = regexp.MustCompile(`([A-Z0-9]{6})`)
-
-func WKNDollarFullScan(text string) ([]string, error) {
-	if text == "" {
-		return nil, ErrEmptyBodyText
+func isKeyword(token string, keywords []string) bool {
+	for _, kw := range keywords {
+		if token == kw {
+			return true
+		}
 	}
+	return false
+}
 
-	text = strings.ToUpper(text)
-
-	inTokens := strings.Split(text, " ")
-	matches := make(map[string]bool)
-	for _, token := range inTokens {
-		token = strings.TrimSpace(token)
-
-		if len(token) != 6 {
-			continue
-		}
+var wknTokenRegEx = regexp.MustCompile(`^[A-Z0-9]{6}$`)
 
-		findings := wknTokenRegEx.FindStringSubmatch(token)
-		for _, finding := range findings {
-			matches[finding] = true
+//fullTokenScan treats every token with six letters or digits as WKN
+func fullTokenScan(tokens []string, opts Options) []string {
+	wkns := make([]string, 0)
+	for _, token := range tokens {
+		if wknTokenRegEx.MatchString(token) {
+			wkns = append(wkns, token)
 		}
 	}
+	return wkns
+}
 
-	if len(matches) < 1 {
-		return nil, nil
+func WKNDollarFullScan(text string) ([]string, error) {
+	if text == "" {
+		return nil, ErrEmptyBodyText
 	}
 
-	wkns := make([]string, 0)
-	for wkn := range matches {
-		wkns = append(wkns, wkn)
+	wkns := dedupe(fullTokenScan(tokenize(text), Options{}), 0)
+	if len(wkns) < 1 {
+		return nil, nil
 	}
-
 	return wkns, nil
 }
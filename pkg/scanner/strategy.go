@@ -0,0 +1,161 @@
+package scanner
+
+import (
+	"fmt"
+	"gitlab.com/mswkn/bot"
+	"gitlab.com/mswkn/bot/pkg/config"
+	"sync"
+)
+
+const (
+	StrategyKeyword = "keyword"
+	StrategyDollar  = "dollar"
+	StrategyFull    = "full"
+	StrategyDummy   = "dummy"
+)
+
+//Options are passed to every strategy
+type Options struct {
+	//Keywords are upper case
+	Keywords []string
+}
+
+//Strategy finds WKNs in the upper case words of a comment, in order of appearance
+type Strategy func(tokens []string, opts Options) []string
+
+var (
+	strategiesLock sync.RWMutex
+	strategies     = map[string]Strategy{
+		StrategyKeyword: keywordTokenScan,
+		StrategyDollar:  dollarWKNTokenScan,
+		StrategyFull:    fullTokenScan,
+		StrategyDummy: func(tokens []string, opts Options) []string {
+			wkns, _ := DummyScanner("")
+			return wkns
+		},
+	}
+)
+
+//RegisterStrategy adds a strategy which can be enabled by its name in the scanner configuration
+func RegisterStrategy(name string, strategy Strategy) {
+	strategiesLock.Lock()
+	defer strategiesLock.Unlock()
+	strategies[name] = strategy
+}
+
+//MaxWKNsPerComment is the hard limit of WKNs per comment, it protects the lookups and the reply size
+const MaxWKNsPerComment = 30
+
+//Scan runs the strategies of a scanner configuration
+type Scan struct {
+	strategies []Strategy
+	opts       Options
+	maxWKNs    int
+	//tickers enables the ticker resolution with aliases of at least tickerMinConfidence
+	tickers             bool
+	tickerMinConfidence float64
+	//language is a mswkn Language constant or LanguageAuto
+	language string
+	//template is the name of the reply template set
+	template string
+}
+
+func NewScan(conf config.ScanConfig) (*Scan, error) {
+	strategiesLock.RLock()
+	defer strategiesLock.RUnlock()
+
+	s := &Scan{
+		strategies: make([]Strategy, 0, len(conf.Strategies)),
+		opts:       Options{Keywords: conf.Keywords},
+		maxWKNs:    conf.MaxWKNs,
+
+		tickers:             conf.Tickers,
+		tickerMinConfidence: conf.TickerMinConfidence,
+		language:            conf.Language,
+		template:            conf.Template,
+	}
+	if s.maxWKNs <= 0 || s.maxWKNs > MaxWKNsPerComment {
+		s.maxWKNs = MaxWKNsPerComment
+	}
+	switch s.language {
+	case "":
+		s.language = mswkn.LanguageGerman
+	case mswkn.LanguageGerman, mswkn.LanguageEnglish, LanguageAuto:
+	default:
+		return nil, fmt.Errorf("unknown reply language: %s", conf.Language)
+	}
+
+	for _, name := range conf.Strategies {
+		strategy, ok := strategies[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown scanner strategy: %s", name)
+		}
+		s.strategies = append(s.strategies, strategy)
+	}
+	return s, nil
+}
+
+//Direct returns the scan of mentions and private messages. They address the bot, so every token which looks like a
+//WKN is found in addition to the configured strategies.
+func (s *Scan) Direct() *Scan {
+	d := *s
+	d.strategies = append(append(make([]Strategy, 0, len(s.strategies)+1), s.strategies...), fullTokenScan)
+	return &d
+}
+
+//WKNs returns the WKNs found by all strategies, limited to the maximum number of WKNs
+func (s *Scan) WKNs(text string) ([]string, error) {
+	if text == "" {
+		return nil, ErrEmptyBodyText
+	}
+
+	tokens := tokenize(text)
+	wkns := make([]string, 0)
+	for _, strategy := range s.strategies {
+		wkns = append(wkns, strategy(tokens, s.opts)...)
+	}
+
+	wkns = dedupe(wkns, s.maxWKNs)
+	if len(wkns) == 0 {
+		return nil, nil
+	}
+	return wkns, nil
+}
+
+//WithTickers adds the WKNs of resolved tickers, limited to the maximum number of WKNs.
+//Names of six characters like $NVIDIA are found as WKN by the dollar strategy too, they are replaced.
+func (s *Scan) WithTickers(wkns []string, matches []TickerMatch) []string {
+	resolved := make(map[string]bool, len(matches))
+	for _, m := range matches {
+		resolved[m.Alias] = true
+	}
+
+	all := make([]string, 0, len(wkns)+len(matches))
+	for _, wkn := range wkns {
+		if !resolved[wkn] {
+			all = append(all, wkn)
+		}
+	}
+	for _, m := range matches {
+		all = append(all, m.WKN)
+	}
+
+	all = dedupe(all, s.maxWKNs)
+	if len(all) == 0 {
+		return nil
+	}
+	return all
+}
+
+//Command returns the command following one of the keywords, or nil if the text contains none
+func (s *Scan) Command(text string) *CommandRequest {
+	return parseCommand(tokenize(text), s.opts.Keywords)
+}
+
+//Language returns the reply language of a comment
+func (s *Scan) Language(text string) string {
+	if s.language == LanguageAuto {
+		return DetectLanguage(text, mswkn.LanguageGerman)
+	}
+	return s.language
+}
@@ -0,0 +1,129 @@
+package scanner
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/mswkn/bot"
+	"gitlab.com/mswkn/bot/pkg/config"
+	"testing"
+)
+
+func TestScan_WKNs(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    config.ScanConfig
+		text    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "empty",
+			conf:    config.ScanConfig{Keywords: []string{"$WKN"}, Strategies: []string{StrategyKeyword}},
+			text:    "",
+			wantErr: true,
+		},
+		{
+			name: "custom keyword",
+			conf: config.ScanConfig{Keywords: []string{"!WKN"}, Strategies: []string{StrategyKeyword}},
+			text: "!wkn a1b2c3 $wkn 123456",
+			want: []string{"A1B2C3"},
+		},
+		{
+			name: "keyword and dollar",
+			conf: config.ScanConfig{Keywords: []string{"$WKN"}, Strategies: []string{StrategyKeyword, StrategyDollar}},
+			text: "$wkn a1b2c3 und $123456 und nochmal $a1b2c3",
+			want: []string{"A1B2C3", "123456"},
+		},
+		{
+			name: "full",
+			conf: config.ScanConfig{Strategies: []string{StrategyFull}},
+			text: "wie ist a1b2c3 und 123456",
+			want: []string{"A1B2C3", "123456"},
+		},
+		{
+			name: "max wkns",
+			conf: config.ScanConfig{Strategies: []string{StrategyDollar}, MaxWKNs: 1},
+			text: "$a1b2c3 $123456",
+			want: []string{"A1B2C3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewScan(tt.conf)
+			assert.NoError(t, err)
+			got, err := s.WKNs(tt.text)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestScan_Direct(t *testing.T) {
+	s, err := NewScan(config.ScanConfig{Keywords: []string{"$WKN"}, Strategies: []string{StrategyKeyword, StrategyDollar}})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		text        string
+		wantComment []string
+		want        []string
+	}{
+		{name: "mention", text: "u/mswkn_bot A1B2C3", want: []string{"A1B2C3"}},
+		{name: "private message", text: "A1B2C3", want: []string{"A1B2C3"}},
+		{name: "keyword first", text: "a1b2c3 und $WKN 716460", wantComment: []string{"716460"}, want: []string{"716460", "A1B2C3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.WKNs(tt.text)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantComment, got)
+
+			got, err = s.Direct().WKNs(tt.text)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewScanUnknownStrategy(t *testing.T) {
+	_, err := NewScan(config.ScanConfig{Strategies: []string{"foo"}})
+	assert.EqualError(t, err, "unknown scanner strategy: foo")
+}
+
+func TestScan_Language(t *testing.T) {
+	s, err := NewScan(config.ScanConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, mswkn.LanguageGerman, s.Language("what is $A1B2C3"))
+
+	s, err = NewScan(config.ScanConfig{Language: mswkn.LanguageEnglish})
+	assert.NoError(t, err)
+	assert.Equal(t, mswkn.LanguageEnglish, s.Language("was ist $A1B2C3"))
+
+	s, err = NewScan(config.ScanConfig{Language: LanguageAuto})
+	assert.NoError(t, err)
+	assert.Equal(t, mswkn.LanguageEnglish, s.Language("what is $A1B2C3"))
+	assert.Equal(t, mswkn.LanguageGerman, s.Language("$A1B2C3"))
+
+	_, err = NewScan(config.ScanConfig{Language: "fr"})
+	assert.EqualError(t, err, "unknown reply language: fr")
+}
+
+func TestScan_WKNsHardLimit(t *testing.T) {
+	text := ""
+	for i := 0; i < 40; i++ {
+		text += fmt.Sprintf(" $A%05d", i)
+	}
+
+	for _, maxWKNs := range []int{0, 100} {
+		s, err := NewScan(config.ScanConfig{Strategies: []string{StrategyDollar}, MaxWKNs: maxWKNs})
+		assert.NoError(t, err)
+		got, err := s.WKNs(text)
+		assert.NoError(t, err)
+		assert.Len(t, got, MaxWKNsPerComment)
+		assert.Equal(t, "A00000", got[0])
+	}
+}
@@ -0,0 +1,135 @@
+package scanner
+
+import (
+	"context"
+	"gitlab.com/mswkn/bot"
+	"strings"
+)
+
+//maxAliasWords limits the words of a name following a $, e.g. $Deutsche Bank
+const maxAliasWords = 3
+
+//commonWords are never resolved as tickers, they are slang of the trading subreddits
+var commonWords = map[string]bool{
+	"CALL": true, "CALLS": true, "PUT": true, "PUTS": true, "BUY": true, "SELL": true, "HOLD": true,
+	"LONG": true, "SHORT": true, "YOLO": true, "MOON": true, "ATH": true, "DD": true, "FOMO": true,
+	"WKN": true, "ISIN": true, "EUR": true, "USD": true, "ETF": true, "ETC": true, "OS": true, "KO": true,
+}
+
+//TickerMatch is a ticker or name of a comment resolved to a WKN
+type TickerMatch struct {
+	//Alias is the matched name without $, e.g. TSLA
+	Alias string
+	WKN   string
+}
+
+//TickerResolver finds WKNs of tickers and names following a $ with the alias dictionary
+type TickerResolver struct {
+	repo mswkn.AliasRepository
+}
+
+func NewTickerResolver(repo mswkn.AliasRepository) *TickerResolver {
+	t := &TickerResolver{
+		repo: repo,
+	}
+	return t
+}
+
+//Resolve returns the matches in order of appearance. Longer names win over their first word,
+//aliases below minConfidence and names of several securities with the same confidence are ignored.
+func (t *TickerResolver) Resolve(ctx context.Context, text string, minConfidence float64) ([]TickerMatch, error) {
+	if text == "" {
+		return nil, ErrEmptyBodyText
+	}
+
+	candidates := tickerCandidates(tokenize(text))
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	names := make([]string, 0)
+	for _, c := range candidates {
+		names = append(names, c...)
+	}
+	aliases, err := t.repo.GetMany(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]TickerMatch, 0)
+	for _, c := range candidates {
+		for _, name := range c {
+			if wkn := pickAlias(aliases[name], minConfidence); wkn != "" {
+				matches = append(matches, TickerMatch{Alias: name, WKN: wkn})
+				break
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return nil, nil
+	}
+	return matches, nil
+}
+
+//tickerCandidates returns for each token starting with $ the names it may start, longest first
+func tickerCandidates(tokens []string) [][]string {
+	candidates := make([][]string, 0)
+	for i, token := range tokens {
+		token = strings.TrimLeft(token, "(")
+		if !strings.HasPrefix(token, "$") {
+			continue
+		}
+
+		words := make([]string, 0, maxAliasWords)
+		for j := i; j < len(tokens) && len(words) < maxAliasWords; j++ {
+			word := tokens[j]
+			if j == i {
+				word = token[1:]
+			}
+			trimmed := strings.TrimRight(word, ".,;:!?)\"'")
+			if trimmed == "" || strings.HasPrefix(trimmed, "$") {
+				break
+			}
+			words = append(words, trimmed)
+			//a name ends with its punctuation, e.g. $SAP, $TSLA
+			if trimmed != word {
+				break
+			}
+		}
+		names := make([]string, 0, len(words))
+		for n := len(words); n > 0; n-- {
+			name := strings.Join(words[:n], " ")
+			if n == 1 && commonWords[name] {
+				continue
+			}
+			names = append(names, name)
+		}
+		if len(names) > 0 {
+			candidates = append(candidates, names)
+		}
+	}
+	return candidates
+}
+
+//pickAlias returns the WKN of the most confident alias, or nothing if it is not confident or ambiguous
+func pickAlias(aliases []*mswkn.Alias, minConfidence float64) string {
+	best := make(map[string]float64)
+	for _, a := range aliases {
+		if a.Confidence >= minConfidence && a.Confidence > best[a.WKN] {
+			best[a.WKN] = a.Confidence
+		}
+	}
+
+	wkn, confidence, ambiguous := "", 0.0, false
+	for w, c := range best {
+		if c > confidence {
+			wkn, confidence, ambiguous = w, c, false
+		} else if c == confidence {
+			ambiguous = true
+		}
+	}
+	if ambiguous {
+		return ""
+	}
+	return wkn
+}
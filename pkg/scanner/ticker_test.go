@@ -0,0 +1,104 @@
+package scanner
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/mswkn/bot"
+	"gitlab.com/mswkn/bot/pkg/config"
+	"gitlab.com/mswkn/bot/pkg/db"
+	"testing"
+)
+
+func TestTickerResolver_Resolve(t *testing.T) {
+	repo := db.NewMemoryAliasRepository()
+	assert.NoError(t, repo.AddBulk(context.Background(), []*mswkn.Alias{
+		{Alias: "TSLA", WKN: "A1CX3T", Source: mswkn.AliasSourceXetra, Confidence: 0.8},
+		{Alias: "SAP", WKN: "716460", Source: mswkn.AliasSourceXetra, Confidence: 0.8},
+		{Alias: "DEUTSCHE", WKN: "514000", Source: mswkn.AliasSourceFile, Confidence: 0.5},
+		{Alias: "DEUTSCHE BANK", WKN: "514000", Source: mswkn.AliasSourceFile, Confidence: 1},
+		{Alias: "CALL", WKN: "A0YJ9D", Source: mswkn.AliasSourceXetra, Confidence: 0.8},
+		{Alias: "AMBI", WKN: "111111", Source: mswkn.AliasSourceXetra, Confidence: 0.8},
+		{Alias: "AMBI", WKN: "222222", Source: mswkn.AliasSourceXetra, Confidence: 0.8},
+		{Alias: "NVIDIA", WKN: "918422", Source: mswkn.AliasSourceFile, Confidence: 1},
+	}))
+	resolver := NewTickerResolver(repo)
+
+	tests := []struct {
+		name          string
+		text          string
+		minConfidence float64
+		want          []TickerMatch
+		wantErr       bool
+	}{
+		{
+			name:    "empty",
+			text:    "",
+			wantErr: true,
+		},
+		{
+			name:          "tickers",
+			text:          "$tsla oder ($SAP)?",
+			minConfidence: 0.7,
+			want:          []TickerMatch{{Alias: "TSLA", WKN: "A1CX3T"}, {Alias: "SAP", WKN: "716460"}},
+		},
+		{
+			name:          "without dollar",
+			text:          "tsla und sap",
+			minConfidence: 0.7,
+			want:          nil,
+		},
+		{
+			name:          "longest name",
+			text:          "$Deutsche Bank geht ab",
+			minConfidence: 0.7,
+			want:          []TickerMatch{{Alias: "DEUTSCHE BANK", WKN: "514000"}},
+		},
+		{
+			name:          "name ends with punctuation",
+			text:          "$Deutsche, Bank",
+			minConfidence: 0.4,
+			want:          []TickerMatch{{Alias: "DEUTSCHE", WKN: "514000"}},
+		},
+		{
+			name:          "below min confidence",
+			text:          "$Deutsche, $TSLA",
+			minConfidence: 0.9,
+			want:          nil,
+		},
+		{
+			name:          "common word",
+			text:          "$call auf $tsla",
+			minConfidence: 0.7,
+			want:          []TickerMatch{{Alias: "TSLA", WKN: "A1CX3T"}},
+		},
+		{
+			name:          "ambiguous",
+			text:          "$AMBI",
+			minConfidence: 0.7,
+			want:          nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolver.Resolve(context.Background(), tt.text, tt.minConfidence)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestScan_WithTickers(t *testing.T) {
+	s, err := NewScan(config.ScanConfig{Strategies: []string{StrategyDollar}, MaxWKNs: 2})
+	assert.NoError(t, err)
+
+	wkns, err := s.WKNs("$NVIDIA $A1B2C3 $tsla")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"NVIDIA", "A1B2C3"}, wkns)
+
+	got := s.WithTickers(wkns, []TickerMatch{{Alias: "NVIDIA", WKN: "918422"}, {Alias: "TSLA", WKN: "A1CX3T"}})
+	assert.Equal(t, []string{"A1B2C3", "918422"}, got)
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"gitlab.com/mswkn/bot"
+	"gitlab.com/mswkn/bot/pkg/tracing"
 	"time"
 )
 
@@ -24,16 +25,20 @@ func NewService(msg mswkn.Broker, securities mswkn.SecurityRepository) *Securiti
 func (s *Securities) Start(ctx context.Context) {
 	lg := log.With().Str("comp", "securities").Logger()
 
-	handler := func(sr *mswkn.SecuritiesRequest) {
-		lg := lg.With().Str("name", sr.Name).Logger()
+	handler := func(sr *mswkn.SecuritiesRequest) (err error) {
+		lg := lg.With().Str("name", sr.Name).Str("request_id", sr.Trace.RequestID).Logger()
 		lg.Debug().Msgf("received SecuritiesRequest: %+v", sr)
+		stage := tracing.StartStage(sr.Trace, "securities", sr.Name)
+		defer func() { stage.End(err) }()
 
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*100)
+		ctx, cancel := context.WithTimeout(stage.Ctx, time.Second*100)
 		defer cancel()
 
-		secs, underlyings := s.fetchSecurities(ctx, lg, sr.WKNs)
+		errs := make(map[string]mswkn.ErrorCode)
+		wkns := s.resolveISINs(ctx, lg, sr.WKNs, sr.ISINs, errs)
+		secs, underlyings := s.fetchSecurities(ctx, lg, wkns, errs)
 		if len(underlyings) > 0 {
-			secsU, _ := s.fetchSecurities(ctx, lg, underlyings)
+			secsU, _ := s.fetchSecurities(ctx, lg, underlyings, make(map[string]mswkn.ErrorCode))
 			for wkn, security := range secsU {
 				secs[wkn] = security
 			}
@@ -41,38 +46,107 @@ func (s *Securities) Start(ctx context.Context) {
 
 		lg.Debug().Int("securities", len(secs)).Msg("wkn lookup done")
 
+		unknown := make([]string, 0)
+		for _, wkn := range wkns {
+			if errs[wkn] == mswkn.ErrorCodeSecurityNotFound {
+				unknown = append(unknown, wkn)
+			}
+		}
+		suggestions, secsS, err := s.suggest(ctx, unknown)
+		if err != nil {
+			lg.Error().Err(err).Msg("could not look up suggestions")
+		}
+		for wkn, security := range secsS {
+			secs[wkn] = security
+		}
+
 		ilf := &mswkn.InfoLinksRequest{
-			Name:       sr.Name,
-			WKNs:       sr.WKNs,
-			Securities: secs,
+			SchemaVersion: mswkn.BrokerSchemaVersion,
+			Trace:         stage.Next(),
+			Name:          sr.Name,
+			WKNs:          wkns,
+			Securities:    secs,
+			Errors:        errs,
+			ReplyTarget:   sr.ReplyTarget,
+			Suggestions:   suggestions,
+			Command:       sr.Command,
 		}
 		lg.Trace().Msg("sending InfoLinksRequest")
 		if err := s.msg.Publish(mswkn.BrokerSubjectInfoLinksRequest, ilf); err != nil {
 			lg.Error().Err(err).Msg("could not send InfoLinksRequest")
-			return
+			return err
 		}
 		lg.Trace().Msg("InfoLinksRequest sent")
+		return nil
 	}
 
-	err := s.msg.Subscribe(mswkn.BrokerSubjectSecuritiesRequest, handler)
+	err := s.msg.QueueSubscribe(mswkn.BrokerSubjectSecuritiesRequest, mswkn.BrokerQueueSecurities, handler)
 	if err != nil {
-		lg.Fatal().Err(err).Str("subject", mswkn.BrokerSubjectSecuritiesRequest).Msg("could not subscribe to subject")
+		lg.Fatal().Err(err).Str("subject", mswkn.BrokerSubjectSecuritiesRequest).Str("queue", mswkn.BrokerQueueSecurities).Msg("could not subscribe to subject")
 	}
 
 	<-ctx.Done()
 }
-func (s *Securities) fetchSecurities(ctx context.Context, lg zerolog.Logger, wkns []string) (map[string]*mswkn.Security, []string) {
+
+//resolveISINs appends the WKNs of the requested ISINs to the requested WKNs. ISINs without a security are kept, so the
+//user gets an answer for them as well.
+func (s *Securities) resolveISINs(ctx context.Context, lg zerolog.Logger, wkns, isins []string, errs map[string]mswkn.ErrorCode) []string {
+	if len(isins) == 0 {
+		return wkns
+	}
+
+	seen := make(map[string]bool, len(wkns))
+	all := make([]string, 0, len(wkns)+len(isins))
+	for _, wkn := range wkns {
+		seen[wkn] = true
+		all = append(all, wkn)
+	}
+
+	for _, isin := range isins {
+		isLg := lg.With().Str("isin", isin).Logger()
+
+		sec, err := s.repo.GetByISIN(ctx, isin)
+		if err != nil {
+			if err == mswkn.ErrSecurityNotFound {
+				isLg.Info().Msg("not found in repo")
+				errs[isin] = mswkn.ErrorCodeSecurityNotFound
+			} else {
+				isLg.Error().Err(err).Msg("could not get security for isin")
+				errs[isin] = mswkn.ErrorCodeSecurityRepo
+			}
+			all = append(all, isin)
+			continue
+		}
+
+		if seen[sec.WKN] {
+			continue
+		}
+		seen[sec.WKN] = true
+		all = append(all, sec.WKN)
+	}
+	return all
+}
+
+//fetchSecurities looks up all WKNs, the reasons for failed lookups are added to errs
+func (s *Securities) fetchSecurities(ctx context.Context, lg zerolog.Logger, wkns []string, errs map[string]mswkn.ErrorCode) (map[string]*mswkn.Security, []string) {
 	secs := make(map[string]*mswkn.Security)
 	underlyings := make([]string, 0)
 	for _, wkn := range wkns {
 		wkLg := lg.With().Str("wkn", wkn).Logger()
 
+		//unresolved ISINs
+		if _, failed := errs[wkn]; failed {
+			continue
+		}
+
 		sec, err := s.repo.Get(ctx, wkn)
 		if err != nil {
 			if err == mswkn.ErrSecurityNotFound {
 				wkLg.Info().Msg("not found in repo")
+				errs[wkn] = mswkn.ErrorCodeSecurityNotFound
 			} else {
 				wkLg.Error().Err(err).Msg("could not get security for wkn")
+				errs[wkn] = mswkn.ErrorCodeSecurityRepo
 			}
 			continue
 		}
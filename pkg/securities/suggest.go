@@ -0,0 +1,144 @@
+package securities
+
+import (
+	"context"
+	"gitlab.com/mswkn/bot"
+	"sort"
+	"strings"
+)
+
+//maxSuggestions is the number of suggestions per unknown WKN
+const maxSuggestions = 3
+
+//wknAlphabet contains all characters of a WKN
+const wknAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+//confusables are characters users mix up when typing a WKN
+var confusables = map[rune]string{
+	'0': "OQD",
+	'O': "0Q",
+	'Q': "O0",
+	'D': "0",
+	'1': "IL",
+	'I': "1L",
+	'L': "1I",
+	'2': "Z",
+	'Z': "2",
+	'5': "S",
+	'S': "5",
+	'6': "G",
+	'G': "6",
+	'8': "B",
+	'B': "8",
+}
+
+//suggestion is a candidate WKN with its distance to the unknown WKN, confusable characters are closer than typos
+type suggestion struct {
+	wkn      string
+	distance int
+}
+
+const (
+	distanceConfusable = 1
+	distanceTypo       = 2
+)
+
+//maxConfusables limits the confusable characters per candidate, all combinations of "000000" would be 4096 WKNs
+const maxConfusables = 2
+
+//suggestionCandidates returns all WKNs within one typo or up to maxConfusables confusable characters of the given WKN
+func suggestionCandidates(wkn string) map[string]int {
+	wkn = strings.ToUpper(wkn)
+	candidates := make(map[string]int)
+	add := func(c string, distance int) {
+		if c == wkn {
+			return
+		}
+		if d, ok := candidates[c]; !ok || distance < d {
+			candidates[c] = distance
+		}
+	}
+
+	//confusable characters at up to maxConfusables positions
+	b := []byte(wkn)
+	var confuse func(from, left int)
+	confuse = func(from, left int) {
+		if left == 0 {
+			return
+		}
+		for i := from; i < len(b); i++ {
+			orig := b[i]
+			for _, c := range confusables[rune(orig)] {
+				b[i] = byte(c)
+				add(string(b), distanceConfusable)
+				confuse(i+1, left-1)
+			}
+			b[i] = orig
+		}
+	}
+	confuse(0, maxConfusables)
+
+	//substitution of a single character
+	for i := range b {
+		orig := b[i]
+		for j := 0; j < len(wknAlphabet); j++ {
+			b[i] = wknAlphabet[j]
+			add(string(b), distanceTypo)
+		}
+		b[i] = orig
+	}
+
+	//transposition of adjacent characters
+	for i := 0; i+1 < len(b); i++ {
+		b[i], b[i+1] = b[i+1], b[i]
+		add(string(b), distanceTypo)
+		b[i], b[i+1] = b[i+1], b[i]
+	}
+
+	return candidates
+}
+
+//suggest looks up the closest existing WKNs for unknown WKNs, the securities of the suggestions are returned as well
+func (s *Securities) suggest(ctx context.Context, unknown []string) (map[string][]string, map[string]*mswkn.Security, error) {
+	suggestions := make(map[string][]string)
+	secs := make(map[string]*mswkn.Security)
+	for _, wkn := range unknown {
+		if len(wkn) != 6 {
+			continue
+		}
+
+		candidates := suggestionCandidates(wkn)
+		wkns := make([]string, 0, len(candidates))
+		for c := range candidates {
+			wkns = append(wkns, c)
+		}
+
+		found, err := s.repo.GetMany(ctx, wkns)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(found) == 0 {
+			continue
+		}
+
+		sugs := make([]suggestion, 0, len(found))
+		for c := range found {
+			sugs = append(sugs, suggestion{wkn: c, distance: candidates[c]})
+		}
+		sort.Slice(sugs, func(i, j int) bool {
+			if sugs[i].distance != sugs[j].distance {
+				return sugs[i].distance < sugs[j].distance
+			}
+			return sugs[i].wkn < sugs[j].wkn
+		})
+		if len(sugs) > maxSuggestions {
+			sugs = sugs[:maxSuggestions]
+		}
+
+		for _, sug := range sugs {
+			suggestions[wkn] = append(suggestions[wkn], sug.wkn)
+			secs[sug.wkn] = found[sug.wkn]
+		}
+	}
+	return suggestions, secs, nil
+}
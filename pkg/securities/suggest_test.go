@@ -0,0 +1,48 @@
+package securities
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/mswkn/bot"
+	"gitlab.com/mswkn/bot/pkg/db"
+	"testing"
+)
+
+func Test_suggestionCandidates(t *testing.T) {
+	candidates := suggestionCandidates("A0B1CD")
+
+	assert.Equal(t, distanceConfusable, candidates["AOB1CD"])
+	assert.Equal(t, distanceConfusable, candidates["AOBICD"])
+	assert.Equal(t, distanceTypo, candidates["A0B1CE"])
+	assert.Equal(t, distanceTypo, candidates["0AB1CD"])
+	assert.NotContains(t, candidates, "A0B1CD")
+	assert.NotContains(t, candidates, "A0B1EE")
+}
+
+func Test_suggestionCandidates_allConfusable(t *testing.T) {
+	candidates := suggestionCandidates("000000")
+
+	//153 with one or two confusables and 192 other typos instead of all 4095 combinations
+	assert.Len(t, candidates, 345)
+	assert.Equal(t, distanceConfusable, candidates["O0000Q"])
+	assert.NotContains(t, candidates, "OOO000")
+}
+
+func TestSecurities_suggest(t *testing.T) {
+	repo := db.NewMemorySecurityRepository()
+	assert.NoError(t, repo.AddBulk(context.Background(), []*mswkn.Security{
+		{Name: "typo", WKN: "TT6DHQ", ISIN: "1"},
+		{Name: "confusable", WKN: "TT6DHP", ISIN: "2"},
+		{Name: "far away", WKN: "TT6DXX", ISIN: "3"},
+	}))
+	s := NewService(nil, repo)
+
+	suggestions, secs, err := s.suggest(context.Background(), []string{"TTGDHP", "ZZZZZZ", "DE000TT6DHP1"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"TTGDHP": {"TT6DHP"}}, suggestions)
+	assert.Equal(t, "confusable", secs["TT6DHP"].Name)
+
+	suggestions, _, err = s.suggest(context.Background(), []string{"TT6DHR"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"TT6DHR": {"TT6DHP", "TT6DHQ"}}, suggestions)
+}
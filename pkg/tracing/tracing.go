@@ -0,0 +1,164 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"gitlab.com/mswkn/bot"
+	"gitlab.com/mswkn/bot/pkg/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+	"time"
+)
+
+const tracerName = "gitlab.com/mswkn/bot"
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+var propagator = propagation.TraceContext{}
+
+//Init registers the global tracer provider for the configured exporter. The returned func flushes and stops the exporter.
+func Init(ctx context.Context, conf config.Config) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch conf.Tracing.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(conf.Tracing.OTLPEndpoint)}
+		if conf.Tracing.OTLPInsecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter: %s", conf.Tracing.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not create %s exporter: %w", conf.Tracing.Exporter, err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String("mswkn"),
+			semconv.ServiceVersionKey.String(conf.Version),
+		)),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
+
+//NewTrace starts the trace for a newly received comment
+func NewTrace() mswkn.Trace {
+	return mswkn.Trace{
+		RequestID:  newRequestID(),
+		ReceivedAt: time.Now(),
+		Carrier:    make(map[string]string),
+	}
+}
+
+//Stage is a single step of the comment pipeline, it is backed by a span
+type Stage struct {
+	//Ctx contains the span of the stage
+	Ctx   context.Context
+	span  trace.Span
+	trace mswkn.Trace
+	name  string
+	start time.Time
+}
+
+//StartStage starts a span for a stage as child of the span propagated in the trace
+func StartStage(t mswkn.Trace, stage, name string) *Stage {
+	ctx := propagator.Extract(context.Background(), propagation.MapCarrier(t.Carrier))
+	ctx, span := otel.Tracer(tracerName).Start(ctx, stage, trace.WithAttributes(
+		attribute.String("mswkn.request_id", t.RequestID),
+		attribute.String("mswkn.name", name),
+	))
+
+	s := &Stage{
+		Ctx:   ctx,
+		span:  span,
+		trace: t,
+		name:  stage,
+		start: time.Now(),
+	}
+	return s
+}
+
+//Next returns the trace for the request sent to the next stage, including the timing of this stage
+func (s *Stage) Next() mswkn.Trace {
+	t := mswkn.Trace{
+		RequestID:  s.trace.RequestID,
+		ReceivedAt: s.trace.ReceivedAt,
+		Stages:     make([]mswkn.StageTiming, 0, len(s.trace.Stages)+1),
+		Carrier:    make(map[string]string),
+	}
+	t.Stages = append(t.Stages, s.trace.Stages...)
+	t.Stages = append(t.Stages, mswkn.StageTiming{
+		Stage:    s.name,
+		Start:    s.start,
+		Duration: time.Since(s.start),
+	})
+	propagator.Inject(s.Ctx, propagation.MapCarrier(t.Carrier))
+	return t
+}
+
+//End finishes the span of the stage, a non nil error marks the span as failed
+func (s *Stage) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+
+	log.Debug().
+		Str("comp", "tracing").
+		Str("request_id", s.trace.RequestID).
+		Str("stage", s.name).
+		Dur("duration", time.Since(s.start)).
+		Msg("stage done")
+}
+
+//EndPipeline finishes the span of the last stage and logs the timings of all stages
+func (s *Stage) EndPipeline(err error) {
+	total := time.Since(s.trace.ReceivedAt)
+	s.span.SetAttributes(attribute.Int64("mswkn.total_latency_ms", total.Milliseconds()))
+	s.End(err)
+
+	ev := log.Info().
+		Str("comp", "tracing").
+		Str("request_id", s.trace.RequestID).
+		Dur("total", total)
+	for _, st := range s.Next().Stages {
+		ev = ev.Dur(st.Stage, st.Duration)
+	}
+	ev.Msg("pipeline done")
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,36 @@
+package tracing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func TestStage(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	listener := StartStage(NewTrace(), "listener", "t1_foo")
+	tr := listener.Next()
+	listener.End(nil)
+
+	assert.NotEmpty(t, tr.RequestID)
+	assert.Len(t, tr.Stages, 1)
+	assert.Equal(t, "listener", tr.Stages[0].Stage)
+	assert.Contains(t, tr.Carrier, "traceparent")
+
+	scanner := StartStage(tr, "scanner", "t1_foo")
+	next := scanner.Next()
+	scanner.End(nil)
+
+	assert.Equal(t, tr.RequestID, next.RequestID)
+	assert.Len(t, next.Stages, 2)
+	assert.Len(t, tr.Stages, 1)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, spans[0].SpanContext().TraceID(), spans[1].SpanContext().TraceID())
+	assert.Equal(t, spans[0].SpanContext().SpanID(), spans[1].Parent().SpanID())
+}
@@ -0,0 +1,43 @@
+package mswkn
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrProcessedCommentNotFound = errors.New("processed comment not found")
+	ErrProcessedCommentExists   = errors.New("processed comment already exists")
+)
+
+//ProcessedComment is an entry of the ledger of answered comments
+type ProcessedComment struct {
+	//Name is an ID of the reddit comment, post or message
+	Name string
+	//ReplyID is the name of the reply of the bot, it is empty for private messages and deleted replies
+	ReplyID string
+	//Author of the comment, only the author may delete the reply
+	Author string
+	//WKNs found in the comment
+	WKNs []string
+	//ProcessedAt is the time the comment was claimed by the responder
+	ProcessedAt time.Time
+	//UpdatedAt is the time the reply was last sent or edited, later edits of the comment have to be processed again
+	UpdatedAt time.Time
+}
+
+//ProcessedCommentRepository records answered comments to guarantee at-most-once replies
+type ProcessedCommentRepository interface {
+	//Add claims a comment, it returns ErrProcessedCommentExists if it was already claimed
+	Add(ctx context.Context, pc *ProcessedComment) error
+	Get(ctx context.Context, name string) (*ProcessedComment, error)
+	//GetByReply returns the comment answered by the given reply of the bot
+	GetByReply(ctx context.Context, replyID string) (*ProcessedComment, error)
+	//List returns the comments updated since the given time
+	List(ctx context.Context, since time.Time) ([]*ProcessedComment, error)
+	//Update stores the reply ID, WKNs and update time of a claimed comment
+	Update(ctx context.Context, pc *ProcessedComment) error
+	//Delete releases a claim, e.g. when the reply could not be sent
+	Delete(ctx context.Context, name string) error
+}
@@ -3,7 +3,10 @@ package mswkn
 import (
 	"context"
 	"github.com/friendsofgo/errors"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 const (
@@ -36,19 +39,88 @@ var (
 )
 
 type Security struct {
-	Name           string
-	ISIN           string
-	WKN            string
-	Underlying     string
-	Type           int
-	WarrantType    int
-	WarrantSubType int
-	Strike         float64
-	Expire         *time.Time
+	Name           string     `proto:"1"`
+	ISIN           string     `proto:"2"`
+	WKN            string     `proto:"3"`
+	Underlying     string     `proto:"4"`
+	Type           int        `proto:"5"`
+	WarrantType    int        `proto:"6"`
+	WarrantSubType int        `proto:"7"`
+	Strike         float64    `proto:"8"`
+	Expire         *time.Time `proto:"9"`
+	//Ticker is the exchange mnemonic, e.g. SAP. It is stored as alias and not with the security in postgres.
+	Ticker string `proto:"10"`
 }
 
 type SecurityRepository interface {
 	Add(ctx context.Context, sec *Security) error
 	AddBulk(ctx context.Context, secs []*Security) error
 	Get(ctx context.Context, wkn string) (*Security, error)
+	GetByISIN(ctx context.Context, isin string) (*Security, error)
+	//GetMany returns the found securities with their WKN as key, unknown WKNs are left out
+	GetMany(ctx context.Context, wkns []string) (map[string]*Security, error)
+	//Search finds securities whose name contains any of the words of the query, best matches first.
+	//Words shorter than SecuritySearchMinTokenLength are ignored.
+	Search(ctx context.Context, query string, filters SecuritySearchFilters) (*SecuritySearchResult, error)
+}
+
+const (
+	SecuritySearchDefaultLimit = 20
+	SecuritySearchMaxLimit     = 100
+	//SecuritySearchMinTokenLength is the shortest searched word, shorter words can not use a trigram index
+	SecuritySearchMinTokenLength = 3
+)
+
+type SecuritySearchFilters struct {
+	//Type is one of the SecurityType constants, SecurityTypeUndefined matches all types
+	Type int
+	//Issuer is matched case insensitive against the beginning of the name
+	Issuer string
+	//ExpireFrom and ExpireTo limit the expiry, nil means no limit. Securities without expiry only match without limits.
+	ExpireFrom *time.Time
+	ExpireTo   *time.Time
+	Offset     int
+	//Limit is capped at SecuritySearchMaxLimit, zero means SecuritySearchDefaultLimit
+	Limit int
+}
+
+//Normalize applies the defaults and caps of the pagination
+func (f SecuritySearchFilters) Normalize() SecuritySearchFilters {
+	if f.Limit <= 0 {
+		f.Limit = SecuritySearchDefaultLimit
+	}
+	if f.Limit > SecuritySearchMaxLimit {
+		f.Limit = SecuritySearchMaxLimit
+	}
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+	return f
+}
+
+type SecuritySearchResult struct {
+	Securities []*Security `json:"securities"`
+	//Total is the number of matches without pagination
+	Total int `json:"total"`
+}
+
+//SearchTokens splits a search query or a security name into upper case words
+func SearchTokens(text string) []string {
+	return strings.FieldsFunc(strings.ToUpper(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+//SearchQueryTokens returns the unique words of a search query with at least SecuritySearchMinTokenLength characters
+func SearchQueryTokens(query string) []string {
+	seen := make(map[string]bool)
+	tokens := make([]string, 0)
+	for _, t := range SearchTokens(query) {
+		if seen[t] || utf8.RuneCountInString(t) < SecuritySearchMinTokenLength {
+			continue
+		}
+		seen[t] = true
+		tokens = append(tokens, t)
+	}
+	return tokens
 }
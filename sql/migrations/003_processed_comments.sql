@@ -0,0 +1,13 @@
+-- +migrate Up
+create table if not exists processed_comments
+(
+    name         text                  not null,
+    reply_id     text      default ''  not null,
+    wkns         text[]    default '{}' not null,
+    processed_at timestamp             not null,
+    constraint processed_comments_pkey
+        primary key (name)
+);
+
+-- +migrate Down
+drop table processed_comments;
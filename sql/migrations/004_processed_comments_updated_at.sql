@@ -0,0 +1,10 @@
+-- +migrate Up
+alter table processed_comments
+    add updated_at timestamp default now() not null;
+create index processed_comments_updated_at_index
+    on processed_comments (updated_at);
+
+-- +migrate Down
+drop index processed_comments_updated_at_index;
+alter table processed_comments
+    drop column updated_at;
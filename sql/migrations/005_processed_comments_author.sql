@@ -0,0 +1,10 @@
+-- +migrate Up
+alter table processed_comments
+    add author text default '' not null;
+create index processed_comments_reply_id_index
+    on processed_comments (reply_id);
+
+-- +migrate Down
+drop index processed_comments_reply_id_index;
+alter table processed_comments
+    drop column author;
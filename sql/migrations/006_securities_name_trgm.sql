@@ -0,0 +1,7 @@
+-- +migrate Up
+create extension if not exists pg_trgm;
+create index securities_name_trgm_index
+    on securities using gin (name gin_trgm_ops);
+
+-- +migrate Down
+drop index securities_name_trgm_index;
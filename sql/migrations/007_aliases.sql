@@ -0,0 +1,13 @@
+-- +migrate Up
+create table if not exists aliases
+(
+    alias      text             not null,
+    wkn        text             not null,
+    source     text             not null,
+    confidence double precision not null,
+    constraint aliases_pkey
+        primary key (alias, wkn, source)
+);
+
+-- +migrate Down
+drop table aliases;
@@ -0,0 +1,22 @@
+-- +migrate Up
+create table if not exists pending_replies
+(
+    id         text                     not null,
+    name       text                     not null,
+    action     text                     not null,
+    target     text                     not null,
+    subject    text        default ''   not null,
+    body       text                     not null,
+    wkns       text[]      default '{}' not null,
+    attempts   integer     default 0    not null,
+    not_before timestamptz              not null,
+    created_at timestamptz              not null,
+    constraint pending_replies_pkey
+        primary key (id)
+);
+create index pending_replies_not_before_index
+    on pending_replies (not_before, created_at);
+
+-- +migrate Down
+drop index pending_replies_not_before_index;
+drop table pending_replies;
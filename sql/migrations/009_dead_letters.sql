@@ -0,0 +1,19 @@
+-- +migrate Up
+create table if not exists dead_letters
+(
+    id        text                   not null,
+    subject   text                   not null,
+    payload   bytea                  not null,
+    codec     text                   not null,
+    error     text        default '' not null,
+    attempts  integer     default 0  not null,
+    failed_at timestamptz            not null,
+    constraint dead_letters_pkey
+        primary key (id)
+);
+create index dead_letters_failed_at_index
+    on dead_letters (failed_at);
+
+-- +migrate Down
+drop index dead_letters_failed_at_index;
+drop table dead_letters;
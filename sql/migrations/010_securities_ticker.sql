@@ -0,0 +1,7 @@
+-- +migrate Up
+alter table securities
+    add ticker text default '' not null;
+
+-- +migrate Down
+alter table securities
+    drop column ticker;
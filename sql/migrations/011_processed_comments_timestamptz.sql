@@ -0,0 +1,10 @@
+-- +migrate Up
+-- the scratch image of the bot has no time zone data, the stored wall times are UTC
+alter table processed_comments
+    alter column processed_at type timestamptz using processed_at at time zone 'UTC',
+    alter column updated_at type timestamptz using updated_at at time zone 'UTC';
+
+-- +migrate Down
+alter table processed_comments
+    alter column processed_at type timestamp using processed_at at time zone 'UTC',
+    alter column updated_at type timestamp using updated_at at time zone 'UTC';
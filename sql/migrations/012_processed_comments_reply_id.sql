@@ -0,0 +1,11 @@
+-- +migrate Up
+-- 005 indexes every reply id, most comments have none
+drop index if exists processed_comments_reply_id_index;
+create index processed_comments_reply_id_index
+    on processed_comments (reply_id)
+    where reply_id <> '';
+
+-- +migrate Down
+drop index processed_comments_reply_id_index;
+create index processed_comments_reply_id_index
+    on processed_comments (reply_id);
@@ -0,0 +1,21 @@
+package mswkn
+
+import "time"
+
+//Trace is carried by every request of the comment pipeline and ties the stages of a comment together
+type Trace struct {
+	//RequestID correlates all messages created for one reddit comment
+	RequestID string `json:"request_id" proto:"1"`
+	//ReceivedAt is the time the listener received the comment
+	ReceivedAt time.Time `json:"received_at" proto:"2"`
+	//Stages contains the timings of all stages which already processed the request
+	Stages []StageTiming `json:"stages" proto:"3"`
+	//Carrier holds the propagated span context, e.g. the W3C traceparent header
+	Carrier map[string]string `json:"carrier" proto:"4"`
+}
+
+type StageTiming struct {
+	Stage    string        `json:"stage" proto:"1"`
+	Start    time.Time     `json:"start" proto:"2"`
+	Duration time.Duration `json:"duration" proto:"3"`
+}